@@ -0,0 +1,334 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// ansiOSCLimit - максимальная длина строки OSC; более длинные строки обрезаются
+const ansiOSCLimit = 4096
+
+// ansiTextWidthLimit - максимальная ширина строки ansiText. Перемещения курсора
+// и счетчики в последовательностях CSI ограничиваются ею, чтобы "ESC [ 999999999 C"
+// не заполнял память пробелами
+const ansiTextWidthLimit = 4096
+
+// ansiHandler получает элементы потока вывода, разобранные ansiDecoder
+type ansiHandler interface {
+	print(r rune)                  // Печатаемый символ
+	control(r rune)                // Управляющий символ C0, кроме ESC
+	escape(final rune)             // ESC и финальный символ: ESC 7, ESC M, ESC c и т.п.
+	csi(params string, final byte) // ESC [ параметры и финальный символ
+	osc(data string)               // ESC ] строка до BEL или ESC \
+}
+
+// ansiState - состояние разбора управляющих последовательностей
+type ansiState int
+
+const (
+	ansiGround       ansiState = iota // Обычный текст
+	ansiEscape                        // После ESC
+	ansiIntermediate                  // ESC с промежуточными символами: выбор набора символов ESC ( B, ESC # 8
+	ansiSingleShift                   // SS2/SS3 (ESC N, ESC O): следующий символ выводится как есть
+	ansiCSI                           // ESC [ параметры и финальный символ
+	ansiOSC                           // ESC ] строка до BEL или ESC \
+	ansiString                        // DCS, SOS, PM, APC: строка до ESC \, пропускается
+	ansiStringEscape                  // ESC внутри строки: возможно, начало ESC \
+)
+
+// ansiDecoder - потоковый разборщик управляющих последовательностей ECMA-48 и xterm.
+// Вывод передается кусками через Write: последовательности и символы UTF-8,
+// разрезанные между кусками, дописываются при следующем вызове
+type ansiDecoder struct {
+	handler ansiHandler
+	state   ansiState
+	osc     bool   // Строка в состоянии ansiStringEscape - OSC, а не DCS и т.п.
+	params  []byte // Параметры текущей последовательности CSI или строка OSC
+	partial []byte // Неполный символ UTF-8 в конце предыдущего куска
+}
+
+// Write разбирает очередной кусок вывода
+func (d *ansiDecoder) Write(data []byte) (int, error) {
+	n := len(data)
+	if len(d.partial) > 0 {
+		data = append(d.partial, data...)
+		d.partial = nil
+	}
+
+	for len(data) > 0 {
+		if data[0] < utf8.RuneSelf {
+			d.feed(rune(data[0]))
+			data = data[1:]
+			continue
+		}
+		if !utf8.FullRune(data) {
+			d.partial = append([]byte(nil), data...)
+			break
+		}
+		r, size := utf8.DecodeRune(data)
+		d.feed(r)
+		data = data[size:]
+	}
+	return n, nil
+}
+
+// reset прерывает разбор текущей последовательности
+func (d *ansiDecoder) reset() {
+	d.state = ansiGround
+	d.params = d.params[:0]
+}
+
+// feed обрабатывает один символ
+func (d *ansiDecoder) feed(r rune) {
+	// CAN и SUB прерывают любую последовательность
+	if (r == 0x18 || r == 0x1a) && d.state != ansiGround {
+		d.reset()
+		return
+	}
+
+	switch d.state {
+	case ansiEscape:
+		d.escape(r)
+
+	case ansiIntermediate:
+		switch {
+		case r >= 0x30 && r <= 0x7e:
+			d.state = ansiGround
+		case r == 0x1b:
+			d.state = ansiEscape
+		}
+
+	case ansiSingleShift:
+		d.state = ansiGround
+		if r >= 0x20 {
+			d.handler.print(r)
+		}
+
+	case ansiCSI:
+		switch {
+		case r >= 0x40 && r <= 0x7e:
+			d.state = ansiGround
+			d.handler.csi(string(d.params), byte(r))
+		case r == 0x1b:
+			d.state = ansiEscape
+		case r < 0x20:
+			// Управляющие символы внутри CSI выполняются сразу
+			d.handler.control(r)
+		case r < 0x7f:
+			d.params = append(d.params, byte(r))
+		}
+
+	case ansiOSC:
+		switch {
+		case r == 0x07:
+			d.state = ansiGround
+			d.handler.osc(string(d.params))
+		case r == 0x1b:
+			d.state, d.osc = ansiStringEscape, true
+		case len(d.params) < ansiOSCLimit:
+			d.params = utf8.AppendRune(d.params, r)
+		}
+
+	case ansiString:
+		switch r {
+		case 0x07:
+			d.state = ansiGround
+		case 0x1b:
+			d.state, d.osc = ansiStringEscape, false
+		}
+
+	case ansiStringEscape:
+		// ESC \ завершает строку, другой символ начинает новую последовательность
+		d.state = ansiGround
+		if d.osc {
+			d.handler.osc(string(d.params))
+		}
+		if r != '\\' {
+			d.escape(r)
+		}
+
+	default:
+		switch {
+		case r == 0x1b:
+			d.state = ansiEscape
+		case r < 0x20 || r == 0x7f:
+			d.handler.control(r)
+		default:
+			d.handler.print(r)
+		}
+	}
+}
+
+// escape обрабатывает символ после ESC
+func (d *ansiDecoder) escape(r rune) {
+	d.reset()
+	switch {
+	case r == '[':
+		d.state = ansiCSI
+	case r == ']':
+		d.state = ansiOSC
+	case r == 'P' || r == 'X' || r == '^' || r == '_':
+		d.state = ansiString
+	case r == 'N' || r == 'O':
+		d.state = ansiSingleShift
+	case r >= 0x20 && r <= 0x2f:
+		d.state = ansiIntermediate
+	case r == 0x1b:
+		d.state = ansiEscape
+	case r < 0x20:
+		d.handler.control(r)
+	default:
+		d.handler.escape(r)
+	}
+}
+
+// ansiText собирает текст с управляющими последовательностями в строки: возврат
+// каретки и перемещения курсора переписывают уже выведенный текст, как в терминале,
+// поэтому индикаторы прогресса обновляются на месте. Ширина строк ограничена
+// ansiTextWidthLimit: символы за ней пишутся в последний столбец
+type ansiText struct {
+	decoder   ansiDecoder
+	rows      [][]vtCell
+	x, y      int
+	style     tcell.Style
+	baseStyle tcell.Style
+	link      string // Текущая гиперссылка OSC 8
+}
+
+// newANSIText создает сборщик строк с базовым стилем baseStyle
+func newANSIText(baseStyle tcell.Style) *ansiText {
+	a := &ansiText{rows: [][]vtCell{nil}, style: baseStyle, baseStyle: baseStyle}
+	a.decoder.handler = a
+	return a
+}
+
+// Write разбирает очередной кусок текста
+func (a *ansiText) Write(data []byte) (int, error) {
+	return a.decoder.Write(data)
+}
+
+// segments возвращает собранный текст в виде сегментов вывода
+func (a *ansiText) segments() []LineSegment {
+	return vtSegments(a.rows)
+}
+
+func (a *ansiText) print(r rune) {
+	a.fill(a.x + 1)
+	a.rows[a.y][a.x] = vtCell{ch: r, style: a.style, link: a.link}
+	a.x = min(a.x+1, ansiTextWidthLimit-1)
+}
+
+func (a *ansiText) control(r rune) {
+	switch r {
+	case '\r':
+		a.x = 0
+	case '\n', '\v', '\f':
+		a.moveTo(0, a.y+1)
+	case '\b':
+		a.x = max(0, a.x-1)
+	case '\t':
+		next := min((a.x/8+1)*8, ansiTextWidthLimit-1)
+		a.fill(next)
+		a.x = next
+	}
+}
+
+func (a *ansiText) escape(final rune) {
+	switch final {
+	case 'D':
+		a.moveTo(a.x, a.y+1)
+	case 'E':
+		a.moveTo(0, a.y+1)
+	case 'M':
+		a.moveTo(a.x, a.y-1)
+	}
+}
+
+func (a *ansiText) csi(params string, final byte) {
+	if params != "" && (params[0] < '0' || params[0] > ';') {
+		// Приватные последовательности (режимы, запросы) на текст не влияют
+		return
+	}
+	args := parseANSICodes(params)
+	n := min(max(1, args[0]), ansiTextWidthLimit)
+
+	switch final {
+	case 'm':
+		a.style = applyANSICodes(a.style, params, a.baseStyle)
+	case 'A':
+		a.moveTo(a.x, a.y-n)
+	case 'B', 'e':
+		a.moveTo(a.x, a.y+n)
+	case 'C', 'a':
+		a.moveTo(a.x+n, a.y)
+	case 'D':
+		a.moveTo(a.x-n, a.y)
+	case 'E':
+		a.moveTo(0, a.y+n)
+	case 'F':
+		a.moveTo(0, a.y-n)
+	case 'G', '`':
+		a.moveTo(n-1, a.y)
+	case 'K':
+		a.eraseLine(args[0])
+	case 'J':
+		// Очистка экрана: стирается текст после курсора (0) или весь текст (2, 3)
+		switch args[0] {
+		case 0:
+			a.eraseLine(0)
+			a.rows = a.rows[:a.y+1]
+		case 2, 3:
+			a.rows = [][]vtCell{nil}
+			a.x, a.y = 0, 0
+		}
+	}
+}
+
+// osc обрабатывает гиперссылки OSC 8; заголовки окна и прочие строки OSC на текст не влияют
+func (a *ansiText) osc(data string) {
+	if link, ok := parseOSC8(data); ok {
+		a.link = link
+	}
+}
+
+// parseOSC8 разбирает строку OSC 8 "8;параметры;URI". Пустой URI завершает ссылку
+func parseOSC8(data string) (string, bool) {
+	rest, ok := strings.CutPrefix(data, "8;")
+	if !ok {
+		return "", false
+	}
+	_, uri, ok := strings.Cut(rest, ";")
+	return uri, ok
+}
+
+// moveTo перемещает курсор; строки ниже последней добавляются по мере надобности
+func (a *ansiText) moveTo(x, y int) {
+	a.x, a.y = max(0, min(ansiTextWidthLimit-1, x)), max(0, y)
+	for len(a.rows) <= a.y {
+		a.rows = append(a.rows, nil)
+	}
+}
+
+// fill дополняет текущую строку пробелами до ширины width
+func (a *ansiText) fill(width int) {
+	for len(a.rows[a.y]) < width {
+		a.rows[a.y] = append(a.rows[a.y], vtCell{ch: ' ', style: a.baseStyle})
+	}
+}
+
+// eraseLine очищает часть строки (EL): 0 - от курсора, 1 - до курсора, 2 - всю строку
+func (a *ansiText) eraseLine(mode int) {
+	row := a.rows[a.y]
+	switch mode {
+	case 0:
+		a.rows[a.y] = row[:min(a.x, len(row))]
+	case 1:
+		for x := 0; x <= a.x && x < len(row); x++ {
+			row[x] = vtCell{ch: ' ', style: a.baseStyle}
+		}
+	case 2:
+		a.rows[a.y] = nil
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// ansiRecorder записывает элементы, разобранные ansiDecoder, в виде строк
+type ansiRecorder struct {
+	events []string
+}
+
+func (r *ansiRecorder) print(ch rune)   { r.events = append(r.events, fmt.Sprintf("print %q", ch)) }
+func (r *ansiRecorder) control(ch rune) { r.events = append(r.events, fmt.Sprintf("control %q", ch)) }
+func (r *ansiRecorder) escape(ch rune)  { r.events = append(r.events, fmt.Sprintf("escape %q", ch)) }
+func (r *ansiRecorder) csi(params string, final byte) {
+	r.events = append(r.events, fmt.Sprintf("csi %q %c", params, final))
+}
+func (r *ansiRecorder) osc(data string) { r.events = append(r.events, fmt.Sprintf("osc %q", data)) }
+
+// decodeChunks разбирает куски вывода одним декодером и возвращает события
+func decodeChunks(chunks ...string) []string {
+	recorder := &ansiRecorder{}
+	decoder := ansiDecoder{handler: recorder}
+	for _, chunk := range chunks {
+		decoder.Write([]byte(chunk))
+	}
+	return recorder.events
+}
+
+func TestANSIDecoder(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"текст", "aж\r\n", []string{`print 'a'`, `print 'ж'`, `control '\r'`, `control '\n'`}},
+		{"CSI", "\x1b[1;31mx", []string{`csi "1;31" m`, `print 'x'`}},
+		{"приватный CSI", "\x1b[?1049h", []string{`csi "?1049" h`}},
+		{"ESC", "\x1b7\x1bM", []string{`escape '7'`, `escape 'M'`}},
+		{"OSC с BEL", "\x1b]0;title\x07", []string{`osc "0;title"`}},
+		{"OSC с ST", "\x1b]8;;http://x\x1b\\y", []string{`osc "8;;http://x"`, `print 'y'`}},
+		{"DCS пропускается", "\x1bPq#0\x1b\\z", []string{`print 'z'`}},
+		{"набор символов", "\x1b(Bz", []string{`print 'z'`}},
+		{"CAN прерывает CSI", "\x1b[31\x18z", []string{`print 'z'`}},
+		{"управляющий символ внутри CSI", "\x1b[1\b;2H", []string{`control '\b'`, `csi "1;2" H`}},
+		{"SS3", "\x1bOP", []string{`print 'P'`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeChunks(tt.input); strings.Join(got, ", ") != strings.Join(tt.want, ", ") {
+				t.Errorf("%q: %q, ожидалось %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestANSIDecoderSplitWrites(t *testing.T) {
+	// Поток, разрезанный в любом месте - внутри символа UTF-8, CSI или OSC, -
+	// разбирается так же, как целиком
+	inputs := []string{
+		"привет 世界 😀",
+		"a\x1b[1;31mкрасный\x1b[0m\r\n",
+		"\x1b]8;;file:///tmp/ж\x1b\\ссылка\x1b]8;;\x07",
+		"\x1b[?1049h\x1b[2;3Hж\x1b7\x1b8",
+	}
+	for _, input := range inputs {
+		want := decodeChunks(input)
+		for i := 1; i < len(input); i++ {
+			got := decodeChunks(input[:i], input[i:])
+			if strings.Join(got, ", ") != strings.Join(want, ", ") {
+				t.Errorf("%q, разрезано на байте %d: %q, ожидалось %q", input, i, got, want)
+			}
+		}
+		// И по одному байту
+		var chunks []string
+		for i := range len(input) {
+			chunks = append(chunks, input[i:i+1])
+		}
+		if got := decodeChunks(chunks...); strings.Join(got, ", ") != strings.Join(want, ", ") {
+			t.Errorf("%q по байту: %q, ожидалось %q", input, got, want)
+		}
+	}
+}
+
+// ansiTextRows возвращает строки, собранные ansiText, без стилей
+func ansiTextRows(a *ansiText) []string {
+	rows := make([]string, len(a.rows))
+	for y, row := range a.rows {
+		for _, cell := range row {
+			rows[y] += string(cell.ch)
+		}
+	}
+	return rows
+}
+
+func TestANSIText(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"возврат каретки", "50%\r100%", []string{"100%"}},
+		{"прогресс с очисткой строки", "долго...\r\x1b[Kготово", []string{"готово"}},
+		{"перемещение вверх", "a\nb\n\x1b[2Ax", []string{"x", "b", ""}},
+		{"столбец", "abc\x1b[2Gx", []string{"axc"}},
+		{"вправо", "a\x1b[3Cb", []string{"a   b"}},
+		{"табуляция", "a\tb", []string{"a       b"}},
+		{"забой", "ab\bc", []string{"ac"}},
+		{"очистка экрана", "a\nb\x1b[2Jc", []string{"c"}},
+		{"EL 1", "abc\x1b[2G\x1b[1Kx", []string{" xc"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newANSIText(tcell.StyleDefault)
+			a.Write([]byte(tt.input))
+			if got := ansiTextRows(a); strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("%q: %q, ожидалось %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestANSITextClampsCounts(t *testing.T) {
+	tests := []string{
+		"\x1b[999999999Cx",
+		"\x1b[999999999`x",
+		"\x1b[9223372036854775807Cx",
+		strings.Repeat("\x1b[4000C", 100) + "x",
+		strings.Repeat("\t", 1000) + "x",
+		strings.Repeat("y", ansiTextWidthLimit+10),
+	}
+	for _, input := range tests {
+		a := newANSIText(tcell.StyleDefault)
+		a.Write([]byte(input))
+		if len(a.rows) != 1 || len(a.rows[0]) > ansiTextWidthLimit {
+			t.Errorf("%.20q: %d строк, ширина %d", input, len(a.rows), len(a.rows[0]))
+		}
+	}
+}
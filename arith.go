@@ -0,0 +1,379 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// arithLevels - бинарные операторы $((...)) по возрастанию приоритета
+var arithLevels = [][]string{
+	{"||"}, {"&&"}, {"|"}, {"^"}, {"&"}, {"==", "!="}, {"<", "<=", ">", ">="},
+	{"<<", ">>"}, {"+", "-"}, {"*", "/", "%"},
+}
+
+// arithAssignments - операторы присваивания: x=1, x+=2 и т.п.
+var arithAssignments = []string{"=", "+=", "-=", "*=", "/=", "%=", "<<=", ">>=", "&=", "^=", "|="}
+
+// arithOperators - операторы для разбора выражения на лексемы, длинные раньше коротких
+var arithOperators = []string{
+	"<<=", ">>=", "**", "<<", ">>", "<=", ">=", "==", "!=", "&&", "||",
+	"+=", "-=", "*=", "/=", "%=", "&=", "^=", "|=",
+	"+", "-", "*", "/", "%", "(", ")", "<", ">", "!", "~", "&", "|", "^", "?", ":", "=",
+}
+
+// isArithmeticStart проверяет, что подстановка $(...) от i до end - арифметическая:
+// $((...)), где внутренние скобки охватывают все выражение. $((a); (b)) - команды
+func isArithmeticStart(runes []rune, i, end int) bool {
+	if runes[i] != '$' || end-i < 5 || runes[i+2] != '(' || runes[end-2] != ')' {
+		return false
+	}
+	depth := 0
+	for j := i + 2; j < end-2; j++ {
+		switch runes[j] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// arithParser разбирает арифметическое выражение рекурсивным спуском
+type arithParser struct {
+	t      *Terminal
+	tokens []string
+	pos    int
+	skip   int // Больше 0 - часть выражения не вычисляется (&&, ||, ?:): присваивания и ошибки пропускаются
+}
+
+// evalArithmetic вычисляет выражение $((...)) над целыми числами, как bash.
+// Переменные можно писать как с '$', так и без него; пустая переменная - 0.
+// Присваивания (x=1, x+=2) меняют переменные терминала
+func (t *Terminal) evalArithmetic(expr string) (string, error) {
+	tokens, err := t.arithTokens(expr)
+	if err != nil {
+		return "", err
+	}
+	if len(tokens) == 0 {
+		return "0", nil
+	}
+	p := &arithParser{t: t, tokens: tokens}
+	value, err := p.assign()
+	if err != nil {
+		return "", err
+	}
+	if p.pos < len(p.tokens) {
+		return "", fmt.Errorf("синтаксическая ошибка в выражении: '%s'", p.tokens[p.pos])
+	}
+	return strconv.FormatInt(value, 10), nil
+}
+
+// arithTokens разбивает выражение на числа, имена переменных и операторы.
+// Подстановки $ИМЯ заменяются значениями сразу: присвоить им нельзя
+func (t *Terminal) arithTokens(expr string) ([]string, error) {
+	var tokens []string
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case r == ' ' || r == '\t' || r == '\n':
+			i++
+		case r == '$':
+			value, next, ok := t.expandVarAt(runes, i)
+			if !ok {
+				return nil, fmt.Errorf("синтаксическая ошибка в выражении: '%s'", string(runes[i:]))
+			}
+			number, err := arithValue(string(runes[i:next]), value)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, strconv.FormatInt(number, 10))
+			i = next
+		case isVarNameStart(r):
+			j := i
+			for j < len(runes) && isVarNameChar(runes[j]) {
+				j++
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		case r >= '0' && r <= '9':
+			j := i
+			for j < len(runes) && isVarNameChar(runes[j]) {
+				j++
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		default:
+			rest := string(runes[i:])
+			k := slices.IndexFunc(arithOperators, func(op string) bool { return strings.HasPrefix(rest, op) })
+			if k < 0 {
+				return nil, fmt.Errorf("синтаксическая ошибка в выражении: '%s'", rest)
+			}
+			tokens = append(tokens, arithOperators[k])
+			i += len([]rune(arithOperators[k]))
+		}
+	}
+	return tokens, nil
+}
+
+// arithValue возвращает значение переменной как число; пустое значение - 0
+func arithValue(name, value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	number, err := strconv.ParseInt(value, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: значение не число: '%s'", name, value)
+	}
+	return number, nil
+}
+
+// peek возвращает текущую лексему или "" в конце выражения
+func (p *arithParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+// assign разбирает присваивание ИМЯ оп= выражение; оно правоассоциативно
+func (p *arithParser) assign() (int64, error) {
+	name := p.peek()
+	if !isArithName(name) || p.pos+1 >= len(p.tokens) || !slices.Contains(arithAssignments, p.tokens[p.pos+1]) {
+		return p.conditional()
+	}
+	op := p.tokens[p.pos+1]
+	p.pos += 2
+	value, err := p.assign()
+	if err != nil {
+		return 0, err
+	}
+	if op != "=" {
+		current, err := p.variable(name)
+		if err != nil {
+			return 0, err
+		}
+		if value, err = p.apply(strings.TrimSuffix(op, "="), current, value); err != nil {
+			return 0, err
+		}
+	}
+	if p.skip == 0 {
+		p.t.envVars[name] = strconv.FormatInt(value, 10)
+	}
+	return value, nil
+}
+
+// conditional разбирает условный оператор "условие ? значение : иначе";
+// невыбранная ветка разбирается, но не вычисляется
+func (p *arithParser) conditional() (int64, error) {
+	cond, err := p.binary(0)
+	if err != nil || p.peek() != "?" {
+		return cond, err
+	}
+	p.pos++
+
+	var values [2]int64
+	for i, branch := range []bool{cond != 0, cond == 0} {
+		if i == 1 {
+			if p.peek() != ":" {
+				return 0, fmt.Errorf("синтаксическая ошибка в выражении: ожидается ':'")
+			}
+			p.pos++
+		}
+		if !branch {
+			p.skip++
+		}
+		values[i], err = p.assign()
+		if !branch {
+			p.skip--
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	if cond != 0 {
+		return values[0], nil
+	}
+	return values[1], nil
+}
+
+// binary разбирает бинарные операторы уровня level и выше
+func (p *arithParser) binary(level int) (int64, error) {
+	if level == len(arithLevels) {
+		return p.power()
+	}
+	left, err := p.binary(level + 1)
+	if err != nil {
+		return 0, err
+	}
+	for slices.Contains(arithLevels[level], p.peek()) {
+		op := p.peek()
+		p.pos++
+		// Как в bash, && и || не вычисляют правую часть, если результат уже известен
+		skip := op == "&&" && left == 0 || op == "||" && left != 0
+		if skip {
+			p.skip++
+		}
+		right, err := p.binary(level + 1)
+		if skip {
+			p.skip--
+		}
+		if err != nil {
+			return 0, err
+		}
+		if left, err = p.apply(op, left, right); err != nil {
+			return 0, err
+		}
+	}
+	return left, nil
+}
+
+// power разбирает возведение в степень: оно правоассоциативно
+func (p *arithParser) power() (int64, error) {
+	base, err := p.unary()
+	if err != nil || p.peek() != "**" {
+		return base, err
+	}
+	p.pos++
+	exp, err := p.power()
+	if err != nil {
+		return 0, err
+	}
+	return p.apply("**", base, exp)
+}
+
+// unary разбирает унарные операторы, скобки, числа и переменные
+func (p *arithParser) unary() (int64, error) {
+	token := p.peek()
+	p.pos++
+	switch token {
+	case "-", "+", "!", "~":
+		value, err := p.unary()
+		switch token {
+		case "-":
+			value = -value
+		case "!":
+			value = boolInt(value == 0)
+		case "~":
+			value = ^value
+		}
+		return value, err
+	case "(":
+		value, err := p.assign()
+		if err != nil {
+			return 0, err
+		}
+		if p.peek() != ")" {
+			return 0, fmt.Errorf("синтаксическая ошибка в выражении: ожидается ')'")
+		}
+		p.pos++
+		return value, nil
+	case "":
+		return 0, fmt.Errorf("синтаксическая ошибка в выражении: ожидается операнд")
+	}
+	if isArithName(token) {
+		return p.variable(token)
+	}
+	value, err := strconv.ParseInt(token, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("синтаксическая ошибка в выражении: '%s'", token)
+	}
+	return value, nil
+}
+
+// isArithName проверяет, что лексема - имя переменной, а не число или оператор
+func isArithName(token string) bool {
+	r, _ := utf8.DecodeRuneInString(token)
+	return token != "" && isVarNameStart(r)
+}
+
+// variable возвращает значение переменной; неустановленная переменная - 0
+func (p *arithParser) variable(name string) (int64, error) {
+	value, _ := p.t.lookupVar(name)
+	return arithValue(name, value)
+}
+
+// apply применяет бинарный оператор. В невычисляемой части выражения
+// ошибки (деление на 0) не возникают
+func (p *arithParser) apply(op string, a, b int64) (int64, error) {
+	value, err := arithApply(op, a, b)
+	if p.skip > 0 {
+		return value, nil
+	}
+	return value, err
+}
+
+// arithApply применяет бинарный оператор
+func arithApply(op string, a, b int64) (int64, error) {
+	switch op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "/", "%":
+		if b == 0 {
+			return 0, fmt.Errorf("деление на 0")
+		}
+		if op == "/" {
+			return a / b, nil
+		}
+		return a % b, nil
+	case "**":
+		if b < 0 {
+			return 0, fmt.Errorf("отрицательная степень")
+		}
+		result := int64(1)
+		for ; b > 0; b >>= 1 {
+			if b&1 == 1 {
+				result *= a
+			}
+			a *= a
+		}
+		return result, nil
+	case "<<":
+		return a << uint64(b&63), nil
+	case ">>":
+		return a >> uint64(b&63), nil
+	case "<":
+		return boolInt(a < b), nil
+	case "<=":
+		return boolInt(a <= b), nil
+	case ">":
+		return boolInt(a > b), nil
+	case ">=":
+		return boolInt(a >= b), nil
+	case "==":
+		return boolInt(a == b), nil
+	case "!=":
+		return boolInt(a != b), nil
+	case "&":
+		return a & b, nil
+	case "|":
+		return a | b, nil
+	case "^":
+		return a ^ b, nil
+	case "&&":
+		return boolInt(a != 0 && b != 0), nil
+	case "||":
+		return boolInt(a != 0 || b != 0), nil
+	}
+	return 0, fmt.Errorf("неизвестный оператор '%s'", op)
+}
+
+// boolInt возвращает 1 для истины и 0 для лжи, как сравнения в $((...))
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// listItem - одна команда в списке команд вместе с оператором, который ей предшествует
+type listItem struct {
+	op         string // "", ";", "&", "&&" или "||"
+	cmd        string
+	background bool // Команда завершается '&'. В отличие от bash, '&' относится к одному конвейеру
+}
+
+// splitCommandList разбивает строку на команды по операторам ';', '&', '&&' и '||'
+func splitCommandList(input string) ([]listItem, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []listItem
+	runes := []rune(input)
+	op := ""
+	start := 0   // Начало текущей команды в строке
+	counted := 0 // Число лексем в текущей команде
+
+	for _, tok := range tokens {
+		if tok.kind != tokenOperator || tok.text == "|" {
+			counted++
+			continue
+		}
+		if counted == 0 {
+			return nil, fmt.Errorf("синтаксическая ошибка рядом с '%s'", tok.text)
+		}
+		items = append(items, listItem{op: op, cmd: strings.TrimSpace(string(runes[start:tok.start])), background: tok.text == "&"})
+		op = tok.text
+		start = tok.end
+		counted = 0
+	}
+
+	if counted > 0 {
+		items = append(items, listItem{op: op, cmd: strings.TrimSpace(string(runes[start:]))})
+	} else if op == "&&" || op == "||" {
+		// После ';' и '&' команда может отсутствовать, после '&&' и '||' - нет
+		return nil, fmt.Errorf("синтаксическая ошибка: ожидается команда после '%s'", op)
+	}
+
+	return items, nil
+}
+
+// skipListItem проверяет, нужно ли пропустить команду: после '&&' при ошибке
+// и после '||' при успехе предыдущей команды
+func skipListItem(item listItem, status int) bool {
+	return (item.op == "&&" && status != 0) || (item.op == "||" && status == 0)
+}
+
+// itemMode возвращает способ запуска внешних команд элемента списка
+func itemMode(item listItem, foreground execMode) execMode {
+	if item.background {
+		return execBackground
+	}
+	return foreground
+}
+
+// executeCommandListTo выполняет список команд, дожидаясь завершения каждой, и направляет
+// их stdout в capture. Используется для подстановок $(...)
+func (t *Terminal) executeCommandListTo(line string, capture *os.File) ([]LineSegment, int) {
+	items, err := splitCommandList(line)
+	if err != nil {
+		t.lastStatus = 2
+		return []LineSegment{{Text: fmt.Sprintf("Ошибка: %s", err), Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}, 2
+	}
+
+	var segments []LineSegment
+	status := 0
+	for _, item := range items {
+		itemSegments, itemStatus := t.runListItem(item, status, capture, execWait)
+		segments = append(segments, itemSegments...)
+		status = itemStatus
+	}
+
+	return segments, status
+}
+
+// runListItem выполняет команду списка, если ее не нужно пропустить по коду status
+// предыдущей команды. Возвращает вывод команды и ее код, для пропущенной - status.
+// Вывод фоновой команды не направляется в capture
+func (t *Terminal) runListItem(item listItem, status int, capture *os.File, foreground execMode) ([]LineSegment, int) {
+	if skipListItem(item, status) {
+		return nil, status
+	}
+
+	log.Printf("📋 Команда списка (%s): %s", item.op, item.cmd)
+
+	// Раскрываем алиасы в каждой команде списка
+	mode := itemMode(item, foreground)
+	if mode == execBackground {
+		capture = nil
+	}
+	itemSegments, itemStatus := t.processCommandTo(t.expandAliases(item.cmd), capture, mode)
+
+	// Вывод подстановок $(...) появляется до вывода самой команды
+	segments := append(t.substitutionOutput, itemSegments...)
+	t.substitutionOutput = nil
+
+	// Код доступен следующим командам списка через $?
+	if itemStatus != statusPending {
+		t.lastStatus = itemStatus
+	}
+	return segments, itemStatus
+}
+
+// commandRun - выполняемая командная строка. Пока задание переднего плана или wait
+// не завершились, ее вывод показывается над предыдущим выводом
+type commandRun struct {
+	cmd       string
+	items     []listItem
+	pos       int // Следующая команда списка
+	status    int
+	segments  []LineSegment
+	noHistory bool // Команда запущена не из строки ввода и не записана в историю
+}
+
+// startCommandRun начинает выполнение командной строки
+func (t *Terminal) startCommandRun(cmd string) {
+	t.running = &commandRun{cmd: cmd}
+
+	items, err := splitCommandList(cmd)
+	if err != nil {
+		t.lastStatus = 2
+		t.running.segments = []LineSegment{{Text: fmt.Sprintf("Ошибка: %s", err), Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}
+		t.finishCommandRun()
+		return
+	}
+
+	t.running.items = items
+	t.continueCommandRun()
+}
+
+// startArgsRun запускает внешнюю команду с готовыми аргументами заданием переднего
+// плана, минуя разбор строки, ввод и историю. Так открываются ссылки в редакторе
+func (t *Terminal) startArgsRun(args []string) {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	cmd := strings.Join(quoted, " ")
+	log.Printf("🚀 Запуск без командной строки: %s", cmd)
+
+	t.running = &commandRun{cmd: cmd, noHistory: true}
+	segments, status := t.launchPipeline([]pipelineStage{{args: args, external: true}}, cmd, nil, execForeground)
+	t.running.segments = segments
+	if status != statusPending {
+		t.lastStatus = status
+		t.finishCommandRun()
+	}
+}
+
+// continueCommandRun выполняет команды списка, пока очередная команда не запустит
+// задание переднего плана. Выполнение продолжит resumeRun
+func (t *Terminal) continueCommandRun() {
+	run := t.running
+	for run.pos < len(run.items) {
+		item := run.items[run.pos]
+		run.pos++
+		segments, status := t.runListItem(item, run.status, nil, execForeground)
+		run.segments = append(run.segments, segments...)
+		if status == statusPending {
+			return
+		}
+		run.status = status
+	}
+
+	t.finishCommandRun()
+}
+
+// resumeRun продолжает командную строку после завершения или остановки
+// задания переднего плана либо окончания wait
+func (t *Terminal) resumeRun(status int) {
+	if t.running == nil {
+		return
+	}
+	t.running.status = status
+	t.lastStatus = status
+	t.continueCommandRun()
+}
+
+// finishCommandRun переносит вывод выполненной командной строки в общий вывод
+func (t *Terminal) finishCommandRun() {
+	run := t.running
+	t.running = nil
+
+	// Командная строка - последняя команда истории: запоминаем ее результат
+	if n := len(t.historyInfo); n > 0 && !run.noHistory {
+		t.historyInfo[n-1].status, t.historyInfo[n-1].done = t.lastStatus, true
+	}
+
+	// Маркер кода завершения рядом с эхом команды
+	block := []LineSegment{t.commandHeader(run.cmd), t.statusMarker()}
+
+	// Добавляем результат команды после самой команды, а старый вывод - после них
+	block = append(block, run.segments...)
+	t.outputLines = append(block, t.outputLines...)
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// completionMenuRows - сколько строк меню вариантов видно одновременно
+const completionMenuRows = 8
+
+// commandPrefixes - команды и ключевые слова, после которых снова идет имя команды
+var commandPrefixes = map[string]bool{
+	"sudo": true, "exec": true, "nohup": true, "time": true, "command": true, "xargs": true,
+	"if": true, "then": true, "else": true, "elif": true, "while": true, "until": true, "do": true, "!": true,
+}
+
+// completionWord - дополняемое слово перед курсором
+type completionWord struct {
+	start int      // Начало слова во вводе
+	text  string   // Слово без кавычек и экранирования
+	quote rune     // Незакрытая кавычка, в которой стоит курсор, или 0
+	words []string // Предыдущие слова команды без кавычек
+}
+
+// command проверяет, стоит ли слово на месте имени команды
+func (w completionWord) command() bool {
+	for _, word := range w.words {
+		if !commandPrefixes[word] {
+			return false
+		}
+	}
+	return true
+}
+
+// completionItem - вариант дополнения
+type completionItem struct {
+	text string // Слово целиком, без кавычек
+	dir  bool   // Каталог: после него не ставится пробел
+	path bool   // Путь к файлу
+	desc string // Пояснение в меню, например имя процесса для PID
+}
+
+// display возвращает вариант для меню: для путей - только имя файла
+func (item completionItem) display() string {
+	if !item.path {
+		if item.desc != "" {
+			return item.text + " (" + item.desc + ")"
+		}
+		return item.text
+	}
+	name := strings.TrimSuffix(item.text, "/")
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	if item.dir {
+		name += "/"
+	}
+	return name
+}
+
+// completionMenu - меню вариантов, когда дополнение неоднозначно
+type completionMenu struct {
+	active bool
+	items  []completionItem
+	index  int  // Подставленный вариант, -1 - ни один
+	start  int  // Начало дополняемого слова во вводе
+	quote  rune // Кавычка, открытая в начале слова
+}
+
+// wordBeforeCursor находит слово перед курсором и предыдущие слова его команды
+func (t *Terminal) wordBeforeCursor() completionWord {
+	input := string(t.inputBuffer[:t.cursorPos])
+	tokens, _ := lex(input)
+
+	w := completionWord{start: t.cursorPos}
+	if n := len(tokens); n > 0 && tokens[n-1].end == t.cursorPos && tokens[n-1].kind != tokenOperator && tokens[n-1].kind != tokenRedirect {
+		last := tokens[n-1]
+		tokens = tokens[:n-1]
+		w.start = last.start
+		w.text, w.quote = unquoteWord(last.text)
+	}
+
+	// Слова текущей команды: после последнего оператора, без присваиваний
+	// и целей перенаправлений
+	afterRedirect := false
+	for _, tok := range tokens {
+		switch {
+		case tok.kind == tokenOperator:
+			w.words = nil
+		case tok.kind == tokenRedirect:
+			afterRedirect = !strings.HasSuffix(tok.text, "&")
+			continue
+		case tok.kind == tokenWord && !afterRedirect:
+			text, _ := unquoteWord(tok.text)
+			w.words = append(w.words, text)
+		}
+		afterRedirect = false
+	}
+	return w
+}
+
+// unquoteWord убирает из слова кавычки и экранирование. Возвращает также
+// кавычку, которая осталась открытой в конце слова
+func unquoteWord(word string) (string, rune) {
+	var b strings.Builder
+	quote := rune(0)
+	runes := []rune(word)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'' && r == '\'', quote == '"' && r == '"':
+			quote = 0
+		case quote == '\'':
+			b.WriteRune(r)
+		case r == '\\' && i+1 < len(runes) && (quote == 0 || strings.ContainsRune("\"\\$`", runes[i+1])):
+			i++
+			b.WriteRune(runes[i])
+		case quote == 0 && (r == '\'' || r == '"'):
+			quote = r
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String(), quote
+}
+
+// quoteCompletion экранирует вариант дополнения для вставки в ввод. Внутри
+// открытой кавычки экранируется только то, что в ней особое; ~ в начале пути
+// остается как есть, чтобы shell его раскрыл
+func quoteCompletion(text string, quote rune) string {
+	switch quote {
+	case '\'':
+		return strings.ReplaceAll(text, "'", `'\''`)
+	case '"':
+		var b strings.Builder
+		for _, r := range text {
+			if strings.ContainsRune("\"\\$`", r) {
+				b.WriteRune('\\')
+			}
+			b.WriteRune(r)
+		}
+		return b.String()
+	}
+
+	var b strings.Builder
+	for i, r := range text {
+		if strings.ContainsRune(" \t'\"\\$&|;()<>*?[]{}#!`", r) || r == '~' && i > 0 {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// completeWord возвращает варианты дополнения слова: на месте имени команды -
+// встроенные команды, алиасы и программы из $PATH, для аргументов - варианты
+// поставщика дополнения команды, иначе - пути к файлам
+func (t *Terminal) completeWord(w completionWord) []completionItem {
+	if w.command() && !strings.Contains(w.text, "/") {
+		return t.completeCommandName(w.text)
+	}
+	if !w.command() {
+		if items, ok := t.completeArgument(w, true); ok {
+			return items
+		}
+	}
+	return t.completePath(w.text, w.command())
+}
+
+// completeCommandName дополняет имя команды
+func (t *Terminal) completeCommandName(prefix string) []completionItem {
+	seen := make(map[string]bool)
+	var items []completionItem
+	add := func(name string) {
+		if strings.HasPrefix(name, prefix) && !seen[name] {
+			seen[name] = true
+			items = append(items, completionItem{text: name})
+		}
+	}
+
+	for name := range builtinCommands {
+		add(name)
+	}
+	for name := range t.aliases {
+		add(name)
+	}
+	path, _ := t.lookupVar("PATH")
+	for _, dir := range filepath.SplitList(path) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if !strings.HasPrefix(entry.Name(), prefix) || seen[entry.Name()] {
+				continue
+			}
+			if info, err := os.Stat(filepath.Join(dir, entry.Name())); err == nil && !info.IsDir() && info.Mode()&0111 != 0 {
+				add(entry.Name())
+			}
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool { return items[i].text < items[j].text })
+	return items
+}
+
+// completePath дополняет путь. Скрытые файлы предлагаются, только если имя
+// начинается с '.'. Для имени команды (executables) подходят каталоги и исполняемые файлы
+func (t *Terminal) completePath(prefix string, executables bool) []completionItem {
+	dirPart, base := "", prefix
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		dirPart, base = prefix[:i+1], prefix[i+1:]
+	}
+
+	dir := dirPart
+	if dir == "" {
+		dir = "."
+	} else if rest, ok := strings.CutPrefix(dir, "~"); ok && (rest == "" || rest[0] == '/') {
+		home, _ := os.UserHomeDir()
+		dir = home + rest
+	}
+	if prefix == "~" {
+		// ~ дополняется до домашнего каталога
+		return []completionItem{{text: "~/", dir: true, path: true}}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var items []completionItem
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, base) || strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".") {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		if info.IsDir() {
+			items = append(items, completionItem{text: dirPart + name + "/", dir: true, path: true})
+		} else if !executables || info.Mode()&0111 != 0 {
+			items = append(items, completionItem{text: dirPart + name, path: true})
+		}
+	}
+	return items
+}
+
+// commonPrefix возвращает общее начало вариантов
+func commonPrefix(items []completionItem) string {
+	prefix := []rune(items[0].text)
+	for _, item := range items[1:] {
+		text := []rune(item.text)
+		n := 0
+		for n < len(prefix) && n < len(text) && prefix[n] == text[n] {
+			n++
+		}
+		prefix = prefix[:n]
+	}
+	return string(prefix)
+}
+
+// replaceWord заменяет ввод от start до курсора текстом
+func (t *Terminal) replaceWord(start int, text string) {
+	rest := append([]rune(text), t.inputBuffer[t.cursorPos:]...)
+	t.inputBuffer = append(t.inputBuffer[:start], rest...)
+	t.cursorPos = start + len([]rune(text))
+}
+
+// completeAtCursor дополняет слово перед курсором. Единственный вариант
+// подставляется целиком, из нескольких - их общее начало, а если оно не длиннее
+// слова, открывается меню. Возвращает false, если вариантов нет
+func (t *Terminal) completeAtCursor() bool {
+	w := t.wordBeforeCursor()
+	items := t.completeWord(w)
+	if len(items) == 0 {
+		return false
+	}
+
+	t.beginEdit(editOther)
+	if len(items) == 1 {
+		t.insertCompletion(w.start, items[0], w.quote, true)
+	} else if prefix := commonPrefix(items); len(prefix) > len(w.text) {
+		t.insertCompletion(w.start, completionItem{text: prefix, dir: true}, w.quote, false)
+	} else {
+		t.menu = completionMenu{active: true, items: items, index: -1, start: w.start, quote: w.quote}
+	}
+	t.updateCompletionSuggestion()
+	return true
+}
+
+// insertCompletion подставляет вариант вместо слова. Законченное слово (final)
+// закрывается кавычкой и пробелом, если это не каталог
+func (t *Terminal) insertCompletion(start int, item completionItem, quote rune, final bool) {
+	text := quoteCompletion(item.text, quote)
+	if quote != 0 {
+		text = string(quote) + text
+	}
+	if final && !item.dir {
+		if quote != 0 {
+			text += string(quote)
+		}
+		if t.cursorPos == len(t.inputBuffer) || t.inputBuffer[t.cursorPos] != ' ' {
+			text += " "
+		}
+	}
+	t.replaceWord(start, text)
+}
+
+// handleMenuKey обрабатывает клавишу при открытом меню: Tab и Shift+Tab
+// подставляют следующий и предыдущий вариант, Enter и Esc закрывают меню.
+// Другие клавиши закрывают меню и обрабатываются как обычно - для них
+// возвращается false
+func (t *Terminal) handleMenuKey(ev *tcell.EventKey) bool {
+	m := &t.menu
+	switch ev.Key() {
+	case tcell.KeyTab, tcell.KeyBacktab:
+		if ev.Key() == tcell.KeyTab {
+			m.index = (m.index + 1) % len(m.items)
+		} else {
+			m.index = (max(m.index, 0) - 1 + len(m.items)) % len(m.items)
+		}
+		t.beginEdit(editOther)
+		t.insertCompletion(m.start, m.items[m.index], m.quote, false)
+		t.updateCompletionSuggestion()
+		return true
+	case tcell.KeyEnter:
+		// Enter выбирает подставленный вариант, а без него выполняет команду
+		m.active = false
+		if m.index < 0 {
+			return false
+		}
+		t.insertCompletion(m.start, m.items[m.index], m.quote, true)
+		return true
+	case tcell.KeyEscape:
+		m.active = false
+		return true
+	}
+	m.active = false
+	return false
+}
+
+// drawCompletionMenu рисует варианты дополнения столбцами под строкой ввода.
+// Возвращает число занятых строк
+func (t *Terminal) drawCompletionMenu(x, y, width int) int {
+	m := &t.menu
+	colWidth := 0
+	for _, item := range m.items {
+		colWidth = max(colWidth, len([]rune(item.display()))+2)
+	}
+	colWidth = min(colWidth, max(1, width))
+	cols := max(1, width/colWidth)
+	rows := (len(m.items) + cols - 1) / cols
+
+	// Если строк больше, чем помещается, показывается окно со строкой выбранного варианта
+	first := 0
+	if rows > completionMenuRows && m.index >= 0 {
+		first = min(m.index/cols, rows-completionMenuRows)
+	}
+	shown := min(rows, completionMenuRows)
+
+	for row := 0; row < shown; row++ {
+		for col := 0; col < cols; col++ {
+			i := (first+row)*cols + col
+			if i >= len(m.items) {
+				break
+			}
+			item := m.items[i]
+			style := tcell.StyleDefault.Foreground(tcell.ColorWhite)
+			if item.dir {
+				style = tcell.StyleDefault.Foreground(tcell.ColorBlue).Bold(true)
+			}
+			if i == m.index {
+				style = style.Reverse(true)
+			}
+			text := []rune(item.display())
+			t.drawText(x+col*colWidth, y+row, string(text[:min(len(text), colWidth-1)]), style)
+		}
+	}
+	if shown < rows {
+		more := fmt.Sprintf("… ещё строк: %d", rows-shown)
+		t.drawText(x, y+shown, more, tcell.StyleDefault.Foreground(tcell.ColorGray))
+		shown++
+	}
+	return shown
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// bashCompletionHelper загружает скрипт дополнения bash и вызывает его функцию
+// так, как это делает bash по Tab, затем печатает COMPREPLY по варианту на строке.
+// Аргументы: имя команды, файл скрипта и слова команды, последнее - дополняемое
+const bashCompletionHelper = `cmd=$1 script=$2; shift 2
+for f in /usr/share/bash-completion/bash_completion /etc/bash_completion; do
+	[ -r "$f" ] && { . "$f"; break; }
+done >/dev/null 2>&1
+. "$script" >/dev/null 2>&1
+spec=$(complete -p "$cmd" 2>/dev/null) || exit 0
+COMP_WORDS=("$@"); COMP_CWORD=$(($# - 1))
+COMP_LINE="$*"; COMP_POINT=${#COMP_LINE}; COMP_TYPE=9; COMP_KEY=9
+cur=${COMP_WORDS[COMP_CWORD]}
+case $spec in
+*" -F "*)
+	func=${spec##* -F }; func=${func%% *}
+	"$func" "$cmd" "$cur" "${COMP_WORDS[COMP_CWORD-1]}" >/dev/null 2>&1 ;;
+*)
+	spec=${spec#complete }; spec=${spec% *}
+	eval "COMPREPLY=(\$(compgen $spec -- \"\$cur\"))" 2>/dev/null ;;
+esac
+printf '%s\n' "${COMPREPLY[@]}"`
+
+// importCompletion ищет для команды скрипт дополнения bash, а без него -
+// определения complete -c для fish
+func importCompletion(name string) (completionProvider, bool) {
+	if strings.ContainsAny(name, "/ ") || name == "" {
+		return completionProvider{}, false
+	}
+	home, _ := os.UserHomeDir()
+
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	bashDirs := []string{
+		filepath.Join(dataHome, "bash-completion", "completions"),
+		"/usr/local/share/bash-completion/completions",
+		"/usr/share/bash-completion/completions",
+		"/etc/bash_completion.d",
+	}
+	for _, dir := range bashDirs {
+		for _, file := range []string{name, name + ".bash", "_" + name} {
+			script := filepath.Join(dir, file)
+			if info, err := os.Stat(script); err == nil && !info.IsDir() {
+				return completionProvider{fn: bashCompletion(script), source: "bash: " + script, tabOnly: true}, true
+			}
+		}
+	}
+
+	fishDirs := []string{
+		filepath.Join(home, ".config", "fish", "completions"),
+		"/etc/fish/completions",
+		"/usr/local/share/fish/vendor_completions.d",
+		"/usr/share/fish/vendor_completions.d",
+		"/usr/share/fish/completions",
+	}
+	for _, dir := range fishDirs {
+		file := filepath.Join(dir, name+".fish")
+		if specs := loadFishCompletions(file, name); len(specs) > 0 {
+			return completionProvider{fn: fishCompletion(specs), source: "fish: " + file, tabOnly: true}, true
+		}
+	}
+	return completionProvider{}, false
+}
+
+// bashCompletion возвращает поставщик, вызывающий скрипт дополнения bash во
+// вспомогательном процессе bash. Пустой COMPREPLY - дополняются пути, как с -o default
+func bashCompletion(script string) func(t *Terminal, args []string, word string) ([]completionItem, bool) {
+	return func(t *Terminal, args []string, word string) ([]completionItem, bool) {
+		helperArgs := append([]string{"-c", bashCompletionHelper, "bash", args[0], script}, args...)
+		var items []completionItem
+		for _, text := range t.commandLines(nil, "bash", append(helperArgs, word)...) {
+			text = strings.TrimRight(text, " ")
+			// С -o filenames bash сам дописывает '/' к каталогам
+			if info, err := os.Stat(text); err == nil && info.IsDir() && !strings.HasSuffix(text, "/") {
+				text += "/"
+			}
+			items = append(items, completionItem{text: text, dir: strings.HasSuffix(text, "/")})
+		}
+		return items, len(items) > 0
+	}
+}
+
+// fishSpec - одно определение complete -c из файла дополнений fish
+type fishSpec struct {
+	short     []string // -s: ключи вида -x
+	long      []string // -l: ключи вида --name
+	old       []string // -o: ключи вида -name
+	arguments []string // -a: варианты аргументов, "вариант\tописание"
+	desc      string   // -d
+	condition string   // -n: условие, при котором определение действует
+	noFiles   bool     // -f или -x: пути не предлагаются
+	value     bool     // -r или -x: у ключа есть значение, -a - его варианты
+}
+
+// loadFishCompletions читает определения complete -c для команды name
+func loadFishCompletions(file, name string) []fishSpec {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var specs []fishSpec
+	var line string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Строки, оканчивающиеся на '\', продолжаются на следующей
+		line += strings.TrimSpace(scanner.Text())
+		if strings.HasSuffix(line, "\\") {
+			line = strings.TrimSuffix(line, "\\") + " "
+			continue
+		}
+		words := fishWords(line)
+		line = ""
+		if len(words) < 2 || words[0] != "complete" {
+			continue
+		}
+		if spec, command := parseFishComplete(words[1:]); command == name {
+			specs = append(specs, spec)
+		}
+	}
+	return specs
+}
+
+// fishValueFlags - длинные ключи complete, принимающие значение
+var fishValueFlags = map[string]bool{
+	"--command": true, "--short-option": true, "--long-option": true, "--old-option": true,
+	"--arguments": true, "--description": true, "--condition": true, "--wraps": true, "--path": true,
+}
+
+// parseFishComplete разбирает ключи complete. Возвращает определение и команду (-c)
+func parseFishComplete(words []string) (fishSpec, string) {
+	// Короткие ключи разделяются: -xa 'a b' - то же, что -x -a 'a b', -sh - то же, что -s h
+	var flags []string
+	needValue := false // Следующее слово - значение ключа, а не ключи
+	for _, word := range words {
+		if needValue || len(word) <= 2 || word[0] != '-' || word[1] == '-' {
+			flags = append(flags, word)
+			needValue = !needValue && (fishValueFlags[word] || len(word) == 2 && strings.IndexByte("csloadnwp", word[1]) >= 0)
+			continue
+		}
+		for j := 1; j < len(word); j++ {
+			flags = append(flags, "-"+word[j:j+1])
+			if strings.IndexByte("csloadnwp", word[j]) >= 0 {
+				if j+1 < len(word) {
+					flags = append(flags, word[j+1:])
+				} else {
+					needValue = true
+				}
+				break
+			}
+		}
+	}
+
+	var spec fishSpec
+	command := ""
+	for i := 0; i < len(flags); i++ {
+		flag, value, hasValue := strings.Cut(flags[i], "=")
+		if !strings.HasPrefix(flag, "--") {
+			flag, hasValue = flags[i], false
+		}
+		next := func() string {
+			if hasValue {
+				return value
+			}
+			if i+1 < len(flags) {
+				i++
+				return flags[i]
+			}
+			return ""
+		}
+
+		switch flag {
+		case "-c", "--command":
+			command = next()
+		case "-s", "--short-option":
+			spec.short = append(spec.short, "-"+next())
+		case "-l", "--long-option":
+			spec.long = append(spec.long, "--"+next())
+		case "-o", "--old-option":
+			spec.old = append(spec.old, "-"+next())
+		case "-a", "--arguments":
+			for _, arg := range fishWords(next()) {
+				// Подстановки команд и переменных fish не выполняются
+				if !strings.ContainsAny(arg, "($") {
+					spec.arguments = append(spec.arguments, arg)
+				}
+			}
+		case "-d", "--description":
+			spec.desc = next()
+		case "-n", "--condition":
+			spec.condition = next()
+		case "-f", "--no-files":
+			spec.noFiles = true
+		case "-r", "--require-parameter":
+			spec.value = true
+		case "-x", "--exclusive":
+			spec.noFiles, spec.value = true, true
+		case "-w", "--wraps", "-p", "--path":
+			next()
+		}
+	}
+	return spec, command
+}
+
+// fishWords разбивает строку fish на слова, убирая кавычки и экранирование.
+// Подстановки (...) остаются внутри слова
+func fishWords(line string) []string {
+	var words []string
+	var b strings.Builder
+	inWord := false
+	quote := rune(0)
+	depth := 0
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == '\'' && r == '\\' && i+1 < len(runes) && (runes[i+1] == '\'' || runes[i+1] == '\\'):
+			i++
+			b.WriteRune(runes[i])
+		case quote == '"' && r == '\\' && i+1 < len(runes) && strings.ContainsRune("\"\\$", runes[i+1]):
+			i++
+			b.WriteRune(runes[i])
+		case quote != 0:
+			b.WriteRune(r)
+		case r == '\\' && i+1 < len(runes):
+			i++
+			if runes[i] == 't' {
+				b.WriteRune('\t')
+			} else {
+				b.WriteRune(runes[i])
+			}
+			inWord = true
+		case r == '#' && !inWord && depth == 0:
+			return words
+		case r == ';' && depth == 0:
+			// Остаток строки - другая команда
+			if inWord {
+				words = append(words, b.String())
+			}
+			return words
+		case (r == ' ' || r == '\t') && depth == 0:
+			if inWord {
+				words = append(words, b.String())
+				b.Reset()
+				inWord = false
+			}
+		default:
+			if r == '(' {
+				depth++
+			} else if r == ')' && depth > 0 {
+				depth--
+			}
+			if r == '\'' || r == '"' {
+				quote = r
+			} else {
+				b.WriteRune(r)
+			}
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, b.String())
+	}
+	return words
+}
+
+// fishCompletion возвращает поставщик по определениям fish: после ключа со
+// значением - варианты значения, после '-' - ключи с описаниями, иначе - варианты
+// аргументов, чьи условия выполнены
+func fishCompletion(specs []fishSpec) func(t *Terminal, args []string, word string) ([]completionItem, bool) {
+	return func(t *Terminal, args []string, word string) ([]completionItem, bool) {
+		var items []completionItem
+		prev := args[len(args)-1]
+		for _, spec := range specs {
+			if match, _ := fishCondition(spec.condition, args); spec.value && match && slices.Contains(slices.Concat(spec.long, spec.short, spec.old), prev) {
+				for _, arg := range spec.arguments {
+					text, desc, _ := strings.Cut(arg, "\t")
+					items = append(items, completionItem{text: text, desc: desc})
+				}
+				if !spec.noFiles {
+					items = append(items, t.completePath(word, false)...)
+				}
+				return items, true
+			}
+		}
+
+		noFiles := false
+		unknown := false // Пропущено определение с непонятным условием
+		for _, spec := range specs {
+			match, known := fishCondition(spec.condition, args)
+			unknown = unknown || !known
+			if !match {
+				continue
+			}
+			if strings.HasPrefix(word, "-") {
+				for _, options := range [][]string{spec.long, spec.short, spec.old} {
+					for _, option := range options {
+						items = append(items, completionItem{text: option, desc: spec.desc})
+					}
+				}
+				continue
+			}
+			// Определение без ключей описывает аргументы команды
+			if len(spec.short)+len(spec.long)+len(spec.old) == 0 {
+				noFiles = noFiles || spec.noFiles
+				for _, arg := range spec.arguments {
+					text, desc, found := strings.Cut(arg, "\t")
+					if !found {
+						desc = spec.desc
+					}
+					items = append(items, completionItem{text: text, desc: desc})
+				}
+			}
+		}
+		if strings.HasPrefix(word, "-") {
+			return items, len(items) > 0
+		}
+		if unknown {
+			// Варианты пропущенного определения неизвестны - пути остаются в списке
+			noFiles = false
+		}
+		if len(items) == 0 && !noFiles {
+			return nil, false
+		}
+		if !noFiles {
+			items = append(items, t.completePath(word, false)...)
+		}
+		return items, true
+	}
+}
+
+// fishCondition проверяет условие -n. Понятны проверки подкоманд из функций
+// fish, соединенные "; and" или "&&". Другие условия требуют запуска fish:
+// для них known = false, и определение не действует
+func fishCondition(condition string, args []string) (match, known bool) {
+	if condition == "" {
+		return true, true
+	}
+	var subcommands []string
+	for _, arg := range args[1:] {
+		if !strings.HasPrefix(arg, "-") {
+			subcommands = append(subcommands, arg)
+		}
+	}
+
+	condition = strings.ReplaceAll(condition, "&&", ";")
+	for _, part := range strings.Split(condition, ";") {
+		words := fishWords(part)
+		if len(words) > 0 && words[0] == "and" {
+			words = words[1:]
+		}
+		negate := len(words) > 0 && words[0] == "not"
+		if negate {
+			words = words[1:]
+		}
+		if len(words) == 0 {
+			continue
+		}
+
+		var result bool
+		switch words[0] {
+		case "__fish_use_subcommand", "__fish_is_first_arg", "__fish_is_first_token":
+			result = len(subcommands) == 0
+		case "__fish_seen_subcommand_from":
+			for _, sub := range subcommands {
+				for _, name := range words[1:] {
+					result = result || sub == name
+				}
+			}
+		default:
+			return false, false
+		}
+		if result == negate {
+			return false, true
+		}
+	}
+	return true, true
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseFishComplete(t *testing.T) {
+	tests := []struct {
+		name    string
+		words   []string
+		command string
+		spec    fishSpec
+	}{
+		{"-xa", []string{"-c", "git", "-n", "__fish_use_subcommand", "-xa", "status commit"},
+			"git", fishSpec{arguments: []string{"status", "commit"}, condition: "__fish_use_subcommand", noFiles: true, value: true}},
+		{"-sh", []string{"-c", "ls", "-sh", "-l", "human-readable", "-d", "Размеры"},
+			"ls", fishSpec{short: []string{"-h"}, long: []string{"--human-readable"}, desc: "Размеры"}},
+		{"-fc", []string{"-fc", "tar", "-a", `x\tИзвлечь c`},
+			"tar", fishSpec{arguments: []string{"x\tИзвлечь", "c"}, noFiles: true}},
+		{"длинные ключи со значением", []string{"--command=make", "--long-option=jobs", "--require-parameter", "--description", "Число заданий"},
+			"make", fishSpec{long: []string{"--jobs"}, desc: "Число заданий", value: true}},
+		{"значение ключа начинается с '-'", []string{"-c", "grep", "-s", "E", "-d", "-E как egrep"},
+			"grep", fishSpec{short: []string{"-E"}, desc: "-E как egrep"}},
+		{"-o", []string{"-c", "find", "-o", "name", "-r"},
+			"find", fishSpec{old: []string{"-name"}, value: true}},
+		{"подстановки в -a пропускаются", []string{"-c", "kill", "-a", "(__fish_complete_pids) $sig HUP"},
+			"kill", fishSpec{arguments: []string{"HUP"}}},
+		{"-w пропускается", []string{"-c", "hub", "-w", "git"}, "hub", fishSpec{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, command := parseFishComplete(tt.words)
+			if command != tt.command || !reflect.DeepEqual(spec, tt.spec) {
+				t.Errorf("%q: %q %+v, ожидалось %q %+v", tt.words, command, spec, tt.command, tt.spec)
+			}
+		})
+	}
+}
+
+func TestFishWords(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"complete -c ls", []string{"complete", "-c", "ls"}},
+		{"  a\t b  ", []string{"a", "b"}},
+		{`'a b' "c d"`, []string{"a b", "c d"}},
+		{`'it\'s' '\\' '\n'`, []string{"it's", `\`, `\n`}},
+		{`"q\"q" "\$x" "\n"`, []string{`q"q`, "$x", `\n`}},
+		{`a\ b c\td`, []string{"a b", "c\td"}},
+		{"a # комментарий", []string{"a"}},
+		{"a#b", []string{"a#b"}},
+		{"a; b", []string{"a"}},
+		{"(cmd a; b) c", []string{"(cmd a; b)", "c"}},
+		{"x(y z)w", []string{"x(y z)w"}},
+		{`'незакрытая`, []string{"незакрытая"}},
+	}
+	for _, tt := range tests {
+		if got := fishWords(tt.line); !slices.Equal(got, tt.want) {
+			t.Errorf("fishWords(%q) = %q, ожидалось %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestFishCondition(t *testing.T) {
+	tests := []struct {
+		condition    string
+		args         []string
+		match, known bool
+	}{
+		{"", []string{"git"}, true, true},
+		{"__fish_use_subcommand", []string{"git"}, true, true},
+		{"__fish_use_subcommand", []string{"git", "-C", "commit"}, false, true},
+		{"__fish_use_subcommand", []string{"git", "--bare"}, true, true},
+		{"__fish_seen_subcommand_from commit push", []string{"git", "push"}, true, true},
+		{"__fish_seen_subcommand_from commit push", []string{"git", "pull"}, false, true},
+		{"not __fish_seen_subcommand_from add", []string{"git", "pull"}, true, true},
+		{"__fish_seen_subcommand_from remote; and not __fish_seen_subcommand_from add", []string{"git", "remote"}, true, true},
+		{"__fish_seen_subcommand_from remote && not __fish_seen_subcommand_from add", []string{"git", "remote", "add"}, false, true},
+		{"__fish_is_first_arg", []string{"systemctl"}, true, true},
+		{"__fish_git_using_command log", []string{"git", "log"}, false, false},
+		{"__fish_use_subcommand; and test -d .git", []string{"git"}, false, false},
+		// Уже ложное условие остается известным
+		{"__fish_seen_subcommand_from log; and __fish_git_custom", []string{"git"}, false, true},
+	}
+	for _, tt := range tests {
+		if match, known := fishCondition(tt.condition, tt.args); match != tt.match || known != tt.known {
+			t.Errorf("fishCondition(%q, %q) = %v %v, ожидалось %v %v", tt.condition, tt.args, match, known, tt.match, tt.known)
+		}
+	}
+}
+
+func TestFishCompletion(t *testing.T) {
+	dir := t.TempDir()
+	makeTree(t, dir, "file.txt")
+	chdir(t, dir)
+	term := newTestTerminal()
+
+	specs := []fishSpec{
+		{arguments: []string{"start\tЗапустить", "stop"}, condition: "__fish_use_subcommand", noFiles: true},
+		{short: []string{"-u"}, long: []string{"--unit"}, desc: "Юнит", value: true, noFiles: true, arguments: []string{"sshd"}},
+	}
+	texts := func(items []completionItem) []string {
+		var result []string
+		for _, item := range items {
+			result = append(result, item.text)
+		}
+		return result
+	}
+
+	complete := fishCompletion(specs)
+	if items, ok := complete(term, []string{"svc"}, ""); !ok || !slices.Equal(texts(items), []string{"start", "stop"}) {
+		t.Errorf("подкоманды: %v %q", ok, texts(items))
+	}
+	if items, ok := complete(term, []string{"svc", "start", "--unit"}, ""); !ok || !slices.Equal(texts(items), []string{"sshd"}) {
+		t.Errorf("значение ключа: %v %q", ok, texts(items))
+	}
+	if items, ok := complete(term, []string{"svc"}, "-"); !ok || !slices.Equal(texts(items), []string{"--unit", "-u"}) {
+		t.Errorf("ключи: %v %q", ok, texts(items))
+	}
+
+	// Определение с непонятным условием пропускается, но пути остаются в списке
+	specs = append(specs, fishSpec{arguments: []string{"reload"}, condition: "__fish_svc_custom", noFiles: true})
+	complete = fishCompletion(specs)
+	if items, ok := complete(term, []string{"svc"}, ""); !ok || !slices.Equal(texts(items), []string{"start", "stop", "file.txt"}) {
+		t.Errorf("непонятное условие: %v %q", ok, texts(items))
+	}
+}
+
+func TestLookupCompletionCachesMiss(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_DATA_HOME", filepath.Join(home, "data"))
+	term := newTestTerminal()
+
+	const name = "termgo-test-tool"
+	if _, ok := term.lookupCompletion(name); ok {
+		t.Fatalf("%s: дополнение найдено", name)
+	}
+	if provider, cached := term.completions[name]; !cached || provider.source != noCompletionSource {
+		t.Fatalf("%s: отсутствие дополнения не запомнено: %+v", name, provider)
+	}
+
+	// Повторный поиск не обращается к файлам: появившееся дополнение не видно
+	fishDir := filepath.Join(home, ".config", "fish", "completions")
+	if err := os.MkdirAll(fishDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(fishDir, name+".fish"), []byte("complete -c "+name+" -a 'one two'\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := term.lookupCompletion(name); ok {
+		t.Errorf("%s: запомненное отсутствие дополнения не использовано", name)
+	}
+
+	// Запись об отсутствии не показывается в complete
+	segments, _ := term.processCompleteCommand([]string{"complete"})
+	for _, segment := range segments {
+		if strings.HasPrefix(segment.Text, name) {
+			t.Errorf("complete показывает %q", segment.Text)
+		}
+	}
+
+	// Импортированное дополнение fish вызывается только по Tab
+	delete(term.completions, name)
+	provider, ok := term.lookupCompletion(name)
+	if !ok || !provider.tabOnly {
+		t.Errorf("%s: %v %+v", name, ok, provider)
+	}
+}
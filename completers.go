@@ -0,0 +1,507 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// completionTimeout - сколько ждать вывода команды, дающей варианты дополнения
+const completionTimeout = time.Second
+
+// noCompletionSource - источник записи о команде, для которой не нашлось
+// дополнения bash или fish. Такая запись не показывается в complete
+const noCompletionSource = "не найдено"
+
+// completionProvider дополняет аргументы команды. Встроенные поставщики написаны
+// на Go, внешние (complete -C) - команды, печатающие варианты по одному на строке
+type completionProvider struct {
+	fn      func(t *Terminal, args []string, word string) ([]completionItem, bool)
+	command string // Внешняя команда
+	source  string // Файл, из которого импортировано дополнение bash или fish
+	tabOnly bool   // Слишком медленно для подсказки при каждом нажатии, только по Tab
+}
+
+// complete возвращает варианты для слова word; args - предыдущие слова команды,
+// args[0] - ее имя. false - поставщик не знает этот аргумент, дополняются пути
+func (p completionProvider) complete(t *Terminal, args []string, word string) ([]completionItem, bool) {
+	if p.fn != nil {
+		return p.fn(t, args, word)
+	}
+	if p.command == "" {
+		// complete -r: дополняются только пути
+		return nil, false
+	}
+
+	// Как complete -C в bash: команде передаются имя команды, слово и предыдущее слово
+	line := strings.Join(append(append([]string(nil), args...), word), " ")
+	env := append(t.environ(), "COMP_LINE="+line, "COMP_POINT="+strconv.Itoa(len(line)))
+	var items []completionItem
+	for _, text := range t.commandLines(env, "sh", "-c", p.command+` "$@"`, "sh", args[0], word, args[len(args)-1]) {
+		// Вариант с '/' в конце - каталог, после него не ставится пробел
+		items = append(items, completionItem{text: text, dir: strings.HasSuffix(text, "/")})
+	}
+	return items, true
+}
+
+// defaultCompletions возвращает встроенные поставщики дополнения
+func defaultCompletions() map[string]completionProvider {
+	return map[string]completionProvider{
+		// git запускает процесс, go обходит дерево каталогов, kill читает весь /proc:
+		// на каждое нажатие клавиши это слишком долго
+		"git":  {fn: completeGit, tabOnly: true},
+		"go":   {fn: completeGo, tabOnly: true},
+		"make": {fn: completeMake},
+		"ssh":  {fn: completeSSH},
+		"kill": {fn: completeKill, tabOnly: true},
+		"cd":   {fn: completeCd},
+	}
+}
+
+// commandArgs возвращает слова команды без sudo, exec и т.п. перед ее именем
+func (w completionWord) commandArgs() []string {
+	for i, word := range w.words {
+		if !commandPrefixes[word] {
+			return w.words[i:]
+		}
+	}
+	return nil
+}
+
+// lookupCompletion возвращает поставщик дополнения команды. Если он не
+// зарегистрирован, импортируется дополнение bash или fish и запоминается.
+// Отсутствие дополнения тоже запоминается: поиск файлов не повторяется
+// при каждом нажатии клавиши
+func (t *Terminal) lookupCompletion(name string) (completionProvider, bool) {
+	if provider, ok := t.completions[name]; ok {
+		return provider, provider.source != noCompletionSource
+	}
+	provider, ok := importCompletion(name)
+	if ok {
+		log.Printf("📥 Импортировано дополнение для %s: %s", name, provider.source)
+		t.completions[name] = provider
+	} else {
+		t.completions[name] = completionProvider{source: noCompletionSource}
+	}
+	return provider, ok
+}
+
+// completeArgument дополняет аргумент команды поставщиком, зарегистрированным
+// для ее имени. Для алиаса используется поставщик команды, в которую он раскрывается.
+// Без tab медленные поставщики не вызываются
+func (t *Terminal) completeArgument(w completionWord, tab bool) ([]completionItem, bool) {
+	args := w.commandArgs()
+	if len(args) == 0 {
+		return nil, false
+	}
+	provider, ok := t.lookupCompletion(args[0])
+	if alias, exists := t.aliases[args[0]]; !ok && exists {
+		if fields := strings.Fields(alias); len(fields) > 0 {
+			args = append(fields, args[1:]...)
+			provider, ok = t.lookupCompletion(fields[0])
+		}
+	}
+	if !ok || provider.tabOnly && !tab {
+		return nil, false
+	}
+
+	candidates, handled := provider.complete(t, args, w.text)
+	if !handled {
+		return nil, false
+	}
+	var items []completionItem
+	seen := make(map[string]bool)
+	for _, item := range candidates {
+		if strings.HasPrefix(item.text, w.text) && !seen[item.text] {
+			seen[item.text] = true
+			items = append(items, item)
+		}
+	}
+	return items, true
+}
+
+// argumentSuggestion возвращает серую подсказку от поставщика дополнения для
+// аргумента в конце ввода: остаток единственного варианта или общего начала вариантов
+func (t *Terminal) argumentSuggestion() string {
+	if t.cursorPos != len(t.inputBuffer) {
+		return ""
+	}
+	w := t.wordBeforeCursor()
+	if w.command() || w.text == "" || w.quote != 0 {
+		return ""
+	}
+	items, _ := t.completeArgument(w, false)
+	if len(items) == 0 {
+		return ""
+	}
+
+	text := commonPrefix(items)
+	if quoteCompletion(text, 0) != text || string(t.inputBuffer[w.start:]) != w.text {
+		// Подсказка дописывается к вводу как есть, поэтому экранирование не поддерживается
+		return ""
+	}
+	if len(items) == 1 && !items[0].dir {
+		text += " "
+	}
+	return text[len(w.text):]
+}
+
+// commandLines выполняет команду и возвращает непустые строки ее вывода.
+// Команда, не успевшая за completionTimeout, завершается
+func (t *Terminal) commandLines(env []string, name string, args ...string) []string {
+	ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = env
+	if env == nil {
+		cmd.Env = t.environ()
+	}
+	out, err := cmd.Output()
+	if err != nil && len(out) == 0 {
+		return nil
+	}
+	var lines []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimRight(line, "\r"); strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// wordItems превращает слова в варианты дополнения
+func wordItems(words ...string) []completionItem {
+	items := make([]completionItem, len(words))
+	for i, word := range words {
+		items[i] = completionItem{text: word}
+	}
+	return items
+}
+
+// positional возвращает аргументы после подкоманды args[1], кроме ключей
+func positional(args []string) []string {
+	var rest []string
+	for _, arg := range args[min(2, len(args)):] {
+		if !strings.HasPrefix(arg, "-") {
+			rest = append(rest, arg)
+		}
+	}
+	return rest
+}
+
+// gitSubcommands - подкоманды git, предлагаемые первым аргументом
+var gitSubcommands = []string{
+	"add", "am", "archive", "bisect", "blame", "branch", "checkout", "cherry-pick", "clean",
+	"clone", "commit", "config", "describe", "diff", "fetch", "format-patch", "grep", "init",
+	"log", "merge", "mv", "notes", "pull", "push", "rebase", "reflog", "remote", "reset",
+	"restore", "revert", "rm", "shortlog", "show", "stash", "status", "submodule", "switch",
+	"tag", "worktree",
+}
+
+// completeGit дополняет подкоманды и алиасы git, ветки, теги и удаленные репозитории
+func completeGit(t *Terminal, args []string, word string) ([]completionItem, bool) {
+	if strings.HasPrefix(word, "-") {
+		return nil, false
+	}
+	if len(args) == 1 {
+		items := wordItems(gitSubcommands...)
+		for _, line := range t.commandLines(nil, "git", "config", "--get-regexp", `^alias\.`) {
+			name, _, _ := strings.Cut(strings.TrimPrefix(line, "alias."), " ")
+			items = append(items, completionItem{text: name})
+		}
+		return items, true
+	}
+
+	refs := func(patterns ...string) []completionItem {
+		return wordItems(t.commandLines(nil, "git", append([]string{"for-each-ref", "--format=%(refname:short)"}, patterns...)...)...)
+	}
+	remotes := func() []completionItem {
+		return wordItems(t.commandLines(nil, "git", "remote")...)
+	}
+
+	switch args[1] {
+	case "switch", "merge", "rebase", "branch", "cherry-pick":
+		return refs("refs/heads", "refs/remotes", "refs/tags"), true
+	case "checkout", "diff", "log", "show", "reset", "revert":
+		// Ветки и теги, а также файлы рабочего каталога
+		return append(refs("refs/heads", "refs/remotes", "refs/tags"), t.completePath(word, false)...), true
+	case "tag":
+		return refs("refs/tags"), true
+	case "push", "pull", "fetch":
+		if len(positional(args)) == 0 {
+			return remotes(), true
+		}
+		return refs("refs/heads"), true
+	case "remote":
+		if len(positional(args)) == 0 {
+			return wordItems("add", "get-url", "prune", "remove", "rename", "set-url", "show"), true
+		}
+		return remotes(), true
+	case "stash":
+		if len(positional(args)) == 0 {
+			return wordItems("apply", "branch", "clear", "drop", "list", "pop", "push", "show"), true
+		}
+	}
+	return nil, false
+}
+
+// goSubcommands - подкоманды go
+var goSubcommands = []string{
+	"bug", "build", "clean", "doc", "env", "fix", "fmt", "generate", "get", "help",
+	"install", "list", "mod", "run", "telemetry", "test", "tool", "version", "vet", "work",
+}
+
+// completeGo дополняет подкоманды go и пакеты текущего модуля
+func completeGo(t *Terminal, args []string, word string) ([]completionItem, bool) {
+	if strings.HasPrefix(word, "-") {
+		return nil, false
+	}
+	if len(args) == 1 {
+		return wordItems(goSubcommands...), true
+	}
+
+	first := len(positional(args)) == 0
+	switch args[1] {
+	case "help":
+		return wordItems(goSubcommands...), first
+	case "mod":
+		return wordItems("download", "edit", "graph", "init", "tidy", "vendor", "verify", "why"), first
+	case "work":
+		return wordItems("edit", "init", "sync", "use", "vendor"), first
+	case "build", "test", "vet", "install", "list", "generate", "fmt", "doc", "clean":
+		return goPackages(), true
+	}
+	return nil, false
+}
+
+// goPackages возвращает пакеты в текущем каталоге и ниже: каталоги с файлами .go
+func goPackages() []completionItem {
+	items := wordItems("./...")
+	filepath.WalkDir(".", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() {
+			return nil
+		}
+		name := entry.Name()
+		if path != "." && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "vendor" || name == "testdata" || name == "node_modules") {
+			return filepath.SkipDir
+		}
+		if matches, _ := filepath.Glob(filepath.Join(path, "*.go")); len(matches) > 0 {
+			pkg := "./" + filepath.ToSlash(path)
+			if path == "." {
+				pkg = "."
+			}
+			items = append(items, completionItem{text: pkg})
+			if path != "." {
+				items = append(items, completionItem{text: pkg + "/..."})
+			}
+		}
+		return nil
+	})
+	return items
+}
+
+// makeTargetPattern находит цели в строках правил Makefile: "цель1 цель2: зависимости"
+var makeTargetPattern = regexp.MustCompile(`^([^\s:=#%][^:=#%]*?)\s*::?([^=]|$)`)
+
+// completeMake дополняет цели из Makefile текущего каталога
+func completeMake(t *Terminal, args []string, word string) ([]completionItem, bool) {
+	if strings.HasPrefix(word, "-") {
+		return nil, false
+	}
+	for _, name := range []string{"GNUmakefile", "makefile", "Makefile"} {
+		file, err := os.Open(name)
+		if err != nil {
+			continue
+		}
+		defer file.Close()
+
+		var targets []string
+		seen := make(map[string]bool)
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			matches := makeTargetPattern.FindStringSubmatch(scanner.Text())
+			if matches == nil {
+				continue
+			}
+			for _, target := range strings.Fields(matches[1]) {
+				// Специальные цели (.PHONY) и переменные ($(OBJS)) не предлагаются
+				if !strings.HasPrefix(target, ".") && !strings.Contains(target, "$") && !seen[target] {
+					seen[target] = true
+					targets = append(targets, target)
+				}
+			}
+		}
+		sort.Strings(targets)
+		return wordItems(targets...), true
+	}
+	return nil, false
+}
+
+// completeSSH дополняет хосты из ~/.ssh/config и ~/.ssh/known_hosts, в том числе после "пользователь@"
+func completeSSH(t *Terminal, args []string, word string) ([]completionItem, bool) {
+	if strings.HasPrefix(word, "-") {
+		return nil, false
+	}
+	user := ""
+	if i := strings.Index(word, "@"); i >= 0 {
+		user = word[:i+1]
+	}
+
+	home, _ := os.UserHomeDir()
+	var hosts []string
+	if file, err := os.Open(filepath.Join(home, ".ssh", "config")); err == nil {
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 2 || !strings.EqualFold(fields[0], "Host") {
+				continue
+			}
+			for _, host := range fields[1:] {
+				// Шаблоны (*, ?, !) - не имена хостов
+				if !strings.ContainsAny(host, "*?!") {
+					hosts = append(hosts, host)
+				}
+			}
+		}
+		file.Close()
+	}
+	if file, err := os.Open(filepath.Join(home, ".ssh", "known_hosts")); err == nil {
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			// Хешированные имена (|1|...) прочитать нельзя
+			if len(fields) == 0 || strings.HasPrefix(fields[0], "|") || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "@") {
+				continue
+			}
+			for _, host := range strings.Split(fields[0], ",") {
+				if strings.HasPrefix(host, "[") {
+					// [хост]:порт
+					host, _, _ = strings.Cut(host[1:], "]")
+				}
+				hosts = append(hosts, host)
+			}
+		}
+		file.Close()
+	}
+
+	items := make([]completionItem, len(hosts))
+	for i, host := range hosts {
+		items[i] = completionItem{text: user + host}
+	}
+	return items, true
+}
+
+// killSignals - сигналы, предлагаемые kill после '-'
+var killSignals = []string{"HUP", "INT", "QUIT", "KILL", "USR1", "USR2", "TERM", "CONT", "STOP", "TSTP", "WINCH"}
+
+// completeKill дополняет сигналы и PID процессов текущего пользователя; рядом с PID
+// в меню показывается имя процесса
+func completeKill(t *Terminal, args []string, word string) ([]completionItem, bool) {
+	if strings.HasPrefix(word, "-") {
+		var items []completionItem
+		for _, name := range killSignals {
+			items = append(items, completionItem{text: "-" + name})
+		}
+		return items, true
+	}
+
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, true
+	}
+	uid := uint32(os.Getuid())
+	var items []completionItem
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+		info, err := os.Stat(filepath.Join("/proc", entry.Name()))
+		if err != nil {
+			continue
+		}
+		if stat, ok := info.Sys().(*syscall.Stat_t); !ok || stat.Uid != uid {
+			continue
+		}
+		// У потоков ядра пустая командная строка
+		if cmdline, _ := os.ReadFile(filepath.Join("/proc", entry.Name(), "cmdline")); len(cmdline) == 0 {
+			continue
+		}
+		comm, _ := os.ReadFile(filepath.Join("/proc", entry.Name(), "comm"))
+		items = append(items, completionItem{text: entry.Name(), desc: strings.TrimSpace(string(comm))})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		a, _ := strconv.Atoi(items[i].text)
+		b, _ := strconv.Atoi(items[j].text)
+		return a < b
+	})
+	return items, true
+}
+
+// completeCd дополняет только каталоги
+func completeCd(t *Terminal, args []string, word string) ([]completionItem, bool) {
+	var items []completionItem
+	for _, item := range t.completePath(word, false) {
+		if item.dir {
+			items = append(items, item)
+		}
+	}
+	return items, true
+}
+
+// processCompleteCommand показывает и настраивает поставщики дополнения:
+// complete -C команда имя... - внешняя команда, complete -r имя... - удалить поставщик
+func (t *Terminal) processCompleteCommand(args []string) ([]LineSegment, int) {
+	if len(args) <= 1 {
+		var names []string
+		for name, provider := range t.completions {
+			if provider.fn != nil || provider.command != "" {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		var segments []LineSegment
+		for _, name := range names {
+			provider := t.completions[name]
+			line := fmt.Sprintf("%-10s (встроенное)", name)
+			switch {
+			case provider.command != "":
+				line = fmt.Sprintf("complete -C %s %s", shellQuote(provider.command), name)
+			case provider.source != "":
+				line = fmt.Sprintf("%-10s (%s)", name, provider.source)
+			}
+			segments = append(segments, LineSegment{Text: line, Style: tcell.StyleDefault.Foreground(tcell.ColorWhite)})
+		}
+		return segments, 0
+	}
+
+	switch {
+	case args[1] == "-C" && len(args) > 3:
+		for _, name := range args[3:] {
+			// Внешняя команда запускается через sh - только по Tab
+			t.completions[name] = completionProvider{command: args[2], tabOnly: true}
+		}
+	case args[1] == "-r" && len(args) > 2:
+		// Пустой поставщик, а не удаление: иначе дополнение снова импортируется из bash или fish
+		for _, name := range args[2:] {
+			t.completions[name] = completionProvider{}
+		}
+	default:
+		return []LineSegment{{Text: "Используйте: complete -C команда имя... | complete -r имя...", Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}, 2
+	}
+	return []LineSegment{}, 0
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSlowCompletersTabOnly(t *testing.T) {
+	term := newTestTerminal()
+	term.processCompleteCommand([]string{"complete", "-C", "echo one; echo two; true", "mytool"})
+
+	// Поставщики, запускающие процессы или обходящие файлы, не вызываются
+	// для подсказки при каждом нажатии клавиши
+	for _, words := range [][]string{{"git"}, {"go", "test"}, {"kill"}, {"sudo", "kill"}, {"mytool"}} {
+		word := completionWord{words: words}
+		if items, handled := term.completeArgument(word, false); handled || items != nil {
+			t.Errorf("%q: поставщик вызван без Tab: %v", words, items)
+		}
+	}
+
+	// По Tab внешняя команда вызывается
+	items, handled := term.completeArgument(completionWord{words: []string{"mytool"}}, true)
+	var texts []string
+	for _, item := range items {
+		texts = append(texts, item.text)
+	}
+	if !handled || !slices.Equal(texts, []string{"one", "two"}) {
+		t.Errorf("mytool по Tab: %v %q", handled, texts)
+	}
+}
+
+func TestApplyOptions(t *testing.T) {
+	term := newTestTerminal()
+	warnings := term.applyOptions([]string{
+		"$UNSET",
+		"set -o vi",
+		"set -o nosuchoption",
+		"frobnicate",
+		"complete -C 'echo x' mytool",
+		"complete -X",
+	})
+	if !term.options["vi"] {
+		t.Error("set -o vi не применена")
+	}
+	if provider := term.completions["mytool"]; provider.command != "echo x" {
+		t.Errorf("complete -C не применена: %+v", provider)
+	}
+	if len(warnings) != 3 || warnings[1] != "неизвестная команда 'frobnicate'" {
+		t.Errorf("предупреждения %q", warnings)
+	}
+}
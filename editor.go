@@ -0,0 +1,119 @@
+package main
+
+import (
+	"strings"
+)
+
+// continuationPrompt - приглашение второй и следующих строк многострочной команды
+const continuationPrompt = "> "
+
+// needsContinuation проверяет, продолжается ли команда на следующей строке:
+// незакрытая кавычка или подстановка, '\' в конце, оператор в конце строки
+// или незакрытый блок if, for, while, case, { ... }
+func needsContinuation(input string) bool {
+	tokens, err := lex(input)
+	if err != nil {
+		return isIncompleteInput(input)
+	}
+	if n := len(tokens); n > 0 && tokens[n-1].kind == tokenOperator {
+		switch tokens[n-1].text {
+		case "&&", "||", "|":
+			return true
+		}
+	}
+	return openBlockDepth(tokens) > 0
+}
+
+// openBlockDepth считает незакрытые составные команды: ключевые слова учитываются
+// только в позиции имени команды, как их распознает shell
+func openBlockDepth(tokens []token) int {
+	depth := 0
+	commandStart := true
+	for _, tok := range tokens {
+		switch tok.kind {
+		case tokenOperator:
+			commandStart = true
+			continue
+		case tokenAssignment, tokenRedirect:
+			continue
+		}
+		if !commandStart {
+			continue
+		}
+
+		commandStart = false
+		switch tok.text {
+		case "if", "while", "until", "{", "(":
+			depth++
+			commandStart = true
+		case "for", "case", "select":
+			depth++
+		case "fi", "done", "esac", "}", ")":
+			depth--
+		case "then", "do", "else", "elif", "!":
+			commandStart = true
+		}
+	}
+	return depth
+}
+
+// layoutInput раскладывает строку ввода по экранным строкам ширины width: первая
+// строка команды начинается с приглашения prompt, следующие - с приглашения
+// продолжения, длинные строки переносятся. Возвращает строки и экранное положение
+// каждой позиции ввода, включая позицию после последнего символа
+func (t *Terminal) layoutInput(prompt string, width int) (rows []string, positions []textPos) {
+	width = max(1, width)
+	for i, line := range strings.Split(string(t.inputBuffer), "\n") {
+		prefix := continuationPrompt
+		if i == 0 {
+			prefix = prompt
+		}
+		text := []rune(prefix + line)
+		lineRows := max(1, (len(text)+width-1)/width)
+
+		lineStart := len(positions)
+		for col := len([]rune(prefix)); col <= len(text); col++ {
+			positions = append(positions, textPos{row: len(rows) + col/width, col: col % width})
+		}
+		if t.cursorPos >= lineStart && t.cursorPos < len(positions) {
+			// Курсор в конце заполненной строки переходит на новую
+			lineRows = max(lineRows, positions[t.cursorPos].row-len(rows)+1)
+		}
+
+		for r := 0; r < lineRows; r++ {
+			rows = append(rows, string(text[min(r*width, len(text)):min((r+1)*width, len(text))]))
+		}
+	}
+	return rows, positions
+}
+
+// inputLineBounds возвращает начало и конец строки команды, в которой стоит курсор
+func (t *Terminal) inputLineBounds(pos int) (int, int) {
+	start, end := pos, pos
+	for start > 0 && t.inputBuffer[start-1] != '\n' {
+		start--
+	}
+	for end < len(t.inputBuffer) && t.inputBuffer[end] != '\n' {
+		end++
+	}
+	return start, end
+}
+
+// moveCursorLine перемещает курсор на строку выше (delta < 0) или ниже многострочной
+// команды, сохраняя столбец. Возвращает false, если такой строки нет
+func (t *Terminal) moveCursorLine(delta int) bool {
+	start, end := t.inputLineBounds(t.cursorPos)
+	col := t.cursorPos - start
+
+	var lineStart, lineEnd int
+	switch {
+	case delta < 0 && start > 0:
+		lineStart, lineEnd = t.inputLineBounds(start - 1)
+	case delta > 0 && end < len(t.inputBuffer):
+		lineStart, lineEnd = t.inputLineBounds(end + 1)
+	default:
+		return false
+	}
+	t.cursorPos = lineStart + min(col, lineEnd-lineStart)
+	return true
+}
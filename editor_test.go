@@ -0,0 +1,89 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestNeedsContinuation(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"echo a", false},
+		{"echo 'a", true},
+		{"echo \"a", true},
+		{"echo $(ls", true},
+		{"echo a \\", true},
+		{"echo a &&", true},
+		{"echo a ||", true},
+		{"echo a |", true},
+		{"echo a ;", false},
+		{"echo a &", false},
+		{"echo '&&'", false},
+		{"echo a \\\\", false},
+		// Незакрытые блоки продолжаются до fi, done, esac
+		{"if true; then", true},
+		{"if true; then\necho a\nfi", false},
+		{"for f in *; do", true},
+		{"for f in *; do\necho $f\ndone", false},
+		{"while true; do\nif true; then\nbreak\nfi", true},
+		{"while true; do\nif true; then\nbreak\nfi\ndone", false},
+		{"case $x in", true},
+		{"case $x in\na) echo a;;\nesac", false},
+		{"{ echo a", true},
+		{"{ echo a; }", false},
+		// Ключевые слова вне позиции имени команды - обычные слова
+		{"echo if for", false},
+		{"echo 'if'", false},
+		{"x=if echo done", false},
+	}
+	for _, tt := range tests {
+		if got := needsContinuation(tt.input); got != tt.want {
+			t.Errorf("needsContinuation(%q) = %v, ожидалось %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestContinuedInputRuns(t *testing.T) {
+	// Многострочная команда, набранная с продолжениями, выполняется целиком
+	tests := []struct {
+		lines []string
+		want  string
+	}{
+		{[]string{"echo a &&", "echo b"}, "a\nb\n"},
+		{[]string{"cd /nonexistent ||", "echo c"}, "c\n"},
+		{[]string{"echo 'a", "b'"}, "a\nb\n"},
+		{[]string{"echo \"x", "y\" z"}, "x\ny z\n"},
+		{[]string{"echo a \\", "b"}, "a b\n"},
+		{[]string{"echo $(echo a", "echo b)"}, "a b\n"},
+		{[]string{"echo a |", "cat"}, "a\n"},
+	}
+	for _, tt := range tests {
+		term := newTestTerminal()
+		input := tt.lines[0]
+		for _, line := range tt.lines[1:] {
+			if !needsContinuation(input) {
+				t.Errorf("%q: продолжение не запрошено", input)
+			}
+			input += "\n" + line
+		}
+		if needsContinuation(input) {
+			t.Errorf("%q: команда не завершена", input)
+			continue
+		}
+
+		segments, _ := term.executeCommandListTo(input, nil)
+		var got string
+		for _, segment := range segments {
+			// Сообщения об ошибках (cd в несуществующий каталог) не сравниваются
+			if fg, _, _ := segment.Style.Decompose(); fg != tcell.ColorRed {
+				got += segment.Text + "\n"
+			}
+		}
+		if got != tt.want {
+			t.Errorf("%q: вывод %q, ожидалось %q", input, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// loadEnvironment создает модель окружения терминала из окружения процесса.
+// Все запускаемые команды получают именно эту модель, а не os.Environ()
+func loadEnvironment() map[string]string {
+	env := make(map[string]string)
+	for _, entry := range os.Environ() {
+		if i := strings.Index(entry, "="); i > 0 {
+			env[entry[:i]] = entry[i+1:]
+		}
+	}
+
+	// Дочерние процессы работают с эмуляцией xterm
+	env["TERM"] = "xterm-256color"
+	return env
+}
+
+// environ возвращает окружение для дочерних процессов в формате ИМЯ=значение
+func (t *Terminal) environ() []string {
+	env := make([]string, 0, len(t.envVars))
+	for name, value := range t.envVars {
+		env = append(env, name+"="+value)
+	}
+	sort.Strings(env)
+	return env
+}
+
+// lookupVar возвращает значение переменной и признак того, что она установлена
+func (t *Terminal) lookupVar(name string) (string, bool) {
+	switch name {
+	case "?":
+		return strconv.Itoa(t.lastStatus), true
+	case "$":
+		return strconv.Itoa(os.Getpid()), true
+	case "!":
+		// PID последнего фонового задания
+		if t.lastBgPid == 0 {
+			return "", false
+		}
+		return strconv.Itoa(t.lastBgPid), true
+	}
+	value, exists := t.envVars[name]
+	return value, exists
+}
+
+// expandVarAt раскрывает ссылку на переменную, начинающуюся с '$' в позиции i:
+// $ИМЯ, ${ИМЯ}, ${ИМЯ:-значение}, ${ИМЯ-значение}, $?, $$ и $!.
+// Возвращает значение и позицию после ссылки; ok=false, если после '$' нет ссылки
+func (t *Terminal) expandVarAt(runes []rune, i int) (value string, next int, ok bool) {
+	j := i + 1
+	if j >= len(runes) {
+		return "", i, false
+	}
+
+	switch r := runes[j]; {
+	case r == '?' || r == '$' || r == '!':
+		value, _ := t.lookupVar(string(r))
+		return value, j + 1, true
+
+	case isVarNameStart(r):
+		k := j
+		for k < len(runes) && isVarNameChar(runes[k]) {
+			k++
+		}
+		value, _ := t.lookupVar(string(runes[j:k]))
+		return value, k, true
+
+	case r == '{':
+		// Ищем парную закрывающую скобку с учетом вложенных ${...}
+		depth := 1
+		k := j + 1
+		for ; k < len(runes); k++ {
+			if runes[k] == '{' && runes[k-1] == '$' {
+				depth++
+			} else if runes[k] == '}' {
+				depth--
+				if depth == 0 {
+					break
+				}
+			}
+		}
+		if k >= len(runes) {
+			return "", i, false
+		}
+		return t.expandBraceVar(string(runes[j+1 : k])), k + 1, true
+	}
+
+	return "", i, false
+}
+
+// expandBraceVar раскрывает содержимое ${...}
+func (t *Terminal) expandBraceVar(expr string) string {
+	name := expr
+	op := ""
+	word := ""
+	for k, r := range expr {
+		if !isVarNameChar(r) && !(k == 0 && r == '?') {
+			name = expr[:k]
+			rest := expr[k:]
+			if strings.HasPrefix(rest, ":-") {
+				op, word = ":-", rest[2:]
+			} else if strings.HasPrefix(rest, "-") {
+				op, word = "-", rest[1:]
+			}
+			break
+		}
+	}
+
+	value, exists := t.lookupVar(name)
+	switch op {
+	case ":-":
+		// Значение по умолчанию, если переменная не установлена или пуста
+		if !exists || value == "" {
+			return t.expandEnvVars(word)
+		}
+	case "-":
+		// Значение по умолчанию, только если переменная не установлена
+		if !exists {
+			return t.expandEnvVars(word)
+		}
+	}
+	return value
+}
+
+func isVarNameStart(r rune) bool {
+	return r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+func isVarNameChar(r rune) bool {
+	return isVarNameStart(r) || (r >= '0' && r <= '9')
+}
+
+// isValidVarName проверяет, можно ли использовать строку как имя переменной
+func isValidVarName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		if (i == 0 && !isVarNameStart(r)) || !isVarNameChar(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// expandAssignment раскрывает присваивание ИМЯ=значение. Значение не разбивается
+// на несколько слов и не раскрывается как шаблон пути. Ошибка раскрытия
+// выводится перед выводом команды, значением остается исходный текст
+func (t *Terminal) expandAssignment(assign string) (string, string) {
+	i := strings.IndexRune(assign, '=')
+	var parts []string
+	for _, word := range t.expandWord(assign[i+1:]) {
+		if word.err != nil {
+			t.substitutionOutput = append(t.substitutionOutput, LineSegment{Text: fmt.Sprintf("Ошибка: %s", word.err), Style: tcell.StyleDefault.Foreground(tcell.ColorRed)})
+			t.lastStatus = 1
+		}
+		parts = append(parts, word.text)
+	}
+	return assign[:i], strings.Join(parts, " ")
+}
+
+// applyAssignments устанавливает переменные из присваиваний и возвращает функцию,
+// восстанавливающую прежние значения: присваивания перед командой действуют только на нее
+func (t *Terminal) applyAssignments(assigns []string) func() {
+	saved := make(map[string]*string)
+	for _, assign := range assigns {
+		name, value := t.expandAssignment(assign)
+		if _, done := saved[name]; !done {
+			if old, exists := t.envVars[name]; exists {
+				saved[name] = &old
+			} else {
+				saved[name] = nil
+			}
+		}
+		t.envVars[name] = value
+	}
+
+	return func() {
+		for name, old := range saved {
+			if old == nil {
+				delete(t.envVars, name)
+			} else {
+				t.envVars[name] = *old
+			}
+		}
+	}
+}
+
+// processUnsetCommand удаляет переменные из окружения терминала
+func (t *Terminal) processUnsetCommand(args []string) ([]LineSegment, int) {
+	if len(args) <= 1 {
+		return []LineSegment{{Text: "Используйте: unset ИМЯ [ИМЯ...]", Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}, 1
+	}
+
+	status := 0
+	var segments []LineSegment
+	for _, name := range args[1:] {
+		if !isValidVarName(name) {
+			segments = append(segments, LineSegment{Text: fmt.Sprintf("unset: '%s': недопустимое имя переменной", name), Style: tcell.StyleDefault.Foreground(tcell.ColorRed)})
+			status = 1
+			continue
+		}
+		delete(t.envVars, name)
+	}
+
+	return segments, status
+}
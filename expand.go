@@ -0,0 +1,478 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// substitutionEnd возвращает позицию сразу после подстановки команды, начинающейся в i
+// ($(...) или `...`), или -1, если в позиции i нет подстановки или она не закрыта
+func substitutionEnd(runes []rune, i int) int {
+	if runes[i] == '`' {
+		for j := i + 1; j < len(runes); j++ {
+			if runes[j] == '\\' {
+				j++
+				continue
+			}
+			if runes[j] == '`' {
+				return j + 1
+			}
+		}
+		return -1
+	}
+
+	if runes[i] != '$' || i+1 >= len(runes) || runes[i+1] != '(' {
+		return -1
+	}
+
+	// Ищем парную скобку с учетом кавычек и вложенных подстановок
+	depth := 0
+	quoteChar := rune(0)
+	for j := i + 1; j < len(runes); j++ {
+		r := runes[j]
+		switch {
+		case r == '\\' && quoteChar != '\'':
+			j++
+		case quoteChar != 0:
+			if r == quoteChar {
+				quoteChar = 0
+			}
+		case r == '\'' || r == '"':
+			quoteChar = r
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+			if depth == 0 {
+				return j + 1
+			}
+		}
+	}
+	return -1
+}
+
+// isSubstitutionStart проверяет, начинается ли в позиции i подстановка команды
+func isSubstitutionStart(runes []rune, i int) bool {
+	return runes[i] == '`' || (runes[i] == '$' && i+1 < len(runes) && runes[i+1] == '(')
+}
+
+// splitRawWords разбивает команду на слова по лексемам. Кавычки в словах сохраняются -
+// их обрабатывает expandWord
+func splitRawWords(input string) []string {
+	tokens, _ := lex(input)
+	var words []string
+	for _, tok := range tokens {
+		if tok.kind == tokenWord || tok.kind == tokenAssignment {
+			words = append(words, tok.text)
+		}
+	}
+	return words
+}
+
+// expandRawWords выполняет раскрытия для слов команды: фигурные скобки, затем тильда,
+// переменные и подстановки команд. Шаблоны путей раскрывает expandWords
+func (t *Terminal) expandRawWords(raw []string) []shellWord {
+	var words []shellWord
+	for _, r := range raw {
+		for _, word := range expandBraces(r) {
+			words = append(words, t.expandWord(word)...)
+		}
+	}
+	return words
+}
+
+// expandBraces выполняет раскрытие фигурных скобок: a{b,c}d, {1..10}, {a..e}, {01..10..2}.
+// Скобки в кавычках и ${...} не раскрываются
+func expandBraces(word string) []string {
+	runes := []rune(word)
+	open, close, alternatives := findBraceGroup(runes)
+	if open < 0 {
+		return []string{word}
+	}
+
+	prefix := string(runes[:open])
+	suffix := string(runes[close+1:])
+
+	var result []string
+	for _, alt := range alternatives {
+		// Рекурсивно раскрываем вложенные и последующие группы
+		result = append(result, expandBraces(prefix+alt+suffix)...)
+	}
+	return result
+}
+
+// findBraceGroup ищет первую раскрываемую группу {...} и возвращает ее границы и варианты
+func findBraceGroup(runes []rune) (int, int, []string) {
+	quoteChar := rune(0)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quoteChar != 0:
+			if r == '\\' && quoteChar == '"' {
+				i++
+			} else if r == quoteChar {
+				quoteChar = 0
+			}
+			continue
+		case r == '\'' || r == '"':
+			quoteChar = r
+			continue
+		case r == '\\':
+			i++
+			continue
+		case isSubstitutionStart(runes, i):
+			if end := substitutionEnd(runes, i); end > 0 {
+				i = end - 1
+			}
+			continue
+		case r != '{':
+			continue
+		case i > 0 && runes[i-1] == '$':
+			// ${ИМЯ} - подстановка переменной, а не группа
+			continue
+		}
+
+		// Ищем парную скобку и запятые верхнего уровня
+		depth := 0
+		var commas []int
+		innerQuote := rune(0)
+		end := -1
+		for j := i; j < len(runes) && end < 0; j++ {
+			c := runes[j]
+			switch {
+			case innerQuote != 0:
+				if c == innerQuote {
+					innerQuote = 0
+				}
+			case c == '\'' || c == '"':
+				innerQuote = c
+			case c == '\\':
+				j++
+			case c == '{':
+				depth++
+			case c == '}':
+				depth--
+				if depth == 0 {
+					end = j
+				}
+			case c == ',' && depth == 1:
+				commas = append(commas, j)
+			}
+		}
+		if end < 0 {
+			return -1, -1, nil
+		}
+
+		if len(commas) > 0 {
+			var alternatives []string
+			start := i + 1
+			for _, comma := range append(commas, end) {
+				alternatives = append(alternatives, string(runes[start:comma]))
+				start = comma + 1
+			}
+			return i, end, alternatives
+		}
+		if alternatives := braceRange(string(runes[i+1 : end])); alternatives != nil {
+			return i, end, alternatives
+		}
+		// {abc} без запятых и диапазона остается как есть - ищем дальше
+	}
+	return -1, -1, nil
+}
+
+// braceRange раскрывает диапазон вида 1..10, a..e или 1..10..2; nil, если это не диапазон
+func braceRange(expr string) []string {
+	parts := strings.Split(expr, "..")
+	if len(parts) != 2 && len(parts) != 3 {
+		return nil
+	}
+
+	step := 1
+	if len(parts) == 3 {
+		s, err := strconv.Atoi(parts[2])
+		if err != nil || s == 0 {
+			return nil
+		}
+		step = max(s, -s)
+	}
+
+	// Числовой диапазон
+	from, errFrom := strconv.Atoi(parts[0])
+	to, errTo := strconv.Atoi(parts[1])
+	if errFrom == nil && errTo == nil {
+		// Ведущие нули задают ширину: {01..10}
+		width := 0
+		for _, p := range parts[:2] {
+			digits := strings.TrimPrefix(p, "-")
+			if len(digits) > 1 && digits[0] == '0' {
+				width = max(width, len(p))
+			}
+		}
+
+		var result []string
+		for n := from; ; {
+			result = append(result, fmt.Sprintf("%0*d", width, n))
+			if n == to || (from < to && n+step > to) || (from > to && n-step < to) {
+				break
+			}
+			if from < to {
+				n += step
+			} else {
+				n -= step
+			}
+		}
+		return result
+	}
+
+	// Символьный диапазон
+	a, b := []rune(parts[0]), []rune(parts[1])
+	if len(a) == 1 && len(b) == 1 && unicode.IsLetter(a[0]) && unicode.IsLetter(b[0]) {
+		var result []string
+		for c := int(a[0]); ; {
+			result = append(result, string(rune(c)))
+			if c == int(b[0]) || (a[0] < b[0] && c+step > int(b[0])) || (a[0] > b[0] && c-step < int(b[0])) {
+				break
+			}
+			if a[0] < b[0] {
+				c += step
+			} else {
+				c -= step
+			}
+		}
+		return result
+	}
+
+	return nil
+}
+
+// expandTildeAt раскрывает ~, ~user, ~+ и ~- в позиции i до ближайшего '/'
+func (t *Terminal) expandTildeAt(runes []rune, i int) (string, int, bool) {
+	j := i + 1
+	for j < len(runes) && runes[j] != '/' {
+		if runes[j] == '"' || runes[j] == '\'' || runes[j] == '$' || runes[j] == '`' {
+			return "", i, false
+		}
+		j++
+	}
+
+	name := string(runes[i+1 : j])
+	switch name {
+	case "":
+		if home, exists := t.envVars["HOME"]; exists && home != "" {
+			return home, j, true
+		}
+		home, err := os.UserHomeDir()
+		return home, j, err == nil
+	case "+":
+		dir, err := os.Getwd()
+		return dir, j, err == nil
+	case "-":
+		dir, exists := t.envVars["OLDPWD"]
+		return dir, j, exists
+	}
+
+	u, err := user.Lookup(name)
+	if err != nil {
+		return "", i, false
+	}
+	return u.HomeDir, j, true
+}
+
+// expandWord раскрывает одно слово: тильду, переменные, подстановки команд и $((...)),
+// убирает кавычки и помечает метасимволы шаблонов вне кавычек.
+// Результат подстановки команды без кавычек разбивается на несколько слов
+func (t *Terminal) expandWord(raw string) []shellWord {
+	var words []shellWord
+	var current, pattern strings.Builder
+	hasGlob := false
+	inQuotes := false
+	quoteChar := rune(0)
+
+	// addLiteral добавляет текст, который не должен участвовать в раскрытии шаблонов
+	addLiteral := func(text string) {
+		for _, r := range text {
+			current.WriteRune(r)
+			if isGlobMeta(r) {
+				pattern.WriteRune('\\')
+			}
+			pattern.WriteRune(r)
+		}
+	}
+
+	// quoted - в слове были кавычки: "" дает пустой аргумент, а не пропадает
+	quoted := false
+	endWord := func() {
+		if current.Len() > 0 || quoted {
+			words = append(words, shellWord{text: current.String(), pattern: pattern.String(), hasGlob: hasGlob})
+		}
+		current.Reset()
+		pattern.Reset()
+		hasGlob = false
+		quoted = false
+	}
+
+	runes := []rune(raw)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '"' || r == '\'':
+			if !inQuotes {
+				// Начало кавычек
+				inQuotes = true
+				quoteChar = r
+				quoted = true
+			} else if quoteChar == r {
+				// Конец кавычек
+				inQuotes = false
+				quoteChar = 0
+			} else {
+				// Кавычка внутри других кавычек
+				addLiteral(string(r))
+			}
+		case r == '\\' && quoteChar != '\'':
+			if i+1 >= len(runes) {
+				addLiteral(string(r))
+				continue
+			}
+			i++
+			next := runes[i]
+			switch {
+			case next == '\n':
+				// Экранированный перевод строки - продолжение команды
+			case !inQuotes:
+				addLiteral(string(next))
+			case strings.ContainsRune("$`\"\\", next):
+				// В двойных кавычках '\' экранирует только $, `, " и \\
+				addLiteral(string(next))
+			default:
+				addLiteral("\\" + string(next))
+			}
+		case r == '$' && !inQuotes && i+1 < len(runes) && runes[i+1] == '\'':
+			// $'...' - строка с escape-последовательностями C
+			value, next := decodeANSIC(runes, i+2)
+			addLiteral(value)
+			quoted = true
+			i = next - 1
+		case r == '~' && !inQuotes && (i == 0 || (runes[i-1] == '=' && isValidVarName(string(runes[:i-1])))):
+			// Тильда в начале слова или после "ИМЯ="
+			if dir, next, ok := t.expandTildeAt(runes, i); ok {
+				addLiteral(dir)
+				i = next - 1
+			} else {
+				addLiteral(string(r))
+			}
+		case isSubstitutionStart(runes, i) && quoteChar != '\'':
+			end := substitutionEnd(runes, i)
+			if end < 0 {
+				addLiteral(string(r))
+				continue
+			}
+			var output string
+			switch {
+			case r == '`':
+				output = t.runSubstitution(string(runes[i+1 : end-1]))
+			case isArithmeticStart(runes, i, end):
+				// $((выражение)) - арифметика, а не команда в подоболочке
+				value, err := t.evalArithmetic(string(runes[i+3 : end-2]))
+				if err != nil {
+					// Слово с ошибкой не раскрывается дальше: команда не выполнится
+					return []shellWord{{text: raw, err: fmt.Errorf("%s: %s", string(runes[i:end]), err)}}
+				}
+				output = value
+			default:
+				output = t.runSubstitution(string(runes[i+2 : end-1]))
+			}
+			i = end - 1
+
+			if inQuotes {
+				addLiteral(output)
+				continue
+			}
+
+			// Без кавычек результат разбивается на слова по пробельным символам
+			fields := strings.Fields(output)
+			if output != "" && unicode.IsSpace([]rune(output)[0]) {
+				endWord()
+			}
+			for k, field := range fields {
+				if k > 0 {
+					endWord()
+				}
+				addLiteral(field)
+			}
+			if len(fields) > 0 && unicode.IsSpace([]rune(output)[len([]rune(output))-1]) {
+				endWord()
+			}
+		case r == '$' && quoteChar != '\'':
+			// Подстановка переменной: $ИМЯ, ${ИМЯ}, ${ИМЯ:-значение}, $?
+			// Как в zsh, значение переменной не раскрывается как шаблон
+			if value, next, ok := t.expandVarAt(runes, i); ok {
+				addLiteral(value)
+				i = next - 1
+			} else {
+				addLiteral(string(r))
+			}
+		case (r == ' ' || r == '\t') && !inQuotes:
+			endWord()
+		case inQuotes:
+			// Все внутри кавычек, включая пробелы и метасимволы, - обычный текст
+			addLiteral(string(r))
+		default:
+			current.WriteRune(r)
+			pattern.WriteRune(r)
+			if r == '*' || r == '?' || r == '[' {
+				hasGlob = true
+			}
+		}
+	}
+
+	endWord()
+	return words
+}
+
+// runSubstitution выполняет команду для подстановки $(...) и возвращает ее stdout
+// без завершающих переводов строк. Команда работает как во вложенном shell:
+// cd, export и unset внутри подстановки не меняют состояние терминала
+func (t *Terminal) runSubstitution(cmd string) string {
+	log.Printf("🔁 Подстановка команды: %s", cmd)
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		log.Printf("❌ Ошибка создания pipe: %v", err)
+		return ""
+	}
+
+	var output bytes.Buffer
+	readDone := make(chan struct{})
+	go func() {
+		io.Copy(&output, r)
+		r.Close()
+		close(readDone)
+	}()
+
+	dir, _ := os.Getwd()
+	env := maps.Clone(t.envVars)
+
+	t.subshellDepth++
+	segments, status := t.executeCommandListTo(cmd, w)
+	t.subshellDepth--
+
+	os.Chdir(dir)
+	t.envVars = env
+	w.Close()
+	<-readDone
+
+	// stderr и ошибки подстановки показываются перед выводом самой команды
+	t.substitutionOutput = append(t.substitutionOutput, segments...)
+	t.lastStatus = status
+
+	return strings.TrimRight(output.String(), "\n")
+}
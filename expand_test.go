@@ -0,0 +1,220 @@
+package main
+
+import (
+	"os"
+	"os/user"
+	"slices"
+	"testing"
+)
+
+func TestExpandBraces(t *testing.T) {
+	tests := []struct {
+		word string
+		want []string
+	}{
+		{"a{b,c}d", []string{"abd", "acd"}},
+		{"{a,b}{1,2}", []string{"a1", "a2", "b1", "b2"}},
+		{"x{a,{b,c}}", []string{"xa", "xb", "xc"}},
+		{"{,.bak}", []string{"", ".bak"}},
+		{"{1..4}", []string{"1", "2", "3", "4"}},
+		{"{3..1}", []string{"3", "2", "1"}},
+		{"{-1..1}", []string{"-1", "0", "1"}},
+		{"{01..10..3}", []string{"01", "04", "07", "10"}},
+		{"{1..10..4}", []string{"1", "5", "9"}},
+		{"{10..1..-4}", []string{"10", "6", "2"}},
+		{"{a..e..2}", []string{"a", "c", "e"}},
+		{"{e..c}", []string{"e", "d", "c"}},
+		{"{abc}", []string{"{abc}"}},
+		{"{1..x}", []string{"{1..x}"}},
+		{"{a,b", []string{"{a,b"}},
+		{"'{a,b}'", []string{"'{a,b}'"}},
+		{`\{a,b}`, []string{`\{a,b}`}},
+		{"${HOME}", []string{"${HOME}"}},
+		{"$(echo {a,b})x{1,2}", []string{"$(echo {a,b})x1", "$(echo {a,b})x2"}},
+	}
+	for _, tt := range tests {
+		if got := expandBraces(tt.word); !slices.Equal(got, tt.want) {
+			t.Errorf("expandBraces(%q) = %q, ожидалось %q", tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestExpandTilde(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	term := newTestTerminal()
+	term.envVars = map[string]string{"HOME": "/home/test", "OLDPWD": "/prev"}
+
+	tests := []struct {
+		word string
+		want string
+	}{
+		{"~", "/home/test"},
+		{"~/src", "/home/test/src"},
+		{"~+", cwd},
+		{"~-/x", "/prev/x"},
+		{"a~", "a~"},
+		{"'~'", "~"},
+		{`"~/src"`, "~/src"},
+		{`\~`, "~"},
+		{"PATH=~/bin", "PATH=/home/test/bin"},
+		{"~no-such-user-here", "~no-such-user-here"},
+	}
+	if u, err := user.Current(); err == nil {
+		tests = append(tests, struct {
+			word string
+			want string
+		}{"~" + u.Username + "/x", u.HomeDir + "/x"})
+	}
+	for _, tt := range tests {
+		words := term.expandWord(tt.word)
+		if len(words) != 1 || words[0].text != tt.want {
+			t.Errorf("expandWord(%q) = %+v, ожидалось %q", tt.word, words, tt.want)
+		}
+	}
+}
+
+func TestExpandWord(t *testing.T) {
+	term := newTestTerminal()
+	term.envVars = map[string]string{"X": "5", "EMPTY": "", "SP": "a b"}
+
+	tests := []struct {
+		word string
+		want []string
+	}{
+		{`"a b"`, []string{"a b"}},
+		{`''`, []string{""}},
+		{"$EMPTY", nil},
+		{`"$EMPTY"`, []string{""}},
+		{"$SP", []string{"a b"}}, // Значение переменной не разбивается на слова
+		{`'$X'`, []string{"$X"}},
+		{`"$X"`, []string{"5"}},
+		{"${X}0", []string{"50"}},
+		{`$'a\tb\x41'`, []string{"a\tbA"}},
+		{"$(echo a b)", []string{"a", "b"}},
+		{`"$(echo a b)"`, []string{"a b"}},
+		{"x`echo y`", []string{"xy"}},
+		{"$((1 + 2 * 3))", []string{"7"}},
+		{"$((X * 2))", []string{"10"}},
+		{`"$(( $X - 7 ))"`, []string{"-2"}},
+		{"$((1/0))", []string{"$((1/0))"}}, // Ошибка: выражение остается как есть
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, word := range term.expandWord(tt.word) {
+			got = append(got, word.text)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("expandWord(%q) = %q, ожидалось %q", tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestArithmeticAssignment(t *testing.T) {
+	term := newTestTerminal()
+	term.envVars = map[string]string{"X": "10"}
+	tests := []struct {
+		expr, want, x string
+	}{
+		{"X = 3", "3", "3"},
+		{"X += 2", "5", "5"},
+		{"X *= X - 1", "20", "20"},
+		{"X <<= 1", "40", "40"},
+		{"X %= 7", "5", "5"},
+		{"Y = X = 1", "1", "1"},
+		{"X == 1 ? (X = 8) : (X = 9)", "8", "8"},
+		{"0 && (X = 100)", "0", "8"},
+		{"X -= 1, 0", "", "8"},
+	}
+	for _, tt := range tests {
+		got, err := term.evalArithmetic(tt.expr)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("evalArithmetic(%q) = %q, ожидалась ошибка", tt.expr, got)
+			}
+		} else if err != nil || got != tt.want {
+			t.Errorf("evalArithmetic(%q) = %q, %v; ожидалось %q", tt.expr, got, err, tt.want)
+		}
+		if term.envVars["X"] != tt.x {
+			t.Errorf("%q: X=%q, ожидалось %q", tt.expr, term.envVars["X"], tt.x)
+		}
+	}
+	if term.envVars["Y"] != "1" {
+		t.Errorf("Y=%q, ожидалось 1", term.envVars["Y"])
+	}
+}
+
+func TestArithmeticErrorStopsCommand(t *testing.T) {
+	tests := []struct {
+		cmd, want string
+		status    int
+	}{
+		{"echo $((10/0))", "Ошибка: $((10/0)): деление на 0\n", 1},
+		{"echo $((10/0)); echo $?", "Ошибка: $((10/0)): деление на 0\n1\n", 0},
+		{"echo $((10/0)) || echo сбой", "Ошибка: $((10/0)): деление на 0\nсбой\n", 0},
+		{"echo $((n = 4)) $n $((n += 1))", "4 4 5\n", 0},
+		{"echo $((1 ? 2 : 3))", "2\n", 0},
+	}
+	for _, tt := range tests {
+		term := newTestTerminal()
+		segments, status := term.executeCommandListTo(tt.cmd, nil)
+		if got := segmentsToText(segments); got != tt.want || status != tt.status {
+			t.Errorf("%q: %q, %d; ожидалось %q, %d", tt.cmd, got, status, tt.want, tt.status)
+		}
+	}
+}
+
+func TestEvalArithmetic(t *testing.T) {
+	term := newTestTerminal()
+	term.envVars = map[string]string{"N": "7", "HEX": "0x10", "WORD": "abc"}
+
+	tests := []struct {
+		expr    string
+		want    string
+		wantErr bool
+	}{
+		{expr: "", want: "0"},
+		{expr: "1 + 2 * 3", want: "7"},
+		{expr: "(1 + 2) * 3", want: "9"},
+		{expr: "-2 ** 2", want: "4"},
+		{expr: "2 ** 3 ** 2", want: "512"},
+		{expr: "7 / 2 + 7 % 2", want: "4"},
+		{expr: "1 < 2 && 2 <= 1 || 3 == 3", want: "1"},
+		{expr: "!0 + ~0", want: "0"},
+		{expr: "1 << 4 | 3 & 1 ^ 2", want: "19"},
+		{expr: "N * 2", want: "14"},
+		{expr: "$N + ${N}", want: "14"},
+		{expr: "HEX + 010 + 0x1f", want: "55"},
+		{expr: "UNSET + 1", want: "1"},
+		{expr: "1 / 0", wantErr: true},
+		{expr: "2 ** -1", wantErr: true},
+		{expr: "1 +", wantErr: true},
+		{expr: "(1", wantErr: true},
+		{expr: "1 2", wantErr: true},
+		{expr: "WORD + 1", wantErr: true},
+		{expr: "1 @ 2", wantErr: true},
+		{expr: "N > 5 ? 10 : 20", want: "10"},
+		{expr: "0 ? 1 : 0 ? 2 : 3", want: "3"},
+		{expr: "1 ? 2", wantErr: true},
+		{expr: "0 && 1 / 0", want: "0"},
+		{expr: "1 || 1 / 0", want: "1"},
+		{expr: "1 ? 5 : 1 / 0", want: "5"},
+		{expr: "0 ? 1 / 0 : 6", want: "6"},
+		{expr: "5 = 1", wantErr: true},
+		{expr: "$N = 1", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := term.evalArithmetic(tt.expr)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("evalArithmetic(%q) = %q, ожидалась ошибка", tt.expr, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("evalArithmetic(%q) = %q, %v; ожидалось %q", tt.expr, got, err, tt.want)
+		}
+	}
+}
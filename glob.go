@@ -0,0 +1,288 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// shellWord - аргумент команды после разбора кавычек и подстановок
+type shellWord struct {
+	text    string // Значение аргумента без кавычек
+	pattern string // Шаблон для раскрытия: метасимволы из кавычек экранированы '\'
+	hasGlob bool   // Есть ли в аргументе метасимволы *, ? или [ вне кавычек
+	err     error  // Ошибка раскрытия слова ($((1/0))): команда не выполняется
+}
+
+// isGlobMeta проверяет, является ли символ метасимволом шаблона
+func isGlobMeta(r rune) bool {
+	return r == '*' || r == '?' || r == '[' || r == ']' || r == '\\'
+}
+
+// hasGlobMeta проверяет наличие неэкранированных метасимволов в части шаблона
+func hasGlobMeta(pattern string) bool {
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '*' || r == '?' || r == '[':
+			return true
+		}
+	}
+	return false
+}
+
+// unescapeGlob убирает экранирование из части шаблона без метасимволов
+func unescapeGlob(pattern string) string {
+	var result strings.Builder
+	escaped := false
+	for _, r := range pattern {
+		if r == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		result.WriteRune(r)
+	}
+	return result.String()
+}
+
+// expandWords раскрывает слова команды в аргументы, включая шаблоны путей
+func (t *Terminal) expandWords(raw []string) ([]string, error) {
+	var args []string
+	for _, word := range t.expandRawWords(raw) {
+		if word.err != nil {
+			return nil, word.err
+		}
+		if !word.hasGlob {
+			args = append(args, word.text)
+			continue
+		}
+
+		matches, err := expandGlob(word.pattern, t.options["dotglob"])
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			// Как в zsh: по умолчанию отсутствие совпадений - ошибка
+			if t.options["nomatch"] {
+				return nil, fmt.Errorf("нет совпадений: %s", word.text)
+			}
+			args = append(args, word.text)
+			continue
+		}
+		args = append(args, matches...)
+	}
+	return args, nil
+}
+
+// expandGlob раскрывает шаблон пути с поддержкой *, ?, [...] и рекурсивного **/.
+// Скрытые файлы совпадают, только если часть шаблона начинается с точки или включен dotglob
+func expandGlob(pattern string, dotglob bool) ([]string, error) {
+	mustDir := strings.HasSuffix(pattern, "/")
+	pattern = strings.TrimRight(pattern, "/")
+
+	bases := []string{""}
+	if strings.HasPrefix(pattern, "/") {
+		bases = []string{"/"}
+		pattern = strings.TrimLeft(pattern, "/")
+	}
+
+	parts := strings.Split(pattern, "/")
+	for i, part := range parts {
+		last := i == len(parts)-1
+		var next []string
+
+		switch {
+		case part == "":
+			// Двойной слэш в шаблоне
+			next = bases
+
+		case part == "**" && !last:
+			// Ноль или больше вложенных директорий
+			for _, base := range bases {
+				next = append(next, base)
+				next = append(next, walkDirs(base, dotglob)...)
+			}
+
+		case !hasGlobMeta(part):
+			// Обычная часть пути - просто дописываем
+			name := unescapeGlob(part)
+			for _, base := range bases {
+				next = append(next, joinGlobPath(base, name))
+			}
+
+		default:
+			if part == "**" {
+				// "**" в конце шаблона работает как "*"
+				part = "*"
+			}
+			if _, err := filepath.Match(part, ""); err != nil {
+				return nil, fmt.Errorf("неверный шаблон: %s", pattern)
+			}
+			for _, base := range bases {
+				dir := base
+				if dir == "" {
+					dir = "."
+				}
+				entries, err := os.ReadDir(dir)
+				if err != nil {
+					continue
+				}
+				for _, entry := range entries {
+					name := entry.Name()
+					if strings.HasPrefix(name, ".") && !dotglob && !strings.HasPrefix(part, ".") {
+						continue
+					}
+					if matched, _ := filepath.Match(part, name); !matched {
+						continue
+					}
+					path := joinGlobPath(base, name)
+					if !last && !isDir(path) {
+						continue
+					}
+					next = append(next, path)
+				}
+			}
+		}
+
+		bases = next
+		if len(bases) == 0 {
+			return nil, nil
+		}
+	}
+
+	var matches []string
+	seen := make(map[string]bool)
+	for _, path := range bases {
+		if path == "" || seen[path] {
+			continue
+		}
+		if _, err := os.Lstat(path); err != nil {
+			continue
+		}
+		if mustDir {
+			if !isDir(path) {
+				continue
+			}
+			path += "/"
+		}
+		seen[path] = true
+		matches = append(matches, path)
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// walkDirs возвращает все вложенные директории base (без перехода по символическим ссылкам)
+func walkDirs(base string, dotglob bool) []string {
+	dir := base
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var dirs []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if strings.HasPrefix(entry.Name(), ".") && !dotglob {
+			continue
+		}
+		path := joinGlobPath(base, entry.Name())
+		dirs = append(dirs, path)
+		dirs = append(dirs, walkDirs(path, dotglob)...)
+	}
+	return dirs
+}
+
+func joinGlobPath(base, name string) string {
+	switch base {
+	case "":
+		return name
+	case "/":
+		return "/" + name
+	}
+	return base + "/" + name
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// shellOptions - опции терминала, управляемые командой set, и их значения по умолчанию
+var shellOptions = []struct {
+	name  string
+	value bool
+	desc  string
+}{
+	{"nomatch", true, "ошибка, если шаблон пути ничего не нашел (иначе шаблон передается как есть)"},
+	{"dotglob", false, "шаблоны путей находят скрытые файлы"},
+	{"emacs", true, "редактирование строки ввода клавишами emacs"},
+	{"vi", false, "редактирование строки ввода в стиле vi"},
+}
+
+// defaultOptions возвращает опции терминала по умолчанию
+func defaultOptions() map[string]bool {
+	options := make(map[string]bool)
+	for _, opt := range shellOptions {
+		options[opt.name] = opt.value
+	}
+	return options
+}
+
+// processSetCommand включает (set -o имя) и выключает (set +o имя) опции терминала
+func (t *Terminal) processSetCommand(args []string) ([]LineSegment, int) {
+	if len(args) <= 2 {
+		// Без имени опции показываем текущие значения
+		var segments []LineSegment
+		for _, opt := range shellOptions {
+			state := "off"
+			if t.options[opt.name] {
+				state = "on"
+			}
+			line := fmt.Sprintf("%-10s %-3s  %s", opt.name, state, opt.desc)
+			segments = append(segments, LineSegment{Text: line, Style: tcell.StyleDefault.Foreground(tcell.ColorWhite)})
+		}
+		return segments, 0
+	}
+
+	var enable bool
+	switch args[1] {
+	case "-o":
+		enable = true
+	case "+o":
+		enable = false
+	default:
+		return []LineSegment{{Text: "Используйте: set -o имя | set +o имя", Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}, 1
+	}
+
+	name := args[2]
+	if _, known := t.options[name]; !known {
+		return []LineSegment{{Text: fmt.Sprintf("set: неизвестная опция '%s'", name), Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}, 1
+	}
+	t.options[name] = enable
+
+	// Режимы редактирования исключают друг друга, vi начинается с режима ввода
+	switch name {
+	case "vi":
+		t.options["emacs"] = !enable
+		t.vi = viState{}
+	case "emacs":
+		t.options["vi"] = !enable
+		t.vi = viState{}
+	}
+	return []LineSegment{}, 0
+}
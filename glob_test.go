@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// makeTree создает в каталоге файлы; имена, оканчивающиеся на '/', - каталоги
+func makeTree(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if name[len(name)-1] == '/' {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// chdir переходит в каталог на время теста
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	old, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(old) })
+}
+
+func TestExpandGlob(t *testing.T) {
+	dir := t.TempDir()
+	makeTree(t, dir, "a.go", "b.go", "c.txt", ".hidden.go", "sub/d.go", "sub/deep/e.go", "sub/.git/f.go", "other/")
+	chdir(t, dir)
+
+	tests := []struct {
+		pattern string
+		dotglob bool
+		want    []string
+	}{
+		{pattern: "*.go", want: []string{"a.go", "b.go"}},
+		{pattern: "*.go", dotglob: true, want: []string{".hidden.go", "a.go", "b.go"}},
+		{pattern: ".*.go", want: []string{".hidden.go"}},
+		{pattern: "?.txt", want: []string{"c.txt"}},
+		{pattern: "[ab].go", want: []string{"a.go", "b.go"}},
+		{pattern: "**/*.go", want: []string{"a.go", "b.go", "sub/d.go", "sub/deep/e.go"}},
+		{pattern: "**/*.go", dotglob: true, want: []string{".hidden.go", "a.go", "b.go", "sub/.git/f.go", "sub/d.go", "sub/deep/e.go"}},
+		{pattern: "sub/**", want: []string{"sub/d.go", "sub/deep"}},
+		{pattern: "*/", want: []string{"other/", "sub/"}},
+		{pattern: "sub/*/e.go", want: []string{"sub/deep/e.go"}},
+		{pattern: `\*.go`, want: nil},
+		{pattern: "*.rs", want: nil},
+		{pattern: dir + "/*.txt", want: []string{dir + "/c.txt"}},
+	}
+	for _, tt := range tests {
+		got, err := expandGlob(tt.pattern, tt.dotglob)
+		if err != nil {
+			t.Errorf("expandGlob(%q): %v", tt.pattern, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("expandGlob(%q, dotglob=%v) = %q, ожидалось %q", tt.pattern, tt.dotglob, got, tt.want)
+		}
+	}
+
+	if _, err := expandGlob("[a-.go", false); err == nil {
+		t.Error("expandGlob([a-.go): ожидалась ошибка неверного шаблона")
+	}
+}
+
+func TestExpandWordsNomatch(t *testing.T) {
+	dir := t.TempDir()
+	makeTree(t, dir, "a.go", "b c.go")
+	chdir(t, dir)
+	term := newTestTerminal()
+
+	tests := []struct {
+		words   []string
+		nomatch bool
+		want    []string
+		wantErr bool
+	}{
+		{words: []string{"ls", "*.go"}, nomatch: true, want: []string{"ls", "a.go", "b c.go"}},
+		{words: []string{"ls", "'*.go'"}, nomatch: true, want: []string{"ls", "*.go"}},
+		{words: []string{"ls", `"b c"*`}, nomatch: true, want: []string{"ls", "b c.go"}},
+		{words: []string{"ls", "*.rs"}, nomatch: true, wantErr: true},
+		{words: []string{"ls", "*.rs"}, nomatch: false, want: []string{"ls", "*.rs"}},
+	}
+	for _, tt := range tests {
+		term.options["nomatch"] = tt.nomatch
+		got, err := term.expandWords(tt.words)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("expandWords(%q): ожидалась ошибка, получено %q", tt.words, got)
+			}
+			continue
+		}
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("expandWords(%q, nomatch=%v) = %q, %v; ожидалось %q", tt.words, tt.nomatch, got, err, tt.want)
+		}
+	}
+}
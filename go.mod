@@ -5,13 +5,13 @@ go 1.24.4
 require (
 	github.com/creack/pty v1.1.24
 	github.com/gdamore/tcell/v2 v2.9.0
+	github.com/mattn/go-runewidth v0.0.16
 	golang.org/x/text v0.30.0
 )
 
 require (
 	github.com/gdamore/encoding v1.0.1 // indirect
 	github.com/lucasb-eyer/go-colorful v1.2.0 // indirect
-	github.com/mattn/go-runewidth v0.0.16 // indirect
 	github.com/rivo/uniseg v0.4.3 // indirect
 	golang.org/x/sys v0.35.0 // indirect
 	golang.org/x/term v0.34.0 // indirect
@@ -0,0 +1,621 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/creack/pty"
+	"github.com/gdamore/tcell/v2"
+)
+
+// execMode - способ запуска внешних команд
+type execMode int
+
+const (
+	execWait       execMode = iota // Дождаться завершения (подстановки $(...))
+	execForeground                 // Задание на переднем плане: интерфейс не блокируется
+	execBackground                 // Фоновое задание (команда &)
+)
+
+// statusPending - код "команда еще выполняется": список команд продолжится,
+// когда завершится задание переднего плана или wait
+const statusPending = -1
+
+// jobState - состояние задания
+type jobState int
+
+const (
+	jobRunning jobState = iota
+	jobStopped
+	jobDone
+)
+
+func (s jobState) String() string {
+	switch s {
+	case jobRunning:
+		return "Выполняется"
+	case jobStopped:
+		return "Остановлено"
+	}
+	return "Завершено"
+}
+
+// jobProcess - процесс задания. Каждая стадия запускается в своей сессии,
+// поэтому PID процесса - это и номер его группы процессов
+type jobProcess struct {
+	pid     int
+	process *os.Process
+	last    bool  // Последняя стадия конвейера: ее код - код задания
+	done    bool  // Процесс завершился
+	stopped bool  // Процесс остановлен сигналом
+	status  int   // Код завершения в стиле shell
+	err     error // Причина неуспешного завершения
+}
+
+// job - задание: внешние команды конвейера, работающие с общим PTY
+type job struct {
+	id              int // Номер в таблице заданий; 0 - задание переднего плана, еще не попавшее в таблицу
+	pgid            int // Группа процессов первой стадии, которой принадлежит терминал задания
+	cmdText         string
+	procs           []*jobProcess
+	state           jobState
+	status          int   // Код завершения задания
+	startErr        error // Ошибка запуска последней стадии
+	external        bool  // Последняя стадия - внешняя команда
+	stopSignal      syscall.Signal
+	pty             *os.File  // Ведущая сторона PTY: ввод с клавиатуры и вывод всех стадий
+	vt              *vtScreen // Экран задания
+	hadOutput       bool
+	outputDone      bool
+	builtinSegments []LineSegment // Вывод встроенной команды последней стадии
+}
+
+// post выполняет функцию в главном цикле: все изменения состояния терминала
+// из горутин заданий проходят через этот канал
+func (t *Terminal) post(fn func()) {
+	t.notify <- fn
+}
+
+// openJobPty создает PTY задания размером с область вывода и эмулятор его экрана.
+// Возвращает ведомую сторону PTY для стадий конвейера
+func (t *Terminal) openJobPty(j *job) (*os.File, error) {
+	ptmx, tty, err := pty.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	width, height := t.jobScreenSize()
+	if err := pty.Setsize(ptmx, &pty.Winsize{Rows: uint16(height), Cols: uint16(width)}); err != nil {
+		ptmx.Close()
+		tty.Close()
+		return nil, err
+	}
+
+	j.pty = ptmx
+	j.vt = newVTScreen(width, height, tcell.StyleDefault.Foreground(tcell.ColorWhite))
+	j.vt.reply = ptmx
+	return tty, nil
+}
+
+// resizeJobs подгоняет PTY и экраны всех выполняющихся заданий под размер области
+// вывода. Ядро посылает SIGWINCH группе, которой принадлежит терминал; остальные
+// стадии конвейера работают в своих сессиях, и им сигнал посылается явно
+func (t *Terminal) resizeJobs() {
+	width, height := t.jobScreenSize()
+	jobs := t.jobs
+	if t.fgJob != nil && t.fgJob.id == 0 {
+		jobs = append([]*job{t.fgJob}, jobs...)
+	}
+
+	for _, j := range jobs {
+		if j.state == jobDone || j.pty == nil {
+			continue
+		}
+		j.vt.resize(width, height)
+		if err := pty.Setsize(j.pty, &pty.Winsize{Rows: uint16(height), Cols: uint16(width)}); err != nil {
+			log.Printf("❌ Ошибка изменения размера PTY задания %d: %v", j.id, err)
+			continue
+		}
+		for _, p := range j.procs {
+			if !p.done && p.pid != j.pgid {
+				syscall.Kill(-p.pid, syscall.SIGWINCH)
+			}
+		}
+	}
+}
+
+// startJob начинает следить за запущенным заданием и делает его фоновым
+// или заданием переднего плана
+func (t *Terminal) startJob(j *job, mode execMode) ([]LineSegment, int) {
+	go t.readJobOutput(j)
+	for _, p := range j.procs {
+		go t.waitJobProcess(j, p)
+	}
+
+	if mode == execBackground {
+		t.addJob(j)
+		t.lastBgPid = j.procs[len(j.procs)-1].pid
+		log.Printf("🧵 Фоновое задание [%d], PGID: %d", j.id, j.pgid)
+		return []LineSegment{{Text: fmt.Sprintf("[%d] %d", j.id, j.pgid), Style: tcell.StyleDefault.Foreground(tcell.ColorTeal)}}, 0
+	}
+
+	log.Printf("🧵 Задание на переднем плане, PGID: %d", j.pgid)
+	t.attachJob(j)
+	return []LineSegment{}, statusPending
+}
+
+// readJobOutput читает вывод задания и передает его в главный цикл
+func (t *Terminal) readJobOutput(j *job) {
+	buffer := make([]byte, 4096)
+	for {
+		n, err := j.pty.Read(buffer)
+		if n > 0 {
+			chunk := append([]byte(nil), buffer[:n]...)
+			t.post(func() { t.jobOutput(j, chunk) })
+		}
+		if err != nil {
+			t.post(func() {
+				j.outputDone = true
+				t.checkJob(j)
+			})
+			return
+		}
+	}
+}
+
+// waitJobProcess ожидает изменений состояния процесса: остановки, продолжения и завершения
+func (t *Terminal) waitJobProcess(j *job, p *jobProcess) {
+	for {
+		var ws syscall.WaitStatus
+		_, err := syscall.Wait4(p.pid, &ws, syscall.WUNTRACED|syscall.WCONTINUED, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			log.Printf("❌ Ошибка ожидания процесса %d: %v", p.pid, err)
+			t.post(func() {
+				p.done, p.status, p.err = true, 1, err
+				t.checkJob(j)
+			})
+			return
+		}
+
+		t.post(func() { t.updateJobProcess(j, p, ws) })
+		if ws.Exited() || ws.Signaled() {
+			return
+		}
+	}
+}
+
+// jobOutput передает вывод задания эмулятору терминала
+func (t *Terminal) jobOutput(j *job, chunk []byte) {
+	if j.outputDone {
+		return
+	}
+	j.vt.Write(chunk)
+	j.hadOutput = true
+}
+
+// updateJobProcess применяет изменение состояния процесса, полученное от wait4
+func (t *Terminal) updateJobProcess(j *job, p *jobProcess, ws syscall.WaitStatus) {
+	switch {
+	case ws.Exited():
+		p.done, p.status = true, ws.ExitStatus()
+		if p.status != 0 {
+			p.err = fmt.Errorf("exit status %d", p.status)
+		}
+	case ws.Signaled():
+		p.done, p.status = true, 128+int(ws.Signal())
+		p.err = fmt.Errorf("signal: %v", ws.Signal())
+	case ws.Stopped():
+		p.stopped = true
+		j.stopSignal = ws.StopSignal()
+	case ws.Continued():
+		p.stopped = false
+	}
+	t.checkJob(j)
+}
+
+// checkJob пересчитывает состояние задания по состоянию его процессов
+func (t *Terminal) checkJob(j *job) {
+	if j.state == jobDone {
+		return
+	}
+
+	running, stopped := 0, 0
+	for _, p := range j.procs {
+		switch {
+		case p.done:
+		case p.stopped:
+			stopped++
+		default:
+			running++
+		}
+	}
+
+	switch {
+	case running == 0 && stopped == 0:
+		if j.outputDone {
+			t.jobFinished(j)
+			return
+		}
+		// Вывод может удерживать процесс, запущенный заданием в фоне, - не ждем его дольше
+		time.AfterFunc(200*time.Millisecond, func() {
+			t.post(func() {
+				if j.state != jobDone && !j.outputDone {
+					j.outputDone = true
+					j.pty.Close()
+					t.checkJob(j)
+				}
+			})
+		})
+	case running == 0 && j.state == jobRunning:
+		t.jobStopped(j)
+	case stopped == 0 && j.state == jobStopped:
+		j.state = jobRunning
+	}
+}
+
+// attachJob делает задание заданием переднего плана: ему передается ввод с клавиатуры,
+// а его экран рисуется в области вывода
+func (t *Terminal) attachJob(j *job) {
+	t.fgJob = j
+	t.inPtyMode = true
+	t.ptmx = j.pty
+	j.state = jobRunning
+}
+
+// detachJob отключает задание переднего плана от клавиатуры
+func (t *Terminal) detachJob() {
+	t.fgJob = nil
+	t.inPtyMode = false
+	t.ptmx = nil
+}
+
+// jobFinished обрабатывает завершение всех процессов задания
+func (t *Terminal) jobFinished(j *job) {
+	j.state = jobDone
+	j.pty.Close()
+
+	// Код задания - код последней стадии конвейера
+	lastErr := j.startErr
+	for _, p := range j.procs {
+		p.process.Release()
+		if p.last {
+			j.status = p.status
+			lastErr = p.err
+		}
+	}
+	log.Printf("🏁 Задание завершено: %s, код %d", j.cmdText, j.status)
+	t.removeJob(j)
+
+	if t.fgJob == j {
+		t.detachJob()
+		segments := pipelineResult(j.vt.take(), j.builtinSegments, lastErr, j.external && !j.hadOutput)
+		t.running.segments = append(t.running.segments, segments...)
+		t.resumeRun(j.status)
+		return
+	}
+
+	if j.id != 0 {
+		// Уведомление о завершении фонового задания
+		state := "Готово"
+		style := tcell.StyleDefault.Foreground(tcell.ColorGreen)
+		if j.status != 0 {
+			state = fmt.Sprintf("Выход %d", j.status)
+			style = tcell.StyleDefault.Foreground(tcell.ColorRed)
+		}
+		segments := []LineSegment{{Text: fmt.Sprintf("[%d]+ %-12s %s", j.id, state, j.cmdText), Style: style}}
+		segments = append(segments, pipelineResult(j.vt.take(), j.builtinSegments, j.startErr, false)...)
+		t.outputLines = append(segments, t.outputLines...)
+	}
+
+	t.checkWait()
+}
+
+// jobStopped обрабатывает остановку задания (Ctrl+Z или сигнал)
+func (t *Terminal) jobStopped(j *job) {
+	j.state = jobStopped
+	if j.id == 0 {
+		t.addJob(j)
+	} else {
+		// Остановленное задание становится текущим
+		t.removeJob(j)
+		t.jobs = append(t.jobs, j)
+	}
+	log.Printf("⏸️  Задание [%d] остановлено", j.id)
+
+	notice := LineSegment{Text: fmt.Sprintf("[%d]+ %-12s %s", j.id, j.state, j.cmdText), Style: tcell.StyleDefault.Foreground(tcell.ColorYellow)}
+	if t.fgJob == j {
+		t.detachJob()
+		t.running.segments = append(t.running.segments, j.vt.take()...)
+		t.running.segments = append(t.running.segments, notice)
+		t.resumeRun(128 + int(j.stopSignal))
+		return
+	}
+	t.outputLines = append([]LineSegment{notice}, t.outputLines...)
+}
+
+// addJob добавляет задание в таблицу заданий
+func (t *Terminal) addJob(j *job) {
+	j.id = 1
+	for _, other := range t.jobs {
+		j.id = max(j.id, other.id+1)
+	}
+	t.jobs = append(t.jobs, j)
+}
+
+// removeJob удаляет задание из таблицы
+func (t *Terminal) removeJob(j *job) {
+	for i, other := range t.jobs {
+		if other == j {
+			t.jobs = append(t.jobs[:i], t.jobs[i+1:]...)
+			return
+		}
+	}
+}
+
+// signal отправляет сигнал группам процессов всех стадий задания
+func (j *job) signal(sig syscall.Signal) {
+	for _, p := range j.procs {
+		if !p.done {
+			syscall.Kill(-p.pid, sig)
+		}
+	}
+}
+
+// signalForegroundJob отправляет сигнал заданию переднего плана
+func (t *Terminal) signalForegroundJob(sig syscall.Signal) {
+	if t.fgJob != nil {
+		log.Printf("⚡ Сигнал %v заданию, PGID: %d", sig, t.fgJob.pgid)
+		t.fgJob.signal(sig)
+	}
+}
+
+// ttySignals - сигналы, которые драйвер терминала посылает по управляющим клавишам.
+// Вместо SIGTSTP задание останавливается SIGSTOP: стадии работают в своих сессиях,
+// их группы процессов осиротевшие, и SIGTSTP от драйвера ими игнорируется
+var ttySignals = map[tcell.Key]syscall.Signal{
+	tcell.KeyCtrlC:         syscall.SIGINT,
+	tcell.KeyCtrlZ:         syscall.SIGSTOP,
+	tcell.KeyCtrlBackslash: syscall.SIGQUIT,
+}
+
+// forwardTTYSignal дублирует сигнал управляющей клавиши стадиям конвейера:
+// драйвер PTY сигналит только группе процессов, которой принадлежит терминал
+func (t *Terminal) forwardTTYSignal(key tcell.Key) {
+	sig, ok := ttySignals[key]
+	j := t.fgJob
+	if !ok || j == nil || !ptySignalsEnabled(j.pty) {
+		return
+	}
+	for _, p := range j.procs {
+		if !p.done && (p.pid != j.pgid || sig == syscall.SIGSTOP) {
+			log.Printf("⚡ Сигнал %v группе %d", sig, p.pid)
+			syscall.Kill(-p.pid, sig)
+		}
+	}
+}
+
+// ptySignalsEnabled проверяет, включен ли у терминала режим ISIG: в raw-режиме
+// (vim, less) Ctrl+C и Ctrl+Z - обычные клавиши программы
+func ptySignalsEnabled(f *os.File) bool {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return false
+	}
+	var termios syscall.Termios
+	var errno syscall.Errno
+	conn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCGETS, uintptr(unsafe.Pointer(&termios)))
+	})
+	return errno == 0 && termios.Lflag&syscall.ISIG != 0
+}
+
+// findJob находит задание по спецификации: %N, %+, %%, %-, %строка, %?строка или номеру
+func (t *Terminal) findJob(spec string) (*job, error) {
+	if len(t.jobs) == 0 {
+		return nil, errors.New("нет заданий")
+	}
+
+	switch spec {
+	case "", "%", "%%", "%+":
+		return t.jobs[len(t.jobs)-1], nil
+	case "%-":
+		if len(t.jobs) < 2 {
+			return nil, fmt.Errorf("%s: нет такого задания", spec)
+		}
+		return t.jobs[len(t.jobs)-2], nil
+	}
+
+	name := strings.TrimPrefix(spec, "%")
+	if n, err := strconv.Atoi(name); err == nil {
+		for _, j := range t.jobs {
+			if j.id == n {
+				return j, nil
+			}
+		}
+		// Без '%' число может быть PID процесса задания
+		if !strings.HasPrefix(spec, "%") {
+			for _, j := range t.jobs {
+				for _, p := range j.procs {
+					if p.pid == n {
+						return j, nil
+					}
+				}
+			}
+		}
+		return nil, fmt.Errorf("%s: нет такого задания", spec)
+	}
+
+	for i := len(t.jobs) - 1; i >= 0; i-- {
+		j := t.jobs[i]
+		if sub, ok := strings.CutPrefix(name, "?"); ok {
+			if strings.Contains(j.cmdText, sub) {
+				return j, nil
+			}
+		} else if strings.HasPrefix(j.cmdText, name) {
+			return j, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: нет такого задания", spec)
+}
+
+// processJobsCommand показывает таблицу заданий
+func (t *Terminal) processJobsCommand(args []string) ([]LineSegment, int) {
+	showPids, onlyPids := false, false
+	for _, arg := range args[1:] {
+		switch arg {
+		case "-l":
+			showPids = true
+		case "-p":
+			onlyPids = true
+		default:
+			return []LineSegment{{Text: "Используйте: jobs [-l] [-p]", Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}, 1
+		}
+	}
+
+	var segments []LineSegment
+	for i, j := range t.jobs {
+		if onlyPids {
+			segments = append(segments, LineSegment{Text: strconv.Itoa(j.pgid), Style: tcell.StyleDefault.Foreground(tcell.ColorWhite)})
+			continue
+		}
+
+		mark := " "
+		switch i {
+		case len(t.jobs) - 1:
+			mark = "+"
+		case len(t.jobs) - 2:
+			mark = "-"
+		}
+		style := tcell.StyleDefault.Foreground(tcell.ColorGreen)
+		if j.state == jobStopped {
+			style = tcell.StyleDefault.Foreground(tcell.ColorYellow)
+		}
+
+		line := fmt.Sprintf("[%d]%s  %-12s %s", j.id, mark, j.state, j.cmdText)
+		if showPids {
+			line = fmt.Sprintf("[%d]%s %7d  %-12s %s", j.id, mark, j.pgid, j.state, j.cmdText)
+		}
+		segments = append(segments, LineSegment{Text: line, Style: style})
+	}
+	return segments, 0
+}
+
+// processFgCommand переводит задание на передний план
+func (t *Terminal) processFgCommand(args []string) ([]LineSegment, int) {
+	if t.subshellDepth > 0 {
+		return []LineSegment{{Text: "fg: нет управления заданиями", Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}, 1
+	}
+
+	spec := ""
+	if len(args) > 1 {
+		spec = args[1]
+	}
+	j, err := t.findJob(spec)
+	if err != nil {
+		return []LineSegment{{Text: fmt.Sprintf("fg: %s", err), Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}, 1
+	}
+
+	log.Printf("▶️  Задание [%d] на переднем плане", j.id)
+	if j.state == jobStopped {
+		j.signal(syscall.SIGCONT)
+	}
+	t.attachJob(j)
+	return []LineSegment{{Text: j.cmdText, Style: tcell.StyleDefault.Foreground(tcell.ColorGray)}}, statusPending
+}
+
+// processBgCommand продолжает остановленные задания в фоне
+func (t *Terminal) processBgCommand(args []string) ([]LineSegment, int) {
+	specs := args[1:]
+	if len(specs) == 0 {
+		specs = []string{""}
+	}
+
+	var segments []LineSegment
+	status := 0
+	for _, spec := range specs {
+		j, err := t.findJob(spec)
+		if err != nil {
+			segments = append(segments, LineSegment{Text: fmt.Sprintf("bg: %s", err), Style: tcell.StyleDefault.Foreground(tcell.ColorRed)})
+			status = 1
+			continue
+		}
+		if j.state != jobStopped {
+			segments = append(segments, LineSegment{Text: fmt.Sprintf("bg: задание %d уже выполняется в фоне", j.id), Style: tcell.StyleDefault.Foreground(tcell.ColorYellow)})
+			continue
+		}
+
+		log.Printf("▶️  Задание [%d] продолжено в фоне", j.id)
+		j.signal(syscall.SIGCONT)
+		j.state = jobRunning
+		segments = append(segments, LineSegment{Text: fmt.Sprintf("[%d]+ %s &", j.id, j.cmdText), Style: tcell.StyleDefault.Foreground(tcell.ColorTeal)})
+	}
+	return segments, status
+}
+
+// processWaitCommand ждет завершения фоновых заданий. Без аргументов ждет все
+// выполняющиеся задания и возвращает 0, иначе - код последнего из указанных
+func (t *Terminal) processWaitCommand(args []string) ([]LineSegment, int) {
+	if t.subshellDepth > 0 {
+		return []LineSegment{}, 0
+	}
+
+	var targets []*job
+	if len(args) == 1 {
+		for _, j := range t.jobs {
+			if j.state == jobRunning {
+				targets = append(targets, j)
+			}
+		}
+	}
+	for _, spec := range args[1:] {
+		j, err := t.findJob(spec)
+		if err != nil {
+			return []LineSegment{{Text: fmt.Sprintf("wait: %s", err), Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}, 127
+		}
+		targets = append(targets, j)
+	}
+
+	if len(targets) == 0 {
+		return []LineSegment{}, 0
+	}
+	t.waitJobs = targets
+	t.waitAll = len(args) == 1
+	return []LineSegment{}, statusPending
+}
+
+// checkWait продолжает выполнение команды wait, когда все ожидаемые задания завершились
+func (t *Terminal) checkWait() {
+	if t.waitJobs == nil {
+		return
+	}
+	for _, j := range t.waitJobs {
+		if j.state != jobDone {
+			return
+		}
+	}
+
+	status := 0
+	if !t.waitAll {
+		status = t.waitJobs[len(t.waitJobs)-1].status
+	}
+	t.waitJobs = nil
+	t.resumeRun(status)
+}
+
+// cancelWait прерывает ожидание заданий (Ctrl+C во время wait)
+func (t *Terminal) cancelWait() {
+	if t.waitJobs != nil {
+		t.waitJobs = nil
+		t.resumeRun(128 + int(syscall.SIGINT))
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// tokenKind - тип лексемы командной строки
+type tokenKind int
+
+const (
+	tokenWord       tokenKind = iota // Слово: имя команды или аргумент
+	tokenAssignment                  // Присваивание ИМЯ=значение перед именем команды
+	tokenOperator                    // Оператор: ;, &&, ||, | или &
+	tokenRedirect                    // Оператор перенаправления: <, >, >>, >&, &>
+)
+
+// token - лексема командной строки
+type token struct {
+	kind  tokenKind
+	text  string // Исходный текст слова вместе с кавычками или текст оператора
+	fd    int    // Для перенаправлений: дескриптор 0, 1, 2 или -1 для &>
+	start int    // Позиция начала лексемы в строке (в рунах)
+	end   int    // Позиция сразу после лексемы
+}
+
+// errIncompleteInput означает, что команда не закончена: незакрытая кавычка,
+// подстановка или '\' в конце строки. Терминал запрашивает продолжение ввода
+var errIncompleteInput = errors.New("незавершенный ввод: незакрытая кавычка или '\\' в конце строки")
+
+// isIncompleteInput проверяет, нужно ли запросить продолжение команды
+func isIncompleteInput(input string) bool {
+	_, err := lex(input)
+	return errors.Is(err, errIncompleteInput)
+}
+
+// lex разбивает командную строку на лексемы. Кавычки, экранирование и подстановки
+// остаются в тексте слов - их обрабатывает expandWord. При незавершенном вводе
+// остаток строки возвращается последним словом вместе с errIncompleteInput
+func lex(input string) ([]token, error) {
+	runes := []rune(input)
+	var tokens []token
+	commandStart := true // Следующее слово может быть присваиванием
+
+	emit := func(kind tokenKind, start, end, fd int) {
+		tokens = append(tokens, token{kind: kind, text: string(runes[start:end]), fd: fd, start: start, end: end})
+	}
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		next := rune(0)
+		if i+1 < len(runes) {
+			next = runes[i+1]
+		}
+
+		switch {
+		case r == ' ' || r == '\t':
+			i++
+
+		case r == '\\' && next == '\n':
+			// '\' в конце строки - команда продолжается на следующей строке
+			i += 2
+
+		case r == '\n':
+			// Перевод строки разделяет команды, как ';'.
+			// После операторов (&&, ||, |) команда продолжается на следующей строке
+			if n := len(tokens); n > 0 && tokens[n-1].kind != tokenOperator {
+				tokens = append(tokens, token{kind: tokenOperator, text: ";", start: i, end: i + 1})
+				commandStart = true
+			}
+			i++
+
+		case r == '#':
+			// Комментарий до конца строки
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+
+		case r == ';':
+			emit(tokenOperator, i, i+1, 0)
+			commandStart = true
+			i++
+
+		case (r == '&' && next == '&') || (r == '|' && next == '|'):
+			emit(tokenOperator, i, i+2, 0)
+			commandStart = true
+			i += 2
+
+		case r == '&' && next == '>':
+			// &> и &>> - stdout и stderr в один файл
+			end := i + 2
+			if end < len(runes) && runes[end] == '>' {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenRedirect, text: string(runes[i+1 : end]), fd: -1, start: i, end: end})
+			i = end
+
+		case r == '&' || r == '|':
+			emit(tokenOperator, i, i+1, 0)
+			commandStart = true
+			i++
+
+		case r == '<' || r == '>':
+			i = lexRedirect(runes, i, i, -1, &tokens)
+
+		default:
+			end, err := scanWord(runes, i)
+			if err != nil {
+				emit(tokenWord, i, len(runes), 0)
+				return tokens, err
+			}
+
+			// Одиночная цифра перед '<' или '>' - номер дескриптора: 2>, 1>>, 0<
+			if end == i+1 && r >= '0' && r <= '9' && end < len(runes) && (runes[end] == '<' || runes[end] == '>') {
+				fd, _ := strconv.Atoi(string(r))
+				i = lexRedirect(runes, i, end, fd, &tokens)
+				continue
+			}
+
+			word := string(runes[i:end])
+			if commandStart && isAssignmentWord(word) {
+				emit(tokenAssignment, i, end, 0)
+			} else {
+				emit(tokenWord, i, end, 0)
+				commandStart = false
+			}
+			i = end
+		}
+	}
+
+	return tokens, nil
+}
+
+// lexRedirect добавляет лексему перенаправления, оператор которого начинается в позиции op.
+// Если fd < 0, дескриптор определяется оператором. Возвращает позицию после оператора
+func lexRedirect(runes []rune, start, op, fd int, tokens *[]token) int {
+	end := op + 1
+	if runes[op] == '>' && end < len(runes) && (runes[end] == '>' || runes[end] == '&') {
+		end++
+	}
+	if fd < 0 {
+		fd = 0
+		if runes[op] == '>' {
+			fd = 1
+		}
+	}
+	*tokens = append(*tokens, token{kind: tokenRedirect, text: string(runes[op:end]), fd: fd, start: start, end: end})
+	return end
+}
+
+// scanWord находит конец слова, начинающегося в позиции i, с учетом кавычек,
+// экранирования и подстановок
+func scanWord(runes []rune, i int) (int, error) {
+	for i < len(runes) {
+		r := runes[i]
+		switch {
+		case r == ' ' || r == '\t' || r == '\n' || r == ';' || r == '&' || r == '|' || r == '<' || r == '>':
+			return i, nil
+
+		case r == '\\':
+			if i+1 >= len(runes) {
+				return i, errIncompleteInput
+			}
+			i += 2
+
+		case r == '\'':
+			j := i + 1
+			for j < len(runes) && runes[j] != '\'' {
+				j++
+			}
+			if j >= len(runes) {
+				return i, errIncompleteInput
+			}
+			i = j + 1
+
+		case r == '$' && i+1 < len(runes) && runes[i+1] == '\'':
+			// $'...' - строка с escape-последовательностями C
+			j := i + 2
+			for j < len(runes) && runes[j] != '\'' {
+				if runes[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(runes) {
+				return i, errIncompleteInput
+			}
+			i = j + 1
+
+		case r == '$' && i+1 < len(runes) && runes[i+1] == '{':
+			end := braceVarEnd(runes, i+1)
+			if end < 0 {
+				return i, errIncompleteInput
+			}
+			i = end
+
+		case r == '"':
+			j := i + 1
+			for j < len(runes) && runes[j] != '"' {
+				switch {
+				case runes[j] == '\\':
+					j += 2
+				case isSubstitutionStart(runes, j):
+					end := substitutionEnd(runes, j)
+					if end < 0 {
+						return i, errIncompleteInput
+					}
+					j = end
+				default:
+					j++
+				}
+			}
+			if j >= len(runes) {
+				return i, errIncompleteInput
+			}
+			i = j + 1
+
+		case isSubstitutionStart(runes, i):
+			end := substitutionEnd(runes, i)
+			if end < 0 {
+				return i, errIncompleteInput
+			}
+			i = end
+
+		default:
+			i++
+		}
+	}
+	return i, nil
+}
+
+// braceVarEnd возвращает позицию после '}', закрывающей '{' в позиции i, или -1
+func braceVarEnd(runes []rune, i int) int {
+	depth := 0
+	for j := i; j < len(runes); j++ {
+		switch runes[j] {
+		case '\\':
+			j++
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return j + 1
+			}
+		}
+	}
+	return -1
+}
+
+// isAssignmentWord проверяет, имеет ли слово вид ИМЯ=значение
+func isAssignmentWord(word string) bool {
+	i := strings.IndexRune(word, '=')
+	return i > 0 && isValidVarName(word[:i])
+}
+
+// decodeANSIC раскрывает содержимое $'...', начиная с позиции start.
+// Возвращает строку и позицию после закрывающей кавычки
+func decodeANSIC(runes []rune, start int) (string, int) {
+	var result strings.Builder
+	i := start
+	for ; i < len(runes) && runes[i] != '\''; i++ {
+		if runes[i] != '\\' || i+1 >= len(runes) {
+			result.WriteRune(runes[i])
+			continue
+		}
+
+		i++
+		switch c := runes[i]; c {
+		case 'n':
+			result.WriteRune('\n')
+		case 't':
+			result.WriteRune('\t')
+		case 'r':
+			result.WriteRune('\r')
+		case 'a':
+			result.WriteRune('\a')
+		case 'b':
+			result.WriteRune('\b')
+		case 'f':
+			result.WriteRune('\f')
+		case 'v':
+			result.WriteRune('\v')
+		case 'e', 'E':
+			result.WriteRune(0x1b)
+		case 'c':
+			// \cX - управляющий символ Ctrl+X
+			if i+1 < len(runes) {
+				i++
+				result.WriteRune(runes[i] & 0x1f)
+			}
+		case 'x', 'u', 'U', '0', '1', '2', '3', '4', '5', '6', '7':
+			// Числовые коды: \xHH, \uHHHH, \UHHHHHHHH, \NNN
+			base, maxDigits, from := 16, 2, i+1
+			switch c {
+			case 'u':
+				maxDigits = 4
+			case 'U':
+				maxDigits = 8
+			default:
+				if c != 'x' {
+					base, maxDigits, from = 8, 3, i
+				}
+			}
+			j := from
+			for j < len(runes) && j-from < maxDigits && isDigitInBase(runes[j], base) {
+				j++
+			}
+			if j == from {
+				result.WriteRune('\\')
+				result.WriteRune(c)
+				continue
+			}
+			code, _ := strconv.ParseInt(string(runes[from:j]), base, 32)
+			if c == 'x' || base == 8 {
+				result.WriteByte(byte(code))
+			} else {
+				result.WriteRune(rune(code))
+			}
+			i = j - 1
+		case '\\', '\'', '"', '?':
+			result.WriteRune(c)
+		default:
+			result.WriteRune('\\')
+			result.WriteRune(c)
+		}
+	}
+	return result.String(), i + 1
+}
+
+func isDigitInBase(r rune, base int) bool {
+	_, err := strconv.ParseInt(string(r), base, 32)
+	return err == nil
+}
+
+// shellQuote заключает слово в одинарные кавычки, если в нем есть символы,
+// которые командная строка иначе разобрала бы
+func shellQuote(word string) string {
+	if word != "" && strings.IndexFunc(word, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("@%+=:,./_-", r))
+	}) < 0 {
+		return word
+	}
+	return "'" + strings.ReplaceAll(word, "'", `'\''`) + "'"
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// tokenStrings записывает лексемы коротко: W - слово, A - присваивание,
+// O - оператор, R<fd> - перенаправление
+func tokenStrings(tokens []token) []string {
+	var result []string
+	for _, tok := range tokens {
+		switch tok.kind {
+		case tokenWord:
+			result = append(result, "W:"+tok.text)
+		case tokenAssignment:
+			result = append(result, "A:"+tok.text)
+		case tokenOperator:
+			result = append(result, "O:"+tok.text)
+		case tokenRedirect:
+			result = append(result, fmt.Sprintf("R%d:%s", tok.fd, tok.text))
+		}
+	}
+	return result
+}
+
+func TestLex(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"echo hello  world", []string{"W:echo", "W:hello", "W:world"}},
+		{`echo "a b" 'c d' e\ f`, []string{"W:echo", `W:"a b"`, "W:'c d'", `W:e\ f`}},
+		{`echo "say \"hi\""`, []string{"W:echo", `W:"say \"hi\""`}},
+		{`echo 'a\'`, []string{"W:echo", `W:'a\'`}},
+		{`echo $'it\'s'`, []string{"W:echo", `W:$'it\'s'`}},
+		{"echo $(echo a; echo b) `date`", []string{"W:echo", "W:$(echo a; echo b)", "W:`date`"}},
+		{`echo "$(echo ")")"`, []string{"W:echo", `W:"$(echo ")")"`}},
+		{"echo ${A:-x y}", []string{"W:echo", "W:${A:-x y}"}},
+		{"X=1 Y='a b' cmd Z=2", []string{"A:X=1", "A:Y='a b'", "W:cmd", "W:Z=2"}},
+		{"a; b && c || d | e & f", []string{"W:a", "O:;", "W:b", "O:&&", "W:c", "O:||", "W:d", "O:|", "W:e", "O:&", "W:f"}},
+		{"a;b&&c", []string{"W:a", "O:;", "W:b", "O:&&", "W:c"}},
+		{"cmd <in >out 2>err >>log", []string{"W:cmd", "R0:<", "W:in", "R1:>", "W:out", "R2:>", "W:err", "R1:>>", "W:log"}},
+		{"cmd 2>&1 >&2 &>all &>>both", []string{"W:cmd", "R2:>&", "W:1", "R1:>&", "W:2", "R-1:>", "W:all", "R-1:>>", "W:both"}},
+		{"cmd 12>x", []string{"W:cmd", "W:12", "R1:>", "W:x"}},
+		{"echo a # comment ; b", []string{"W:echo", "W:a"}},
+		{"echo a#b", []string{"W:echo", "W:a#b"}},
+		{"a\nb", []string{"W:a", "O:;", "W:b"}},
+		{"a &&\nb", []string{"W:a", "O:&&", "W:b"}},
+		{"echo a \\\nb", []string{"W:echo", "W:a", "W:b"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		tokens, err := lex(tt.input)
+		if err != nil {
+			t.Errorf("lex(%q): %v", tt.input, err)
+			continue
+		}
+		if got := tokenStrings(tokens); !slices.Equal(got, tt.want) {
+			t.Errorf("lex(%q) = %q, ожидалось %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestLexPositions(t *testing.T) {
+	tokens, err := lex("ф 'б в'>г")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][2]int{{0, 1}, {2, 7}, {7, 8}, {8, 9}}
+	for i, tok := range tokens {
+		if i >= len(want) || tok.start != want[i][0] || tok.end != want[i][1] {
+			t.Errorf("лексема %d %q: позиции %d..%d", i, tok.text, tok.start, tok.end)
+		}
+	}
+}
+
+func TestLexIncomplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		lastWord string
+	}{
+		{`echo "abc`, `"abc`},
+		{"echo 'abc", "'abc"},
+		{`echo abc\`, `abc\`},
+		{"echo $(date", "$(date"},
+		{"echo `date", "`date"},
+		{"echo ${HOME", "${HOME"},
+		{`echo $'a`, `$'a`},
+		{`echo "$(echo ")"`, `"$(echo ")"`},
+	}
+	for _, tt := range tests {
+		tokens, err := lex(tt.input)
+		if !errors.Is(err, errIncompleteInput) {
+			t.Errorf("lex(%q): ошибка %v, ожидалась errIncompleteInput", tt.input, err)
+			continue
+		}
+		if len(tokens) == 0 || tokens[len(tokens)-1].text != tt.lastWord {
+			t.Errorf("lex(%q): последнее слово %q, ожидалось %q", tt.input, tokenStrings(tokens), tt.lastWord)
+		}
+		if !isIncompleteInput(tt.input) {
+			t.Errorf("isIncompleteInput(%q) = false", tt.input)
+		}
+	}
+	if isIncompleteInput(`echo "done"`) {
+		t.Error(`isIncompleteInput("echo \"done\"") = true`)
+	}
+}
+
+func TestDecodeANSIC(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`a\nb\tc'`, "a\nb\tc"},
+		{`\x41\x4a'`, "AJ"},
+		{`\101\0'`, "A\x00"},
+		{`ж\U0001F600'`, "ж😀"},
+		{`\e[1m\E'`, "\x1b[1m\x1b"},
+		{`\cA\ca'`, "\x01\x01"},
+		{`\'\"\\\?'`, `'"\?`},
+		{`\q\x'`, `\q\x`},
+		{`no end`, "no end"},
+	}
+	for _, tt := range tests {
+		runes := []rune(tt.body)
+		got, next := decodeANSIC(runes, 0)
+		if got != tt.want {
+			t.Errorf("decodeANSIC(%q) = %q, ожидалось %q", tt.body, got, tt.want)
+		}
+		if next != len(runes) && next != len(runes)+1 {
+			t.Errorf("decodeANSIC(%q): позиция %d", tt.body, next)
+		}
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		word string
+		want string
+	}{
+		{"plain-word_1.go", "plain-word_1.go"},
+		{"user@host:/path", "user@host:/path"},
+		{"", "''"},
+		{"a b", "'a b'"},
+		{"it's", `'it'\''s'`},
+		{"$HOME", "'$HOME'"},
+		{"*.go", "'*.go'"},
+		{"привет", "'привет'"},
+	}
+	for _, tt := range tests {
+		got := shellQuote(tt.word)
+		if got != tt.want {
+			t.Errorf("shellQuote(%q) = %q, ожидалось %q", tt.word, got, tt.want)
+		}
+		// Процитированное слово разбирается обратно в одно слово с тем же значением
+		term := newTestTerminal()
+		if args := term.parseArgs(got); len(args) != 1 || args[0] != tt.word {
+			t.Errorf("parseArgs(shellQuote(%q)) = %q", tt.word, args)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// linkPattern находит в тексте URL, ссылки на файл с номером строки (main.go:12:5)
+// и пути, содержащие '/'
+var linkPattern = regexp.MustCompile(`(?:https?|ftp)://[^\s<>"'` + "`" + `]+|(?:[~.]{0,2}/)?(?:[\w.+\-]+/)*[\w.+\-]+:\d+(?::\d+)?|(?:~|\.{1,2})?/[\w.+\-/]+`)
+
+// fileRefPattern отделяет путь от номера строки и столбца
+var fileRefPattern = regexp.MustCompile(`^(.*?)(?::(\d+(?::\d+)?))?$`)
+
+// hintLabels - метки ссылок в режиме подсказок
+const hintLabels = "asdfghjklqwertyuiopzxcvbnm"
+
+// linkStatTTL - сколько помнится, существует ли путь; linkStatLimit - размер кэша
+const (
+	linkStatTTL   = 5 * time.Second
+	linkStatLimit = 4096
+)
+
+// linkStat - результат проверки пути для detectLinks
+type linkStat struct {
+	exists  bool
+	checked time.Time
+}
+
+// linkStats - кэш проверок путей по абсолютному пути
+var linkStats = make(map[string]linkStat)
+
+// linkArea - гиперссылка, нарисованная на экране
+type linkArea struct {
+	x, y, width int
+	link        string
+}
+
+// detectLinks разбивает сегмент без гиперссылки на части, выделяя URL и пути
+// к существующим файлам. Относительные пути разрешаются от текущего каталога;
+// существование путей проверяется через кэш pathExists
+func detectLinks(segment LineSegment) []LineSegment {
+	if segment.Link != "" {
+		return []LineSegment{segment}
+	}
+
+	// Переносы в начале сегмента - пустые строки перед ним, они остаются в первой части
+	prefix := len(segment.Text) - len(strings.TrimLeft(segment.Text, "\n"))
+	var segments []LineSegment
+	add := func(text, link string) {
+		part := segment
+		part.Text, part.Link, part.Inline = text, link, segment.Inline || len(segments) > 0
+		segments = append(segments, part)
+	}
+
+	last := 0
+	for _, match := range linkPattern.FindAllStringIndex(segment.Text[prefix:], -1) {
+		start := match[0] + prefix
+		text := strings.TrimRight(segment.Text[start:match[1]+prefix], ".,;:!?)]}")
+		link := textLink(text)
+		if link == "" {
+			continue
+		}
+
+		end := start + len(text)
+		if start == prefix {
+			start = 0
+		} else if start > last {
+			add(segment.Text[last:start], "")
+		}
+		add(segment.Text[start:end], link)
+		last = end
+	}
+
+	if len(segments) == 0 {
+		return []LineSegment{segment}
+	}
+	if last < len(segment.Text) {
+		add(segment.Text[last:], "")
+	}
+	return segments
+}
+
+// textLink возвращает ссылку для найденного в тексте URL или пути. Для файлов это
+// URL file:// с номером строки во фрагменте; пути к несуществующим файлам не ссылки
+func textLink(text string) string {
+	if strings.Contains(text, "://") {
+		return text
+	}
+
+	parts := fileRefPattern.FindStringSubmatch(text)
+	path := parts[1]
+	if rest, ok := strings.CutPrefix(path, "~"); ok {
+		home, _ := os.UserHomeDir()
+		path = home + rest
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return ""
+	}
+	if !pathExists(path) {
+		return ""
+	}
+	return (&url.URL{Scheme: "file", Path: path, Fragment: parts[2]}).String()
+}
+
+// pathExists проверяет, существует ли файл, запоминая результат на linkStatTTL:
+// detectLinks вызывается для каждой строки вывода, а одни и те же пути
+// (например, в выводе grep) повторяются во многих строках
+func pathExists(path string) bool {
+	now := time.Now()
+	if stat, ok := linkStats[path]; ok && now.Sub(stat.checked) < linkStatTTL {
+		return stat.exists
+	}
+	if len(linkStats) >= linkStatLimit {
+		clear(linkStats)
+	}
+	_, err := os.Stat(path)
+	linkStats[path] = linkStat{exists: err == nil, checked: now}
+	return err == nil
+}
+
+// addLinkArea запоминает положение нарисованной ссылки для мыши и режима подсказок
+func (t *Terminal) addLinkArea(x, y, width int, link string) {
+	if n := len(t.linkAreas); n > 0 {
+		prev := &t.linkAreas[n-1]
+		if prev.link == link && prev.y == y && prev.x+prev.width == x {
+			prev.width += width
+			return
+		}
+	}
+	t.linkAreas = append(t.linkAreas, linkArea{x: x, y: y, width: width, link: link})
+}
+
+// linkAt возвращает ссылку в позиции экрана
+func (t *Terminal) linkAt(x, y int) string {
+	for _, area := range t.linkAreas {
+		if area.y == y && x >= area.x && x < area.x+area.width {
+			return area.link
+		}
+	}
+	return ""
+}
+
+// hintAreas возвращает ссылки, которым в режиме подсказок достаются метки.
+// Ссылка, перенесенная на несколько строк, получает одну метку
+func (t *Terminal) hintAreas() []linkArea {
+	var areas []linkArea
+	for _, area := range t.linkAreas {
+		if n := len(areas); n > 0 && areas[n-1].link == area.link && area.y == areas[n-1].y+1 && area.x == t.outputX() {
+			continue
+		}
+		areas = append(areas, area)
+		if len(areas) == len(hintLabels) {
+			break
+		}
+	}
+	return areas
+}
+
+// outputX возвращает левый край области вывода
+func (t *Terminal) outputX() int {
+	x, _, _, _ := t.outputArea()
+	return x
+}
+
+// drawHints рисует метки ссылок в режиме подсказок
+func (t *Terminal) drawHints() {
+	style := tcell.StyleDefault.Foreground(tcell.ColorBlack).Background(tcell.ColorYellow).Bold(true)
+	for i, area := range t.hintAreas() {
+		t.screen.SetContent(area.x, area.y, rune(hintLabels[i]), nil, style)
+	}
+}
+
+// handleHintKey обрабатывает клавишу в режиме подсказок: метка открывает ссылку,
+// любая другая клавиша выходит из режима
+func (t *Terminal) handleHintKey(ev *tcell.EventKey) {
+	t.hintMode = false
+	if ev.Key() != tcell.KeyRune {
+		return
+	}
+	areas := t.hintAreas()
+	if i := strings.IndexRune(hintLabels, ev.Rune()); i >= 0 && i < len(areas) {
+		t.openLink(areas[i].link)
+	}
+}
+
+// openLink открывает ссылку: файл с номером строки - в $VISUAL или $EDITOR на этой
+// строке, остальное - через xdg-open. Редактор запускается заданием переднего плана
+// в обход командной строки: ввод и история не меняются
+func (t *Terminal) openLink(link string) {
+	log.Printf("🔗 Открываем ссылку: %s", link)
+
+	u, err := url.Parse(link)
+	if err == nil && u.Scheme == "file" && u.Fragment != "" {
+		if _, err := os.Stat(u.Path); err != nil {
+			t.outputLines = append([]LineSegment{{Text: fmt.Sprintf("Ошибка: %v", err), Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}, t.outputLines...)
+			return
+		}
+		editor, _ := t.lookupVar("VISUAL")
+		if editor == "" {
+			editor, _ = t.lookupVar("EDITOR")
+		}
+		line, _, _ := strings.Cut(u.Fragment, ":")
+		t.startArgsRun(editorArgs(t.parseArgs(editor), u.Path, line))
+		return
+	}
+
+	// Ссылки file:// от ls --hyperlink содержат имя хоста
+	if err == nil && u.Scheme == "file" {
+		link = u.Path
+	}
+
+	cmd := exec.Command("xdg-open", link)
+	cmd.Env = t.environ()
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		t.outputLines = append([]LineSegment{{Text: fmt.Sprintf("Ошибка: не удалось открыть %s: %v", link, err), Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}, t.outputLines...)
+		return
+	}
+	go cmd.Wait()
+}
+
+// editorArgs возвращает команду открытия файла path на строке line редактором editor
+// (слова $VISUAL или $EDITOR; без них - vi). Номер строки передается так, как его
+// понимает редактор; редакторам с неизвестным синтаксисом передается только файл
+func editorArgs(editor []string, path, line string) []string {
+	if len(editor) == 0 {
+		editor = []string{"vi"}
+	}
+	args := slices.Clone(editor)
+	switch filepath.Base(editor[0]) {
+	case "vi", "vim", "nvim", "view", "gvim", "nano", "pico", "emacs", "emacsclient", "micro", "kak", "joe", "mg", "ne", "jed", "mcedit":
+		return append(args, "+"+line, path)
+	case "code", "code-insiders", "codium", "cursor":
+		return append(args, "--goto", path+":"+line)
+	case "subl", "zed", "hx", "helix", "gedit":
+		return append(args, path+":"+line)
+	case "kate":
+		return append(args, "--line", line, path)
+	}
+	return append(args, path)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestEditorArgs(t *testing.T) {
+	tests := []struct {
+		editor []string
+		want   []string
+	}{
+		{nil, []string{"vi", "+12", "/tmp/a b.go"}},
+		{[]string{"nvim"}, []string{"nvim", "+12", "/tmp/a b.go"}},
+		{[]string{"/usr/bin/emacsclient", "-t"}, []string{"/usr/bin/emacsclient", "-t", "+12", "/tmp/a b.go"}},
+		{[]string{"code", "--wait"}, []string{"code", "--wait", "--goto", "/tmp/a b.go:12"}},
+		{[]string{"hx"}, []string{"hx", "/tmp/a b.go:12"}},
+		{[]string{"kate"}, []string{"kate", "--line", "12", "/tmp/a b.go"}},
+		{[]string{"ed"}, []string{"ed", "/tmp/a b.go"}},
+	}
+	for _, tt := range tests {
+		if got := editorArgs(tt.editor, "/tmp/a b.go", "12"); !slices.Equal(got, tt.want) {
+			t.Errorf("editorArgs(%q) = %q, ожидалось %q", tt.editor, got, tt.want)
+		}
+	}
+}
+
+func TestDetectLinks(t *testing.T) {
+	dir := t.TempDir()
+	makeTree(t, dir, "main.go", "sub/x.txt")
+	chdir(t, dir)
+
+	fileLink := func(path, fragment string) string {
+		return (&url.URL{Scheme: "file", Path: filepath.Join(dir, path), Fragment: fragment}).String()
+	}
+	tests := []struct {
+		text  string
+		texts []string
+		links []string
+	}{
+		{"ошибка в main.go:12:5: нет", []string{"ошибка в ", "main.go:12:5", ": нет"}, []string{"", fileLink("main.go", "12:5"), ""}},
+		{"см. ./sub/x.txt.", []string{"см. ", "./sub/x.txt", "."}, []string{"", fileLink("sub/x.txt", ""), ""}},
+		{"https://example.com/a?b=1)", []string{"https://example.com/a?b=1", ")"}, []string{"https://example.com/a?b=1", ""}},
+		{"нет такого ./missing.go:3", []string{"нет такого ./missing.go:3"}, []string{""}},
+		{"and/or 12:30", []string{"and/or 12:30"}, []string{""}},
+	}
+	for _, tt := range tests {
+		segments := detectLinks(LineSegment{Text: tt.text, Style: tcell.StyleDefault})
+		var texts, links []string
+		for _, segment := range segments {
+			texts = append(texts, segment.Text)
+			links = append(links, segment.Link)
+		}
+		if !slices.Equal(texts, tt.texts) || !slices.Equal(links, tt.links) {
+			t.Errorf("%q: %q %q, ожидалось %q %q", tt.text, texts, links, tt.texts, tt.links)
+		}
+	}
+}
+
+func TestPathExistsCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "later.go")
+	if pathExists(path) {
+		t.Fatalf("%s: файл еще не создан", path)
+	}
+
+	// Результат запоминается: повторная проверка не обращается к файловой системе
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if pathExists(path) {
+		t.Errorf("%s: результат проверки не закэширован", path)
+	}
+
+	// Устаревшая запись проверяется заново
+	stat := linkStats[path]
+	stat.checked = stat.checked.Add(-linkStatTTL)
+	linkStats[path] = stat
+	if !pathExists(path) {
+		t.Errorf("%s: устаревшая запись кэша не обновлена", path)
+	}
+}
+
+func TestOpenLinkKeepsInput(t *testing.T) {
+	screen := tcell.NewSimulationScreen("UTF-8")
+	screen.Init()
+	screen.SetSize(80, 24)
+	term := newTestTerminal()
+	term.screen, term.notify = screen, make(chan func(), 16)
+	term.envVars["EDITOR"] = "/nonexistent/vim"
+	term.inputBuffer = []rune("набранная команда")
+	term.history = []string{"make"}
+	term.historyInfo = []historyEntry{{status: 2, done: true}}
+	path := filepath.Join(t.TempDir(), "main.go")
+	makeTree(t, filepath.Dir(path), "main.go")
+
+	// Редактор не запустился: ошибка попадает в вывод, а ввод и история не меняются
+	term.openLink((&url.URL{Scheme: "file", Path: path, Fragment: "7"}).String())
+	if term.running != nil {
+		t.Fatal("команда открытия ссылки не завершилась")
+	}
+	if string(term.inputBuffer) != "набранная команда" {
+		t.Errorf("ввод изменен: %q", string(term.inputBuffer))
+	}
+	if !slices.Equal(term.history, []string{"make"}) || term.historyInfo[0].status != 2 {
+		t.Errorf("история изменена: %q %+v", term.history, term.historyInfo)
+	}
+	if len(term.outputLines) == 0 || !strings.Contains(term.outputLines[0].Text, "/nonexistent/vim +7 ") {
+		t.Errorf("вывод: %+v", term.outputLines)
+	}
+
+	// Ссылка на удаленный файл не открывается
+	term.outputLines = nil
+	term.openLink((&url.URL{Scheme: "file", Path: path + ".missing", Fragment: "1"}).String())
+	if len(term.outputLines) != 1 || !strings.HasPrefix(term.outputLines[0].Text, "Ошибка:") {
+		t.Errorf("вывод: %+v", term.outputLines)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -10,11 +11,11 @@ import (
 	"os/exec"
 	"os/user"
 	"regexp"
+	"strconv"
 	"strings"
-	// "syscall"
+	"syscall"
 	"time"
 
-	"github.com/creack/pty"
 	"github.com/gdamore/tcell/v2"
 	"golang.org/x/text/encoding/charmap"
 	"golang.org/x/text/transform"
@@ -26,334 +27,95 @@ type Terminal struct {
 	cursorPos            int
 	cursorVisible        bool
 	lastBlink            time.Time
-	outputLines          []LineSegment // Храним вывод команд с цветами
-	history              []string      // История команд
-	historyPos           int           // Позиция в истории
-	zshHistory           []string      // История команд из zsh
-	completionSuggestion string        // Текст подсказки (серая часть)
+	outputLines          []LineSegment  // Храним вывод команд с цветами
+	history              []string       // История команд
+	historyInfo          []historyEntry // Каталог и код завершения каждой команды history
+	historyPos           int            // Позиция в истории
+	zshHistory           []string       // История команд из zsh
+	completionSuggestion string         // Текст подсказки (серая часть)
 	suggestionStyle      tcell.Style
 	completionMatches    []string // Все найденные варианты ← ДОБАВЛЯЕМ
 	completionIndex      int
-	ptmx                 *os.File
-	cmd                  *exec.Cmd
-	inPtyMode            bool
+	ptmx                 *os.File // Ввод задания переднего плана
+	inPtyMode            bool     // Клавиатура передается заданию переднего плана
 	scrollOffset         int
-	sudoPrompt           string            // Приглашение ввода пароля для sudo
-	aliases              map[string]string // Алиасы команд
-	envVars              map[string]string // Переменные окружения
-	ptyClosed            chan struct{}     // Канал для сигнализации о закрытии PTY
+	aliases              map[string]string             // Алиасы команд
+	envVars              map[string]string             // Переменные окружения
+	ptyClosed            chan struct{}                 // Канал для сигнализации о закрытии PTY
+	options              map[string]bool               // Опции терминала (set -o / set +o)
+	completions          map[string]completionProvider // Дополнение аргументов по имени команды (complete)
+	lastStatus           int                           // Код завершения последней команды ($?)
+	subshellDepth        int                           // Глубина вложенных подстановок команд $(...)
+	substitutionOutput   []LineSegment                 // stderr и ошибки подстановок команд текущей команды
+	jobs                 []*job                        // Таблица заданий: фоновые и остановленные
+	fgJob                *job                          // Задание на переднем плане
+	running              *commandRun                   // Выполняемая командная строка
+	waitJobs             []*job                        // Задания, которых ждет команда wait
+	waitAll              bool                          // wait без аргументов
+	lastBgPid            int                           // PID последнего фонового задания ($!)
+	notify               chan func()                   // Изменения состояния из горутин для главного цикла
+	linkAreas            []linkArea                    // Ссылки, нарисованные на экране
+	hintMode             bool                          // Режим подсказок: ссылки помечены буквами для открытия с клавиатуры
+	mouseButtons         tcell.ButtonMask              // Нажатые кнопки мыши
+	outputView           outputView                    // Нарисованный вывод: по нему мышь выделяет текст
+	selection            selection                     // Выделенный мышью текст вывода
+	paste                pasteState                    // Вставка из буфера обмена
+	editor               lineEditor                    // Редактирование строки ввода: кольцо удалений и отмена
+	vi                   viState                       // Режим редактирования vi (set -o vi)
+	search               searchState                   // Поиск по истории (Ctrl+R)
+	picker               pickerState                   // Окно выбора команды из истории (Alt+R)
+	menu                 completionMenu                // Меню вариантов дополнения по Tab
 
 }
 
-// parseArgs разбирает команду на аргументы с учетом кавычек
+// parseArgs разбирает команду на аргументы с учетом кавычек.
+// Переменные окружения раскрываются везде, кроме одинарных кавычек
 func (t *Terminal) parseArgs(input string) []string {
 	var args []string
-	var current strings.Builder
-	inQuotes := false
-	quoteChar := rune(0)
-
-	for _, r := range input {
-		switch {
-		case r == '"' || r == '\'':
-			if !inQuotes {
-				// Начало кавычек
-				inQuotes = true
-				quoteChar = r
-			} else if quoteChar == r {
-				// Конец кавычек
-				inQuotes = false
-				quoteChar = 0
-			} else {
-				// Кавычка внутри других кавычек
-				current.WriteRune(r)
-			}
-		case r == ' ' || r == '\t':
-			if inQuotes {
-				// Пробел внутри кавычек
-				current.WriteRune(r)
-			} else {
-				// Пробел вне кавычек - конец аргумента
-				if current.Len() > 0 {
-					args = append(args, current.String())
-					current.Reset()
-				}
-			}
-		default:
-			current.WriteRune(r)
-		}
-	}
-
-	// Добавляем последний аргумент
-	if current.Len() > 0 {
-		args = append(args, current.String())
+	for _, word := range t.parseWords(input) {
+		args = append(args, word.text)
 	}
-
 	return args
 }
 
+// parseWords разбирает команду на слова, запоминая, какие метасимволы шаблонов стоят вне кавычек
+func (t *Terminal) parseWords(input string) []shellWord {
+	return t.expandRawWords(splitRawWords(input))
+}
+
 // LineSegment представляет сегмент текста с определенным стилем
 type LineSegment struct {
-	Text  string
-	Style tcell.Style
-}
-
-// ANSI цвета для преобразования
-var ansiColors = map[int]tcell.Color{
-	30: tcell.ColorBlack,       // black
-	31: tcell.ColorRed,         // red
-	32: tcell.ColorGreen,       // green
-	33: tcell.ColorYellow,      // yellow
-	34: tcell.ColorBlue,        // blue
-	35: tcell.ColorDarkMagenta, // magenta
-	36: tcell.ColorTeal,        // cyan
-	37: tcell.ColorWhite,       // white
-	90: tcell.ColorGray,        // bright black
-	91: tcell.ColorRed,         // bright red
-	92: tcell.ColorGreen,       // bright green
-	93: tcell.ColorYellow,      // bright yellow
-	94: tcell.ColorBlue,        // bright blue
-	95: tcell.ColorDarkMagenta, // bright magenta
-	96: tcell.ColorTeal,        // bright cyan
-	97: tcell.ColorWhite,       // bright white
-}
-
-var ansiBgColors = map[int]tcell.Color{
-	40:  tcell.ColorBlack,
-	41:  tcell.ColorRed,
-	42:  tcell.ColorGreen,
-	43:  tcell.ColorYellow,
-	44:  tcell.ColorBlue,
-	45:  tcell.ColorDarkMagenta,
-	46:  tcell.ColorTeal,
-	47:  tcell.ColorWhite,
-	100: tcell.ColorGray,
-	101: tcell.ColorRed,
-	102: tcell.ColorGreen,
-	103: tcell.ColorYellow,
-	104: tcell.ColorBlue,
-	105: tcell.ColorDarkMagenta,
-	106: tcell.ColorTeal,
-	107: tcell.ColorWhite,
-}
-
-// executeSimpleCommand выполняет простые команды с выводом результата
-func (t *Terminal) executeSimpleCommand(args []string) []LineSegment {
-	log.Printf("🔧 Выполнение простой команды: %v", args)
-
-	cmd := exec.Command(args[0], args[1:]...)
-	output, err := cmd.CombinedOutput()
-
-	if err != nil {
-		return []LineSegment{{Text: fmt.Sprintf("Ошибка: %s\n%s", err, string(output)), Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}
-	}
-
-	text := string(output)
-	if text == "" {
-		text = "[Команда выполнена без вывода]"
-	}
-	return []LineSegment{{Text: text, Style: tcell.StyleDefault.Foreground(tcell.ColorWhite)}}
+	Text   string
+	Style  tcell.Style
+	Inline bool   // Продолжает текущую строку вывода вместо того, чтобы начинать новую
+	Link   string // Гиперссылка (OSC 8 или найденные в тексте URL и путь к файлу)
 }
 
-// executeInteractiveCommand выполняет интерактивные команды через pipes
-func (t *Terminal) executeInteractiveCommand(args []string) []LineSegment {
-	log.Printf("🔄 Запуск интерактивной команды: %v", args)
-
-	if len(args) == 0 {
-		return []LineSegment{{Text: "Ошибка: нет команды", Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}
-	}
-
-	// Создаем команду
-	cmd := exec.Command(args[0], args[1:]...)
-	cmd.Env = os.Environ()
-	cmd.Env = append(cmd.Env, "TERM=xterm-256color")
-
-	// Создаем pipes для stdin, stdout, stderr
-	stdin, err := cmd.StdinPipe()
-	if err != nil {
-		log.Printf("❌ Ошибка создания stdin pipe: %v", err)
-		return []LineSegment{{Text: fmt.Sprintf("Ошибка stdin: %s", err), Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}
-	}
-
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		log.Printf("❌ Ошибка создания stdout pipe: %v", err)
-		return []LineSegment{{Text: fmt.Sprintf("Ошибка stdout: %s", err), Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}
+// exitStatus преобразует ошибку завершения процесса в код возврата в стиле shell
+func exitStatus(err error) int {
+	if err == nil {
+		return 0
 	}
 
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		log.Printf("❌ Ошибка создания stderr pipe: %v", err)
-		return []LineSegment{{Text: fmt.Sprintf("Ошибка stderr: %s", err), Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}
-	}
-
-	// Запускаем команду
-	if err := cmd.Start(); err != nil {
-		log.Printf("❌ Ошибка запуска команды: %v", err)
-		return []LineSegment{{Text: fmt.Sprintf("Ошибка запуска: %s", err), Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}
-	}
-
-	log.Printf("✅ Команда запущена, PID: %d", cmd.Process.Pid)
-
-	// Сохраняем состояние
-	t.cmd = cmd
-	t.inPtyMode = true
-
-	// Обработка stdout
-	// В executeInteractiveCommand обновите обработку stdout:
-	go func() {
-		defer stdout.Close()
-		scanner := bufio.NewScanner(stdout)
-		for scanner.Scan() {
-			text := scanner.Text()
-			log.Printf("📨 STDOUT: %s", text)
-
-			// 🔴 ОБНАРУЖЕНИЕ SUDO PROMPT
-			if strings.Contains(text, "[sudo] password for") ||
-				strings.Contains(text, "Password:") ||
-				strings.Contains(text, "Пароль:") {
-				t.sudoPrompt = text
-				log.Printf("🔐 Обнаружен sudo prompt: %s", text)
-			}
-
-			t.addColoredOutputAtBeginning(text+"\n", tcell.StyleDefault.Foreground(tcell.ColorWhite))
-		}
-		if err := scanner.Err(); err != nil {
-			log.Printf("❌ Ошибка чтения stdout: %v", err)
-		}
-	}()
-
-	// Обработка stderr
-	go func() {
-		defer stderr.Close()
-		scanner := bufio.NewScanner(stderr)
-		for scanner.Scan() {
-			text := scanner.Text()
-			log.Printf("📨 STDERR: %s", text)
-			t.addColoredOutputAtBeginning(text+"\n", tcell.StyleDefault.Foreground(tcell.ColorRed))
-		}
-		if err := scanner.Err(); err != nil {
-			log.Printf("❌ Ошибка чтения stderr: %v", err)
-		}
-	}()
-
-	// Сохраняем stdin для использования в handleKeyEvent
-	t.ptmx = stdin.(*os.File)
-
-	// Ожидание завершения в отдельной горутине
-	go func() {
-		err := cmd.Wait()
-		log.Printf("🔚 Команда завершена, ошибка: %v", err)
-		t.inPtyMode = false
-		t.ptmx = nil
-		t.cmd = nil
-		if err == nil {
-			t.addColoredOutputAtBeginning("\n[Команда завершена успешно]\n", tcell.StyleDefault.Foreground(tcell.ColorGreen))
-		} else {
-			t.addColoredOutputAtBeginning(fmt.Sprintf("\n[Команда завершена с ошибкой: %v]\n", err), tcell.StyleDefault.Foreground(tcell.ColorYellow))
-		}
-	}()
-
-	return []LineSegment{}
-}
-
-// addColoredOutputAtBeginning добавляет вывод в НАЧАЛО outputLines (как в оригинале)
-func (t *Terminal) addColoredOutputAtBeginning(text string, baseStyle tcell.Style) {
-	segments := parseANSI(text, baseStyle)
-
-	// Создаем новый слайс и добавляем новые сегменты ПЕРВЫМИ
-	newOutput := []LineSegment{}
-
-	// Добавляем новые сегменты
-	for _, segment := range segments {
-		// Разбиваем на строки если есть переносы
-		lines := strings.Split(segment.Text, "\n")
-		for i, line := range lines {
-			if i > 0 {
-				// Добавляем явный перенос строки между частями
-				newOutput = append(newOutput, LineSegment{Text: "\n", Style: segment.Style})
-			}
-			newOutput = append(newOutput, LineSegment{Text: line, Style: segment.Style})
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		// Процесс убит сигналом: 128 + номер сигнала
+		if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			return 128 + int(ws.Signal())
 		}
+		return exitErr.ExitCode()
 	}
 
-	// Добавляем весь старый вывод ПОСЛЕ новых сегментов
-	newOutput = append(newOutput, t.outputLines...)
-
-	// Заменяем старый вывод на новый
-	t.outputLines = newOutput
-}
-func (t *Terminal) processPtyCommand(args []string) []LineSegment {
-	log.Printf("🎯 Обработка команды: %v", args)
-
-	if len(args) == 0 {
-		return []LineSegment{{Text: "Ошибка: нет команды", Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}
-	}
-
-	// Определяем тип команды
-	command := args[0]
-
-	// Интерактивные команды выполняем через pipes
-	interactiveCommands := map[string]bool{
-		"vim": true, "nano": true, "htop": true, "top": true,
-		"less": true, "more": true, "man": true, "cat": true,
-		"python": true, "python3": true, "bash": true, "sh": true,
-		"zsh": true, "fish": true,
+	// Команда не найдена или не может быть запущена
+	if errors.Is(err, exec.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+		return 127
 	}
-
-	if interactiveCommands[command] {
-		return t.executeInteractiveCommand(args)
+	if errors.Is(err, os.ErrPermission) {
+		return 126
 	}
-
-	// Простые команды выполняем напрямую
-	return t.executeSimpleCommand(args)
+	return 1
 }
 
-// executeWithRealTTY использует настоящий PTY для команд, которым это нужно
-func (t *Terminal) executeWithRealTTY(args []string) []LineSegment {
-	log.Printf("🔧 Запуск с настоящим TTY: %v", args)
-
-	cmd := exec.Command(args[0], args[1:]...)
-	cmd.Env = os.Environ()
-	cmd.Env = append(cmd.Env, "TERM=xterm-256color")
-
-	width, height := t.screen.Size()
-
-	ptmx, err := pty.StartWithSize(cmd, &pty.Winsize{
-		Rows: uint16(height),
-		Cols: uint16(width),
-	})
-	if err != nil {
-		return []LineSegment{{Text: fmt.Sprintf("Ошибка TTY: %s", err), Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}
-	}
-
-	t.ptmx = ptmx
-	t.cmd = cmd
-	t.inPtyMode = true
-
-	// Обработка вывода
-	go func() {
-		defer func() {
-			ptmx.Close()
-			t.inPtyMode = false
-			t.ptmx = nil
-			t.cmd = nil
-		}()
-
-		buffer := make([]byte, 1024)
-		for {
-			n, err := ptmx.Read(buffer)
-			if err != nil {
-				break
-			}
-			if n > 0 {
-				output := string(buffer[:n])
-				t.addColoredOutputAtBeginning(output, tcell.StyleDefault.Foreground(tcell.ColorWhite))
-			}
-		}
-	}()
-
-	return []LineSegment{}
-}
 func decodeWindows1251(data []byte) string {
 	// Пробуем декодировать из Windows-1251 (часто используется в Windows)
 	reader := transform.NewReader(bytes.NewReader(data), charmap.Windows1251.NewDecoder())
@@ -365,38 +127,6 @@ func decodeWindows1251(data []byte) string {
 	return string(decoded)
 }
 
-// handleSudoInput обрабатывает ввод пароля для sudo
-func (t *Terminal) handleSudoInput(ev *tcell.EventKey) {
-	log.Printf("🔐 Обработка sudo ввода: %v", ev.Key())
-
-	switch ev.Key() {
-	case tcell.KeyEnter:
-		// Отправляем Enter в PTY (подтверждаем пароль или пустой пароль)
-		t.ptmx.Write([]byte{'\n'})
-		log.Printf("↵ Enter отправлен в sudo")
-		t.sudoPrompt = "" // Сбрасываем приглашение после ввода
-
-	case tcell.KeyBackspace, tcell.KeyBackspace2:
-		// Backspace для редактирования пароля
-		t.ptmx.Write([]byte{'\b'})
-		log.Printf("⌫ Backspace в sudo")
-
-	case tcell.KeyRune:
-		// Передаем символы пароля
-		t.ptmx.Write([]byte(string(ev.Rune())))
-		log.Printf("📝 Символ пароля отправлен")
-
-	case tcell.KeyCtrlC:
-		// Ctrl+C для отмены sudo
-		t.ptmx.Write([]byte{0x03})
-		log.Printf("🚫 Ctrl+C - отмена sudo")
-		t.sudoPrompt = ""
-
-	default:
-		log.Printf("❓ Необработанная клавиша в sudo: %v", ev.Key())
-	}
-}
-
 // loadZshHistory загружает историю команд из файла ~/.zsh_history
 func loadZshHistory() ([]string, error) {
 	homeDir, err := os.UserHomeDir()
@@ -565,6 +295,73 @@ func loadAliases() (map[string]string, error) {
 	return aliases, nil
 }
 
+// loadOptions загружает команды set и complete из файла ~/.termgo_options
+func loadOptions() ([]string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(homeDir + "/.termgo_options")
+	if err != nil {
+		// Если файл не найден, остаются опции по умолчанию
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	// Формат: по команде на строке, например "set -o vi"
+	var commands []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		// Пропускаем пустые строки и комментарии
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		commands = append(commands, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return commands, nil
+}
+
+// applyOptions выполняет команды set и complete из .termgo_options и возвращает
+// предупреждения о неизвестных и неудачных командах. Строка, раскрывшаяся
+// в пустую команду (например, неустановленная переменная), пропускается
+func (t *Terminal) applyOptions(commands []string) []string {
+	var warnings []string
+	for _, command := range commands {
+		args := t.parseArgs(command)
+		if len(args) == 0 {
+			continue
+		}
+		var segments []LineSegment
+		status := 0
+		switch args[0] {
+		case "set":
+			segments, status = t.processSetCommand(args)
+		case "complete":
+			segments, status = t.processCompleteCommand(args)
+		default:
+			warnings = append(warnings, fmt.Sprintf("неизвестная команда '%s'", command))
+			continue
+		}
+		switch {
+		case status != 0 && len(segments) > 0:
+			warnings = append(warnings, segments[0].Text)
+		case status != 0:
+			warnings = append(warnings, fmt.Sprintf("'%s' завершилась с кодом %d", command, status))
+		}
+	}
+	return warnings
+}
+
 func main() {
 	// Инициализация логирования
 	logFile, err := os.OpenFile("terminal.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
@@ -597,11 +394,14 @@ func main() {
 		history:              []string{},
 		historyPos:           0,
 		aliases:              make(map[string]string),
-		envVars:              make(map[string]string),
+		envVars:              loadEnvironment(),
+		options:              defaultOptions(),
+		completions:          defaultCompletions(),
 		completionSuggestion: "",
 		suggestionStyle:      tcell.StyleDefault.Foreground(tcell.ColorGray),
 		completionMatches:    []string{}, // ← ДОБАВЛЯЕМ
 		completionIndex:      0,
+		notify:               make(chan func(), 256),
 	}
 
 	// Загружаем историю zsh
@@ -637,13 +437,30 @@ func main() {
 		}
 	}
 
+	// Применяем опции из .termgo_options (например, режим vi)
+	optionCommands, err := loadOptions()
+	if err != nil {
+		fmt.Printf("Предупреждение: не удалось загрузить опции из .termgo_options: %v\n", err)
+	}
+	for _, warning := range term.applyOptions(optionCommands) {
+		fmt.Printf("Предупреждение: .termgo_options: %s\n", warning)
+	}
+
 	// Устанавливаем темный стиль
 	defStyle := tcell.StyleDefault.
 		Foreground(tcell.ColorWhite).
 		Background(tcell.ColorDefault)
 	s.SetStyle(defStyle)
+	s.EnableMouse(tcell.MouseDragEvents)
+	s.EnablePaste()
 	s.Clear()
 
+	// События ввода, изменения от заданий и таймер мигания курсора обрабатываются в одном цикле
+	events := make(chan tcell.Event, 16)
+	go s.ChannelEvents(events, nil)
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
 	// Главный цикл
 	for {
 		// Обновляем мигание курсора
@@ -655,22 +472,23 @@ func main() {
 		// Показываем изменения
 		s.Show()
 
-		// Обработка событий с таймаутом для плавного мигания
 		select {
-		case <-time.After(50 * time.Millisecond):
-			continue
-		default:
-		}
-
-		// Обработка событий ввода
-		if s.HasPendingEvent() {
-			ev := s.PollEvent()
+		case ev := <-events:
 			switch ev := ev.(type) {
 			case *tcell.EventResize:
 				s.Sync()
+				term.resizeJobs()
+			case *tcell.EventMouse:
+				term.handleMouseEvent(ev)
+			case *tcell.EventPaste:
+				term.handlePasteEvent(ev)
 			case *tcell.EventKey:
 				term.handleKeyEvent(ev)
 			}
+		case fn := <-term.notify:
+			// Вывод и изменения состояния заданий
+			fn()
+		case <-ticker.C:
 		}
 	}
 }
@@ -691,7 +509,8 @@ func (t *Terminal) updateCompletionSuggestion() {
 	t.completionMatches = t.findAllSuggestions(currentInput)
 
 	if len(t.completionMatches) == 0 {
-		t.completionSuggestion = ""
+		// Без совпадений в истории подсказывает поставщик дополнения аргументов
+		t.completionSuggestion = t.argumentSuggestion()
 		t.completionIndex = 0
 		return
 	}
@@ -766,48 +585,134 @@ func (t *Terminal) draw() {
 
 	t.screen.Clear()
 	t.drawTerminalArea(offsetX, offsetY, termWidth, termHeight)
+	t.linkAreas = t.linkAreas[:0]
+	t.outputView = outputView{}
+
+	inputY := offsetY + 1
+	outputX, outputY, outputWidth, outputHeight := t.outputArea()
+
+	// Задание переднего плана рисует свой экран в области вывода, над ним - эхо команды.
+	// Альтернативный экран занимает всю область, а основной - только строки с выводом,
+	// под которыми остается история команд
+	if t.fgJob != nil {
+		header := t.commandHeader(t.fgJob.cmdText)
+		t.drawText(offsetX, inputY, header.Text, header.Style)
+
+		vt := t.fgJob.vt
+		if vt.altScreen {
+			t.drawJobScreen(vt, outputX, outputY, outputWidth, outputHeight)
+			return
+		}
+		rows := min(vt.usedRows(), outputHeight)
+		t.drawJobScreen(vt, outputX, outputY, outputWidth, rows)
+		t.drawOutput(outputX, outputY+rows, outputWidth, outputHeight-rows)
+		return
+	}
 
 	// Получаем текущую директорию
 	currentDir, _ := os.Getwd()
 
-	// 🔴 ОСОБЫЙ ПРОМПТ ДЛЯ SUDO
-	var prompt string
-	if t.sudoPrompt != "" {
-		prompt = "[SUDO PASSWORD] "
-		// Скрываем ввод для пароля
-		inputLine := prompt + strings.Repeat("*", len(t.inputBuffer))
-		t.drawText(offsetX, offsetY+1, inputLine, tcell.StyleDefault.
-			Foreground(tcell.ColorYellow).Background(tcell.ColorDefault))
-	} else {
-		prompt = currentDir + " $ "
+	// Во время поиска по истории вместо строки ввода показывается строка поиска
+	if t.search.active {
+		t.drawSearch(offsetX, inputY, outputWidth)
+		t.drawOutput(outputX, outputY, outputWidth, outputHeight)
+		return
+	}
 
-		// ОСНОВНОЙ ТЕКСТ ВВОДА (белый)
-		inputText := prompt + string(t.inputBuffer)
-		t.drawText(offsetX, offsetY+1, inputText, tcell.StyleDefault.
+	// В режиме vi приглашение начинается с метки режима
+	indicator, indicatorStyle := t.viPromptIndicator()
+	prompt := indicator + currentDir + " $ "
+
+	// ОСНОВНОЙ ТЕКСТ ВВОДА (белый): многострочная команда занимает несколько строк,
+	// область вывода сдвигается под нее
+	rows, positions := t.layoutInput(prompt, outputWidth)
+	rows = rows[:min(len(rows), max(1, outputHeight))]
+	for i, row := range rows {
+		t.drawText(offsetX, inputY+i, row, tcell.StyleDefault.
 			Foreground(tcell.ColorWhite).Background(tcell.ColorDefault))
+	}
+	t.drawText(offsetX, inputY, indicator, indicatorStyle)
+	if from, to, ok := t.viSelection(); ok {
+		for _, pos := range positions[from:to] {
+			if pos.row < len(rows) {
+				ch, _, style, _ := t.screen.GetContent(offsetX+pos.col, inputY+pos.row)
+				t.screen.SetContent(offsetX+pos.col, inputY+pos.row, ch, nil, style.Reverse(true))
+			}
+		}
+	}
+	outputY += len(rows) - 1
+	outputHeight -= len(rows) - 1
 
-		// ПОДСКАЗКА АВТОДОПОЛНЕНИЯ (серый)
-		if t.completionSuggestion != "" {
-			suggestionX := offsetX + len([]rune(prompt)) + len(t.inputBuffer)
-			t.drawText(suggestionX, offsetY+1, t.completionSuggestion, t.suggestionStyle)
+	// ПОДСКАЗКА АВТОДОПОЛНЕНИЯ (серый): после конца ввода, только ее первая строка
+	if t.completionSuggestion != "" {
+		suggestion, _, multiline := strings.Cut(t.completionSuggestion, "\n")
+		if multiline {
+			suggestion += " …"
 		}
+		last := rows[len(rows)-1]
+		t.drawText(offsetX+len([]rune(last)), inputY+len(rows)-1, suggestion, t.suggestionStyle)
 	}
 
-	inputY := offsetY + 1
-	t.drawOutput(offsetX, inputY+1, termWidth, termHeight-2)
+	if t.paste.confirm {
+		t.drawPasteConfirm(outputX, outputY)
+		outputY++
+		outputHeight--
+	}
+	if t.menu.active {
+		rows := t.drawCompletionMenu(outputX, outputY, outputWidth)
+		outputY += rows
+		outputHeight -= rows
+	}
 
-	// 🔴 ОТОБРАЖЕНИЕ SUDO PROMPT
-	if t.sudoPrompt != "" {
-		t.drawText(offsetX, inputY, t.sudoPrompt, tcell.StyleDefault.
-			Foreground(tcell.ColorRed).Background(tcell.ColorDefault))
+	// Окно выбора из истории закрывает область вывода
+	if t.picker.active {
+		t.drawPicker(outputX, outputY, outputWidth, outputHeight)
+		return
+	}
+
+	t.drawOutput(outputX, outputY, outputWidth, outputHeight)
+	if t.hintMode {
+		t.drawHints()
 	}
 
 	// Курсор
-	prefix := prompt
-	cursorX := offsetX + len([]rune(prefix)) + t.cursorPos
+	if cursor := positions[t.cursorPos]; t.cursorVisible && cursor.row < len(rows) {
+		t.drawCursor(offsetX+cursor.col, inputY+cursor.row)
+	}
+}
+
+// outputArea возвращает положение и размер области вывода под строкой ввода
+func (t *Terminal) outputArea() (x, y, width, height int) {
+	screenWidth, screenHeight := t.screen.Size()
+	offsetX, offsetY := 2, 2
+	return offsetX, offsetY + 2, screenWidth - 4*offsetX, screenHeight - 4*offsetY - 2
+}
 
-	if t.cursorVisible {
-		t.drawCursor(cursorX, inputY)
+// jobScreenSize возвращает размер экрана PTY задания: он совпадает с областью вывода
+func (t *Terminal) jobScreenSize() (int, int) {
+	_, _, width, height := t.outputArea()
+	return max(1, width), max(1, height)
+}
+
+// drawJobScreen рисует экран эмулятора задания; курсор показывается инверсией ячейки
+func (t *Terminal) drawJobScreen(v *vtScreen, offsetX, offsetY, width, height int) {
+	for y := 0; y < min(height, v.height); y++ {
+		for x := 0; x < min(width, v.width); x++ {
+			cell := v.cells[y][x]
+			if cell.ch == 0 {
+				// Правую половину широкого символа рисует tcell вместе с левой
+				continue
+			}
+			style := cell.style
+			if cell.link != "" {
+				style = style.Underline(true)
+				t.addLinkArea(offsetX+x, offsetY+y, 1, cell.link)
+			}
+			if v.cursorVisible && t.cursorVisible && x == v.x && y == v.y {
+				style = style.Reverse(true)
+			}
+			t.screen.SetContent(offsetX+x, offsetY+y, cell.ch, nil, style)
+		}
 	}
 }
 
@@ -823,98 +728,91 @@ func (t *Terminal) drawTerminalArea(x, y, width, height int) {
 	}
 }
 
-func (t *Terminal) drawOutput(offsetX, offsetY, width, height int) {
-	availableHeight := height
-	currentY := offsetY
+// outputRow - одна экранная строка вывода после переноса по ширине области
+type outputRow struct {
+	segments  []LineSegment
+	continued bool // Строка продолжает предыдущую, перенесенную по ширине
+}
 
-	// Пропускаем первые scrollOffset строк
-	skippedLines := 0
-	lineIndex := 0
+// layoutOutput раскладывает сегменты вывода по экранным строкам заданной ширины
+func (t *Terminal) layoutOutput(width int) []outputRow {
+	var rows []outputRow
+	var current outputRow
+	currentWidth := 0
+	started := false
 
-	// Сначала пропускаем нужное количество строк
-	for lineIndex < len(t.outputLines) && skippedLines < t.scrollOffset {
-		segment := t.outputLines[lineIndex]
-		text := segment.Text
+	flush := func() {
+		if started {
+			rows = append(rows, current)
+		}
+		current = outputRow{}
+		currentWidth = 0
+		started = false
+	}
 
-		// Пропускаем полностью пустые строки
-		if strings.TrimSpace(text) == "" {
-			lineIndex++
+	for _, segment := range t.visibleOutput() {
+		// Явные переносы и пустые строки пропускаем, как и раньше
+		if segment.Text == "\n" || (!segment.Inline && strings.TrimSpace(segment.Text) == "") {
 			continue
 		}
 
-		// Разбиваем на строки по переносам
-		lines := strings.Split(text, "\n")
-		skippedLines += len(lines)
-		lineIndex++
-	}
-
-	// Если пропустили больше строк, чем нужно, корректируем
-	if skippedLines > t.scrollOffset {
-		// Нужно отобразить часть последней пропущенной строки
-		segment := t.outputLines[lineIndex-1]
-		text := segment.Text
-		lines := strings.Split(text, "\n")
-		linesToSkip := skippedLines - t.scrollOffset
-		if linesToSkip < len(lines) {
-			// Отображаем оставшиеся строки из последнего сегмента
-			for i := linesToSkip; i < len(lines); i++ {
-				line := lines[i]
-				if currentY >= offsetY+availableHeight {
-					break
-				}
-
-				runes := []rune(line)
-				for len(runes) > 0 && currentY < offsetY+availableHeight {
-					take := min(len(runes), width)
-					chunk := string(runes[:take])
+		if !segment.Inline {
+			flush()
+		}
+		started = true
 
-					// Рисуем только непустые чанки
-					if strings.TrimSpace(chunk) != "" {
-						t.drawText(offsetX, currentY, chunk, segment.Style)
-					}
+		// Разбиваем на строки по переносам, а строки - на куски по ширине
+		for i, line := range strings.Split(segment.Text, "\n") {
+			if i > 0 {
+				flush()
+				started = true
+			}
 
-					currentY++
-					runes = runes[take:]
+			runes := []rune(line)
+			for len(runes) > 0 {
+				if currentWidth >= width {
+					flush()
+					started = true
+					current.continued = true
 				}
+				take := min(len(runes), width-currentWidth)
+				chunk := segment
+				chunk.Text = string(runes[:take])
+				current.segments = append(current.segments, chunk)
+				currentWidth += take
+				runes = runes[take:]
 			}
 		}
 	}
+	flush()
 
-	// Отображаем оставшиеся строки
-	for lineIndex < len(t.outputLines) && currentY < offsetY+availableHeight {
-		segment := t.outputLines[lineIndex]
-		text := segment.Text
-
-		// Пропускаем полностью пустые строки
-		if strings.TrimSpace(text) == "" {
-			lineIndex++
-			continue
-		}
-
-		// Разбиваем на строки по переносам
-		lines := strings.Split(text, "\n")
+	return rows
+}
 
-		for _, line := range lines {
-			if currentY >= offsetY+availableHeight {
-				break
-			}
+func (t *Terminal) drawOutput(offsetX, offsetY, width, height int) {
+	if width <= 0 || height <= 0 {
+		return
+	}
 
-			runes := []rune(line)
-			for len(runes) > 0 && currentY < offsetY+availableHeight {
-				take := min(len(runes), width)
-				chunk := string(runes[:take])
+	rows := t.layoutOutput(width)
 
-				// Рисуем только непустые чанки
-				if strings.TrimSpace(chunk) != "" {
-					t.drawText(offsetX, currentY, chunk, segment.Style)
-				}
-
-				currentY++
-				runes = runes[take:]
+	// Пропускаем первые scrollOffset строк
+	start := min(t.scrollOffset, max(0, len(rows)-1))
+	t.outputView = outputView{x: offsetX, y: offsetY, width: width, height: height, start: start, rows: rows}
+	for i := start; i < len(rows) && i-start < height; i++ {
+		x := offsetX
+		for _, segment := range rows[i].segments {
+			width := len([]rune(segment.Text))
+			style := segment.Style
+			if segment.Link != "" {
+				style = style.Underline(true)
+				t.addLinkArea(x, offsetY+i-start, width, segment.Link)
 			}
+			t.drawText(x, offsetY+i-start, segment.Text, style)
+			x += width
 		}
-		lineIndex++
 	}
+	t.drawSelection()
 }
 
 // Вспомогательная функция для min
@@ -936,56 +834,18 @@ func (t *Terminal) drawCursor(x, y int) {
 	style := tcell.StyleDefault.
 		Foreground(tcell.ColorBlack).
 		Background(tcell.ColorWhite)
-	// Используем пробел для курсора вместо символа
-	t.screen.SetContent(x, y, ' ', nil, style)
+	// Символ под курсором остается виден: в normal-режиме vi курсор стоит на символе
+	ch, _, _, _ := t.screen.GetContent(x, y)
+	t.screen.SetContent(x, y, ch, nil, style)
 }
 
-// parseANSI преобразует строку с ANSI кодами в сегменты с правильными стилями
+// parseANSI преобразует текст с управляющими последовательностями в сегменты
+// с правильными стилями. Возврат каретки, перемещения курсора и очистка строки
+// выполняются над текстом, остальные последовательности отбрасываются
 func parseANSI(text string, baseStyle tcell.Style) []LineSegment {
-	segments := []LineSegment{}
-	currentStyle := baseStyle
-
-	// Регулярное выражение для поиска ANSI escape последовательностей
-	re := regexp.MustCompile(`\033\[([\d;]*)m`)
-	matches := re.FindAllStringSubmatchIndex(text, -1)
-
-	if len(matches) == 0 {
-		// Нет ANSI кодов - возвращаем весь текст как один сегмент
-		return []LineSegment{{Text: text, Style: baseStyle}}
-	}
-
-	lastIndex := 0
-	for _, match := range matches {
-		// Добавляем текст до ANSI кода
-		if match[0] > lastIndex {
-			segments = append(segments, LineSegment{
-				Text:  text[lastIndex:match[0]],
-				Style: currentStyle,
-			})
-		}
-
-		// Обрабатываем ANSI код
-		codeStr := text[match[2]:match[3]]
-		if codeStr == "" {
-			// Reset
-			currentStyle = baseStyle
-		} else {
-			codes := parseANSICodes(codeStr)
-			currentStyle = applyANSICodes(codes, baseStyle)
-		}
-
-		lastIndex = match[1]
-	}
-
-	// Добавляем оставшийся текст
-	if lastIndex < len(text) {
-		segments = append(segments, LineSegment{
-			Text:  text[lastIndex:],
-			Style: currentStyle,
-		})
-	}
-
-	return segments
+	lines := newANSIText(baseStyle)
+	io.WriteString(lines, text)
+	return lines.segments()
 }
 
 func parseANSICodes(codeStr string) []int {
@@ -1003,82 +863,138 @@ func parseANSICodes(codeStr string) []int {
 	return codes
 }
 
-func applyANSICodes(codes []int, baseStyle tcell.Style) tcell.Style {
-	style := baseStyle
-	fgColor := tcell.ColorDefault
-	bgColor := tcell.ColorDefault
-	bold := false
-	underline := false
-	italic := false
+// sgrUnderlineStyles - стили подчеркивания SGR 4:N
+var sgrUnderlineStyles = []tcell.UnderlineStyle{
+	tcell.UnderlineStyleNone,
+	tcell.UnderlineStyleSolid,
+	tcell.UnderlineStyleDouble,
+	tcell.UnderlineStyleCurly,
+	tcell.UnderlineStyleDotted,
+	tcell.UnderlineStyleDashed,
+}
 
-	i := 0
-	for i < len(codes) {
-		code := codes[i]
-		switch {
+// applyANSICodes применяет параметры последовательности SGR (ESC [ ... m) к текущему
+// стилю style: атрибуты, не затронутые последовательностью, сохраняются. Параметры
+// разделяются ';', подпараметры - ':' (38:2::r:g:b, 4:3). Пустые параметры равны 0.
+// Скрытый текст (8) и надчеркивание (53) tcell не поддерживает, они пропускаются
+func applyANSICodes(style tcell.Style, params string, baseStyle tcell.Style) tcell.Style {
+	baseFg, baseBg, _ := baseStyle.Decompose()
+	groups := strings.Split(params, ";")
+
+	for i := 0; i < len(groups); i++ {
+		sub := sgrNumbers(groups[i])
+		switch code := sub[0]; {
 		case code == 0:
-			// Reset
 			style = baseStyle
-			fgColor = tcell.ColorDefault
-			bgColor = tcell.ColorDefault
-			bold = false
-			underline = false
-			italic = false
-
 		case code == 1:
-			bold = true
+			style = style.Bold(true)
+		case code == 2:
+			style = style.Dim(true)
 		case code == 3:
-			italic = true
+			style = style.Italic(true)
 		case code == 4:
-			underline = true
+			// 4:0 выключает подчеркивание, 4:3 - волнистое и т.д.
+			if len(sub) > 1 && sub[1] < len(sgrUnderlineStyles) {
+				style = style.Underline(sgrUnderlineStyles[sub[1]])
+			} else {
+				style = style.Underline(true)
+			}
+		case code == 5 || code == 6:
+			style = style.Blink(true)
+		case code == 7:
+			style = style.Reverse(true)
+		case code == 9:
+			style = style.StrikeThrough(true)
+		case code == 21:
+			style = style.Underline(tcell.UnderlineStyleDouble)
 		case code == 22:
-			bold = false
+			style = style.Bold(false).Dim(false)
 		case code == 23:
-			italic = false
+			style = style.Italic(false)
 		case code == 24:
-			underline = false
+			style = style.Underline(false)
+		case code == 25:
+			style = style.Blink(false)
+		case code == 27:
+			style = style.Reverse(false)
+		case code == 29:
+			style = style.StrikeThrough(false)
 
 		case code >= 30 && code <= 37:
-			fgColor = ansiColors[code]
+			style = style.Foreground(tcell.PaletteColor(code - 30))
 		case code >= 90 && code <= 97:
-			fgColor = ansiColors[code]
+			// Яркие цвета - отдельные цвета палитры 8-15
+			style = style.Foreground(tcell.PaletteColor(code - 90 + 8))
+		case code == 39:
+			style = style.Foreground(baseFg)
 
 		case code >= 40 && code <= 47:
-			bgColor = ansiBgColors[code]
+			style = style.Background(tcell.PaletteColor(code - 40))
 		case code >= 100 && code <= 107:
-			bgColor = ansiBgColors[code]
-
-		case code == 38 && i+2 < len(codes) && codes[i+1] == 5:
-			// 256 colors - упрощенная поддержка
-			fgColor = tcell.PaletteColor(codes[i+2])
-			i += 2
-		case code == 48 && i+2 < len(codes) && codes[i+1] == 5:
-			// 256 colors background
-			bgColor = tcell.PaletteColor(codes[i+2])
-			i += 2
+			style = style.Background(tcell.PaletteColor(code - 100 + 8))
+		case code == 49:
+			style = style.Background(baseBg)
+
+		case code == 38 || code == 48 || code == 58:
+			color, used := sgrColor(sub, groups[i+1:])
+			i += used
+			if color == tcell.ColorDefault {
+				break
+			}
+			switch code {
+			case 38:
+				style = style.Foreground(color)
+			case 48:
+				style = style.Background(color)
+			case 58:
+				style = style.Underline(color)
+			}
+		case code == 59:
+			style = style.Underline(tcell.ColorDefault)
 		}
-		i++
 	}
 
-	// Применяем цвета
-	if fgColor != tcell.ColorDefault {
-		style = style.Foreground(fgColor)
-	}
-	if bgColor != tcell.ColorDefault {
-		style = style.Background(bgColor)
-	}
+	return style
+}
 
-	// Применяем атрибуты
-	if bold {
-		style = style.Bold(true)
-	}
-	if underline {
-		style = style.Underline(true)
+// sgrColor разбирает расширенный цвет SGR 38/48/58: 5;N - цвет палитры, 2;r;g;b -
+// RGB. Цвет задается подпараметрами (38:2::r:g:b) или следующими параметрами
+// rest (38;2;r;g;b). Возвращает цвет и число использованных параметров из rest
+func sgrColor(sub []int, rest []string) (tcell.Color, int) {
+	args := sub[1:]
+	used := 0
+	if len(args) == 0 {
+		// Цвет в следующих параметрах: сначала вид цвета, потом нужное ему число значений
+		if len(rest) == 0 {
+			return tcell.ColorDefault, 0
+		}
+		args = []int{sgrNumbers(rest[0])[0]}
+		need := map[int]int{5: 1, 2: 3}[args[0]]
+		used = 1 + min(need, len(rest)-1)
+		for _, part := range rest[1:used] {
+			args = append(args, sgrNumbers(part)[0])
+		}
 	}
-	if italic {
-		style = style.Italic(true)
+
+	switch {
+	case args[0] == 5 && len(args) >= 2:
+		return tcell.PaletteColor(args[1] & 0xff), used
+	case args[0] == 2 && len(args) >= 4:
+		// 38:2:CS:r:g:b содержит идентификатор цветового пространства перед r
+		rgb := args[len(args)-3:]
+		return tcell.NewRGBColor(int32(rgb[0]&0xff), int32(rgb[1]&0xff), int32(rgb[2]&0xff)), used
 	}
+	return tcell.ColorDefault, used
+}
 
-	return style
+// sgrNumbers разбирает параметр SGR с подпараметрами через ':'. Пустые значения равны 0
+func sgrNumbers(param string) []int {
+	parts := strings.Split(param, ":")
+	numbers := make([]int, len(parts))
+	for i, part := range parts {
+		numbers[i], _ = strconv.Atoi(part)
+	}
+	return numbers
 }
 
 func (t *Terminal) addColoredOutput(text string, baseStyle tcell.Style) {
@@ -1093,99 +1009,165 @@ func (t *Terminal) addColoredOutput(text string, baseStyle tcell.Style) {
 				// Добавляем явный перенос строки между частями
 				t.outputLines = append(t.outputLines, LineSegment{Text: "\n", Style: segment.Style})
 			}
-			t.outputLines = append(t.outputLines, LineSegment{Text: line, Style: segment.Style})
+			t.outputLines = append(t.outputLines, LineSegment{Text: line, Style: segment.Style, Inline: segment.Inline && i == 0})
 		}
 	}
 }
 
 func (t *Terminal) expandAliases(cmd string) string {
-	// Разбиваем команду на аргументы
-	args := t.parseArgs(cmd)
-	if len(args) == 0 {
+	// Выделяем первое слово, не трогая остальную часть команды:
+	// повторный разбор аргументов потерял бы кавычки
+	trimmed := strings.TrimLeft(cmd, " \t")
+	name, rest := trimmed, ""
+	if i := strings.IndexAny(trimmed, " \t"); i >= 0 {
+		name, rest = trimmed[:i], trimmed[i:]
+	}
+	if name == "" {
 		return cmd
 	}
 
 	// Проверяем, является ли первое слово алиасом
-	if aliasCmd, exists := t.aliases[args[0]]; exists {
-		// Заменяем алиас на команду
-		if len(args) > 1 {
-			// Если есть дополнительные аргументы, добавляем их к команде
-			// Объединяем аргументы обратно в строку
-			var cmdBuilder strings.Builder
-			cmdBuilder.WriteString(aliasCmd)
-			for _, arg := range args[1:] {
-				cmdBuilder.WriteString(" ")
-				// Добавляем кавычки вокруг аргументов, содержащих пробелы
-				if strings.Contains(arg, " ") {
-					cmdBuilder.WriteString("\"")
-					cmdBuilder.WriteString(arg)
-					cmdBuilder.WriteString("\"")
-				} else {
-					cmdBuilder.WriteString(arg)
-				}
-			}
-			return cmdBuilder.String()
-		}
-		return aliasCmd
+	if aliasCmd, exists := t.aliases[name]; exists {
+		// Заменяем алиас на команду, аргументы остаются как есть
+		return aliasCmd + rest
 	}
 
 	return cmd
 }
 
 func (t *Terminal) executeCommand(cmd string) {
-	// Раскрываем алиасы в команде
-	expandedCmd := t.expandAliases(cmd)
+	// Очищаем ввод и обновляем историю
+	t.inputBuffer = make([]rune, 0)
+	t.cursorPos = 0
+	t.editor.undo = nil
+	t.vi.mode, t.vi.pending, t.vi.recording = viInsert, nil, false
+	dir, _ := os.Getwd()
+	t.history = append(t.history, cmd)
+	t.historyInfo = append(t.historyInfo, historyEntry{dir: dir})
+	t.historyPos = len(t.history)
 
-	// Добавляем команду и ее вывод в НАЧАЛО вывода (чтобы сдвинуть старый вывод вниз)
-	// Но сначала добавляем текущую команду
-	commandSegment := LineSegment{
+	// Очищаем подсказки; выделение относится к прежнему выводу
+	t.completionSuggestion = ""
+	t.completionMatches = []string{}
+	t.completionIndex = 0
+	t.selection = selection{}
+	t.menu = completionMenu{}
+
+	// Выполняем список команд (алиасы раскрываются для каждой команды).
+	// Команда и ее вывод добавятся в НАЧАЛО вывода, когда выполнение закончится
+	t.startCommandRun(cmd)
+}
+
+// commandHeader возвращает эхо команды над ее выводом
+func (t *Terminal) commandHeader(cmd string) LineSegment {
+	return LineSegment{
 		Text:  "> " + cmd,
 		Style: tcell.StyleDefault.Foreground(tcell.ColorGray).Background(tcell.ColorDefault),
 	}
+}
 
-	// Создаем новый слайс и добавляем команду ПЕРВОЙ
-	newOutput := []LineSegment{commandSegment}
+// visibleOutput возвращает вывод для отображения: выполняющаяся команда
+// с уже полученным выводом, а под ней - вывод предыдущих команд
+func (t *Terminal) visibleOutput() []LineSegment {
+	if t.running == nil {
+		return t.outputLines
+	}
 
-	// Обрабатываем команду и получаем вывод
-	resultSegments := t.processCommand(expandedCmd)
+	segments := []LineSegment{
+		t.commandHeader(t.running.cmd),
+		{Text: " …", Style: tcell.StyleDefault.Foreground(tcell.ColorGray), Inline: true},
+	}
+	segments = append(segments, t.running.segments...)
+	return append(segments, t.outputLines...)
+}
 
-	// Добавляем результат команды после самой команды
-	newOutput = append(newOutput, resultSegments...)
+// statusMarker возвращает цветной маркер кода завершения последней команды
+func (t *Terminal) statusMarker() LineSegment {
+	if t.lastStatus == 0 {
+		return LineSegment{Text: " ✔", Style: tcell.StyleDefault.Foreground(tcell.ColorGreen), Inline: true}
+	}
+	return LineSegment{Text: fmt.Sprintf(" ✘ %d", t.lastStatus), Style: tcell.StyleDefault.Foreground(tcell.ColorRed), Inline: true}
+}
 
-	// Добавляем весь старый вывод ПОСЛЕ новой команды и ее результата
-	newOutput = append(newOutput, t.outputLines...)
+// processCommandTo выполняет команду. Если capture не nil, ее stdout направляется туда;
+// mode определяет, ждать ли завершения внешних команд или запустить их как задание
+func (t *Terminal) processCommandTo(cmd string, capture *os.File, mode execMode) ([]LineSegment, int) {
+	if capture != nil {
+		// Для захвата вывода любая команда выполняется как конвейер
+		return t.executePipelineTo(splitPipeline(cmd), capture, mode)
+	}
 
-	// Заменяем старый вывод на новый
-	t.outputLines = newOutput
+	// Команда с '|' вне кавычек или с перенаправлениями выполняется как конвейер
+	stages := splitPipeline(cmd)
+	if len(stages) > 1 {
+		return t.executePipeline(stages, mode)
+	}
+	sc, err := parseSimpleCommand(cmd)
+	if err != nil || len(sc.redirects) > 0 {
+		return t.executePipeline(stages, mode)
+	}
 
-	// Очищаем ввод и обновляем историю
-	t.inputBuffer = make([]rune, 0)
-	t.cursorPos = 0
-	t.history = append(t.history, cmd)
-	t.historyPos = len(t.history)
+	args, err := t.expandWords(sc.words)
+	if err != nil {
+		return []LineSegment{{Text: fmt.Sprintf("Ошибка: %s", err), Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}, 1
+	}
 
-	// Очищаем подсказки
-	t.completionSuggestion = ""
-	t.completionMatches = []string{}
-	t.completionIndex = 0
-	// Очищаем список автодополнения
+	// Присваивания без команды меняют переменные терминала, перед командой - только ее окружение
+	restore := t.applyAssignments(sc.assigns)
+	if len(args) == 0 {
+		return []LineSegment{}, 0
+	}
+	defer restore()
+
+	if t.isBuiltinCall(args) {
+		segments, status, _ := t.runBuiltin(args)
+		return segments, status
+	}
+
+	// Внешняя команда запускается как конвейер из одной стадии
+	return t.launchPipeline([]pipelineStage{newPipelineStage(args, nil, nil)}, cmd, nil, mode)
 }
 
-func (t *Terminal) processCommand(cmd string) []LineSegment {
-	args := t.parseArgs(cmd)
-	if len(args) == 0 {
-		return []LineSegment{}
+// builtinCommands - имена всех встроенных команд, обрабатываемых runBuiltin
+var builtinCommands = map[string]bool{
+	"exit": true, "quit": true, "clear": true, "echo": true, "pwd": true,
+	"time": true, "colors": true, "help": true, "history": true, "cd": true,
+	"ls": true, "date": true, "whoami": true, "run": true, "alias": true,
+	"unalias": true, "export": true, "unset": true, "set": true, "env": true, "complete": true,
+	"jobs": true, "fg": true, "bg": true, "wait": true,
+}
+
+// isBuiltin проверяет, является ли команда встроенной
+func (t *Terminal) isBuiltin(name string) bool {
+	return builtinCommands[name]
+}
+
+// isBuiltinCall проверяет, выполняется ли вызов встроенной командой:
+// "run команда" и "env ИМЯ=значение команда" запускают внешние программы
+func (t *Terminal) isBuiltinCall(args []string) bool {
+	if (args[0] == "run" || args[0] == "env") && len(args) > 1 {
+		return false
 	}
+	return t.isBuiltin(args[0])
+}
 
+// runBuiltin выполняет встроенную команду и возвращает ее вывод и код завершения;
+// последний результат false, если команда не встроенная
+func (t *Terminal) runBuiltin(args []string) ([]LineSegment, int, bool) {
 	var segments []LineSegment
+	status := 0
 
 	switch args[0] {
 	case "exit", "quit":
+		if t.subshellDepth > 0 {
+			// exit внутри $(...) завершает только подстановку
+			return []LineSegment{}, 0, true
+		}
 		t.screen.Fini()
 		os.Exit(0)
 	case "clear":
 		t.outputLines = []LineSegment{}
-		return []LineSegment{}
+		return []LineSegment{}, 0, true
 	case "echo":
 		if len(args) > 1 {
 			echoText := strings.Join(args[1:], " ")
@@ -1210,38 +1192,51 @@ func (t *Terminal) processCommand(cmd string) []LineSegment {
 	case "history":
 		segments = t.processHistoryCommand()
 	case "cd":
-		segments = t.processCdCommand(args)
+		segments, status = t.processCdCommand(args)
 	case "ls":
-		segments = t.processLsCommand(args)
+		segments, status = t.processLsCommand(args)
 	case "date":
 		segments = t.processDateCommand()
 	case "whoami":
-		segments = t.processWhoamiCommand()
+		segments, status = t.processWhoamiCommand()
 	case "run":
-		if len(args) > 1 {
-			segments = t.processSystemCommand(args[1:])
-		} else {
-			segments = parseANSI("Usage: run <command> [args...]", tcell.StyleDefault.
-				Foreground(tcell.ColorRed).
-				Background(tcell.ColorDefault))
-		}
+		// "run команда" выполняется как внешняя команда (см. isBuiltinCall)
+		segments = parseANSI("Usage: run <command> [args...]", tcell.StyleDefault.
+			Foreground(tcell.ColorRed).
+			Background(tcell.ColorDefault))
+		status = 1
 	case "alias":
-		segments = t.processAliasCommand(args)
+		segments, status = t.processAliasCommand(args)
 	case "unalias":
-		segments = t.processUnaliasCommand(args)
+		segments, status = t.processUnaliasCommand(args)
 	case "export":
-		segments = t.processExportCommand(args)
+		segments, status = t.processExportCommand(args)
+	case "unset":
+		segments, status = t.processUnsetCommand(args)
+	case "set":
+		segments, status = t.processSetCommand(args)
+	case "complete":
+		segments, status = t.processCompleteCommand(args)
 	case "env":
+		// "env ИМЯ=значение команда" выполняет системный env (см. isBuiltinCall)
 		segments = t.processEnvCommand()
+	case "jobs":
+		segments, status = t.processJobsCommand(args)
+	case "fg":
+		segments, status = t.processFgCommand(args)
+	case "bg":
+		segments, status = t.processBgCommand(args)
+	case "wait":
+		segments, status = t.processWaitCommand(args)
 	default:
-		segments = t.processSystemCommand(args)
+		return nil, 0, false
 	}
 
-	return segments
+	return segments, status, true
 }
 
-func (t *Terminal) processLsCommand(args []string) []LineSegment {
-	dir := "."
+func (t *Terminal) processLsCommand(args []string) ([]LineSegment, int) {
+	var targets []string
 	longFormat := false
 	showHidden := false
 	onePerLine := false
@@ -1258,55 +1253,107 @@ func (t *Terminal) processLsCommand(args []string) []LineSegment {
 			longFormat = true
 			showHidden = true
 		} else if !strings.HasPrefix(arg, "-") {
-			dir = arg
+			// После раскрытия шаблонов аргументов может быть несколько: ls src/*.go
+			targets = append(targets, arg)
 		}
 	}
+	if len(targets) == 0 {
+		targets = []string{"."}
+	}
 
-	entries, err := os.ReadDir(dir)
-	if err != nil {
-		return []LineSegment{{Text: "Error reading directory", Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}
+	var result []LineSegment
+	status := 0
+
+	// Сначала файлы, переданные явно, затем содержимое директорий
+	var files []os.FileInfo
+	var dirs []string
+	for _, target := range targets {
+		info, err := os.Stat(target)
+		if err != nil {
+			result = append(result, LineSegment{Text: fmt.Sprintf("ls: %s: нет такого файла или директории", target), Style: tcell.StyleDefault.Foreground(tcell.ColorRed)})
+			status = 1
+			continue
+		}
+		if info.IsDir() {
+			dirs = append(dirs, target)
+		} else {
+			files = append(files, namedFileInfo{FileInfo: info, name: target})
+		}
+	}
+	if len(files) > 0 {
+		result = append(result, formatLsEntries(files, longFormat, onePerLine)...)
 	}
 
-	var validEntries []os.DirEntry
-	for _, entry := range entries {
-		if !showHidden && strings.HasPrefix(entry.Name(), ".") {
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			result = append(result, LineSegment{Text: "Error reading directory", Style: tcell.StyleDefault.Foreground(tcell.ColorRed)})
+			status = 1
 			continue
 		}
-		validEntries = append(validEntries, entry)
+
+		var validEntries []os.FileInfo
+		for _, entry := range entries {
+			if !showHidden && strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			validEntries = append(validEntries, info)
+		}
+
+		// Несколько директорий выводим с заголовками, как системный ls
+		if len(targets) > 1 {
+			result = append(result, LineSegment{Text: dir + ":", Style: tcell.StyleDefault.Foreground(tcell.ColorTeal)})
+		}
+		result = append(result, formatLsEntries(validEntries, longFormat, onePerLine)...)
 	}
 
+	return result, status
+}
+
+// namedFileInfo - os.FileInfo с именем в том виде, в котором его передали в ls
+type namedFileInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (f namedFileInfo) Name() string {
+	return f.name
+}
+
+// formatLsEntries форматирует список файлов для ls
+func formatLsEntries(entries []os.FileInfo, longFormat, onePerLine bool) []LineSegment {
 	// Для -1 или -l - каждый элемент на отдельной строке
 	if onePerLine || longFormat {
 		var result []LineSegment
-		for _, entry := range validEntries { // Убрали i, так как он не используется
+		for _, info := range entries {
 			var line string
 			if longFormat {
-				info, err := entry.Info()
-				if err != nil {
-					continue
-				}
 				fileType := "-"
-				if entry.IsDir() {
+				if info.IsDir() {
 					fileType = "d"
 				}
-				line = fmt.Sprintf("%s %8d %s %s", fileType, info.Size(), info.ModTime().Format("Jan 02 15:04"), entry.Name())
+				line = fmt.Sprintf("%s %8d %s %s", fileType, info.Size(), info.ModTime().Format("Jan 02 15:04"), info.Name())
 			} else {
-				line = entry.Name()
+				line = info.Name()
 			}
 
 			// Каждая строка - отдельный сегмент
 			result = append(result, LineSegment{Text: line, Style: tcell.StyleDefault.Foreground(tcell.ColorWhite)})
 		}
 		return result
-	} else {
-		// Обычный ls - все в одну строку
-		var names []string
-		for _, entry := range validEntries {
-			names = append(names, entry.Name())
-		}
-		combined := strings.Join(names, "  ")
-		return []LineSegment{{Text: combined, Style: tcell.StyleDefault.Foreground(tcell.ColorWhite)}}
 	}
+
+	// Обычный ls - все в одну строку
+	var names []string
+	for _, info := range entries {
+		names = append(names, info.Name())
+	}
+	combined := strings.Join(names, "  ")
+	return []LineSegment{{Text: combined, Style: tcell.StyleDefault.Foreground(tcell.ColorWhite)}}
 }
 
 func (t *Terminal) processColorDemo() []LineSegment {
@@ -1373,8 +1420,23 @@ func (t *Terminal) processHelpCommand() []LineSegment {
 		{"help", "Показать это сообщение"},
 		{"run <команда>", "Выполнить системную команду"},
 		{"<команда>", "Выполнить системную команду напрямую"},
+		{"<команда> | <команда>", "Передать вывод одной команды на вход другой"},
+		{"<команда> > <файл>", "Перенаправить вывод (>, >>, <, 2>, 2>&1, &>)"},
+		{"<команда> && <команда>", "Выполнить команды по порядку (;, &&, ||)"},
 		{"alias [имя[=команда]]", "Определить или показать алиасы"},
 		{"unalias <имя>", "Удалить алиас"},
+		{"export ИМЯ=значение", "Установить переменную окружения"},
+		{"unset <имя>", "Удалить переменную окружения"},
+		{"env", "Показать переменные окружения"},
+		{"set -o|+o <опция>", "Включить или выключить опцию (nomatch, dotglob)"},
+		{"complete -C <команда> <имя>", "Дополнять аргументы имени выводом команды"},
+		{"complete -r <имя>", "Убрать дополнение аргументов"},
+		{"$(команда), `команда`", "Подставить вывод команды"},
+		{"<команда> &", "Запустить команду в фоне"},
+		{"jobs [-l] [-p]", "Показать задания"},
+		{"fg [%N], bg [%N]", "Продолжить задание на переднем плане или в фоне"},
+		{"wait [%N]", "Дождаться завершения фоновых заданий"},
+		{"{a,b} {1..10} ~", "Раскрыть фигурные скобки и домашнюю директорию"},
 	}
 
 	// Находим максимальную длину команд для выравнивания
@@ -1468,23 +1530,29 @@ func (t *Terminal) processHistoryCommand() []LineSegment {
 	return segments
 }
 
-func (t *Terminal) processCdCommand(args []string) []LineSegment {
+func (t *Terminal) processCdCommand(args []string) ([]LineSegment, int) {
 	if len(args) < 2 {
 		homeDir, err := os.UserHomeDir()
 		if err != nil {
 			errorMsg := fmt.Sprintf("Ошибка: %s", err)
-			return []LineSegment{{Text: errorMsg, Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}
+			return []LineSegment{{Text: errorMsg, Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}, 1
 		}
 		args = []string{"cd", homeDir}
 	}
 
+	oldDir, _ := os.Getwd()
 	err := os.Chdir(args[1])
 	if err != nil {
 		errorMsg := fmt.Sprintf("Ошибка: %s", err)
-		return []LineSegment{{Text: errorMsg, Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}
+		return []LineSegment{{Text: errorMsg, Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}, 1
 	}
 
-	return []LineSegment{}
+	// Обновляем PWD/OLDPWD, которые видят дочерние процессы
+	newDir, _ := os.Getwd()
+	t.envVars["OLDPWD"] = oldDir
+	t.envVars["PWD"] = newDir
+
+	return []LineSegment{}, 0
 }
 
 func (t *Terminal) processDateCommand() []LineSegment {
@@ -1500,24 +1568,24 @@ func (t *Terminal) processDateCommand() []LineSegment {
 		Background(tcell.ColorDefault))
 }
 
-func (t *Terminal) processWhoamiCommand() []LineSegment {
+func (t *Terminal) processWhoamiCommand() ([]LineSegment, int) {
 	// Получаем информацию о текущем пользователе
 	currentUser, err := user.Current()
 	if err != nil {
 		errorMsg := fmt.Sprintf("\033[31mError: %s\033[0m", err)
-		return parseANSI(errorMsg, tcell.StyleDefault)
+		return parseANSI(errorMsg, tcell.StyleDefault), 1
 	}
 
 	return parseANSI(currentUser.Username, tcell.StyleDefault.
 		Foreground(tcell.ColorGreen).
-		Background(tcell.ColorDefault))
+		Background(tcell.ColorDefault)), 0
 }
 
-func (t *Terminal) processAliasCommand(args []string) []LineSegment {
+func (t *Terminal) processAliasCommand(args []string) ([]LineSegment, int) {
 	// Если нет аргументов, выводим список всех алиасов
 	if len(args) <= 1 {
 		if len(t.aliases) == 0 {
-			return []LineSegment{{Text: "Алиасы не определены. Используйте 'alias имя=команда' для создания алиаса.", Style: tcell.StyleDefault.Foreground(tcell.ColorWhite)}}
+			return []LineSegment{{Text: "Алиасы не определены. Используйте 'alias имя=команда' для создания алиаса.", Style: tcell.StyleDefault.Foreground(tcell.ColorWhite)}}, 0
 		}
 
 		var segments []LineSegment
@@ -1525,14 +1593,14 @@ func (t *Terminal) processAliasCommand(args []string) []LineSegment {
 			line := fmt.Sprintf("%s='%s'", alias, command)
 			segments = append(segments, LineSegment{Text: line, Style: tcell.StyleDefault.Foreground(tcell.ColorWhite)})
 		}
-		return segments
+		return segments, 0
 	}
 
 	// Проверяем формат аргумента
 	arg := args[1]
 	parts := strings.SplitN(arg, "=", 2)
 	if len(parts) != 2 {
-		return []LineSegment{{Text: "Неправильный формат. Используйте: alias имя='команда'", Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}
+		return []LineSegment{{Text: "Неправильный формат. Используйте: alias имя='команда'", Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}, 1
 	}
 
 	alias := parts[0]
@@ -1544,22 +1612,22 @@ func (t *Terminal) processAliasCommand(args []string) []LineSegment {
 	// Сохраняем алиасы в файл
 	err := t.saveAliases()
 	if err != nil {
-		return []LineSegment{{Text: fmt.Sprintf("Ошибка сохранения алиаса: %s", err), Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}
+		return []LineSegment{{Text: fmt.Sprintf("Ошибка сохранения алиаса: %s", err), Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}, 1
 	}
 
-	return []LineSegment{{Text: fmt.Sprintf("Алиас '%s' установлен как '%s'", alias, command), Style: tcell.StyleDefault.Foreground(tcell.ColorGreen)}}
+	return []LineSegment{{Text: fmt.Sprintf("Алиас '%s' установлен как '%s'", alias, command), Style: tcell.StyleDefault.Foreground(tcell.ColorGreen)}}, 0
 }
 
-func (t *Terminal) processUnaliasCommand(args []string) []LineSegment {
+func (t *Terminal) processUnaliasCommand(args []string) ([]LineSegment, int) {
 	if len(args) <= 1 {
-		return []LineSegment{{Text: "Используйте: unalias имя_алиаса", Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}
+		return []LineSegment{{Text: "Используйте: unalias имя_алиаса", Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}, 1
 	}
 
 	alias := args[1]
 
 	// Проверяем, существует ли алиас
 	if _, exists := t.aliases[alias]; !exists {
-		return []LineSegment{{Text: fmt.Sprintf("Алиас '%s' не найден", alias), Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}
+		return []LineSegment{{Text: fmt.Sprintf("Алиас '%s' не найден", alias), Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}, 1
 	}
 
 	// Удаляем алиас
@@ -1568,120 +1636,104 @@ func (t *Terminal) processUnaliasCommand(args []string) []LineSegment {
 	// Сохраняем алиасы в файл
 	err := t.saveAliases()
 	if err != nil {
-		return []LineSegment{{Text: fmt.Sprintf("Ошибка сохранения алиасов: %s", err), Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}
+		return []LineSegment{{Text: fmt.Sprintf("Ошибка сохранения алиасов: %s", err), Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}, 1
 	}
 
-	return []LineSegment{{Text: fmt.Sprintf("Алиас '%s' удален", alias), Style: tcell.StyleDefault.Foreground(tcell.ColorGreen)}}
+	return []LineSegment{{Text: fmt.Sprintf("Алиас '%s' удален", alias), Style: tcell.StyleDefault.Foreground(tcell.ColorGreen)}}, 0
 }
 
-func (t *Terminal) processExportCommand(args []string) []LineSegment {
+func (t *Terminal) processExportCommand(args []string) ([]LineSegment, int) {
+	// Без аргументов export, как и env, показывает окружение
 	if len(args) <= 1 {
-		return []LineSegment{{Text: "Используйте: export ИМЯ=значение", Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}
+		return t.processEnvCommand(), 0
 	}
 
-	// Разбираем аргумент на имя и значение
-	parts := strings.SplitN(args[1], "=", 2)
-	if len(parts) != 2 {
-		return []LineSegment{{Text: "Неправильный формат. Используйте: export ИМЯ=значение", Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}
-	}
+	var segments []LineSegment
+	status := 0
+	for _, arg := range args[1:] {
+		// Разбираем аргумент на имя и значение
+		parts := strings.SplitN(arg, "=", 2)
+		if !isValidVarName(parts[0]) {
+			segments = append(segments, LineSegment{Text: fmt.Sprintf("Неправильный формат '%s'. Используйте: export ИМЯ=значение", arg), Style: tcell.StyleDefault.Foreground(tcell.ColorRed)})
+			status = 1
+			continue
+		}
+		if len(parts) != 2 {
+			// "export ИМЯ" для уже известной переменной ничего не меняет:
+			// все переменные терминала и так передаются дочерним процессам
+			if _, exists := t.envVars[parts[0]]; !exists {
+				t.envVars[parts[0]] = ""
+			}
+			continue
+		}
 
-	name := parts[0]
-	value := parts[1]
+		name := parts[0]
+		value := parts[1]
 
-	// Убираем кавычки если есть
-	value = strings.Trim(value, "'\"")
+		// Устанавливаем переменную окружения
+		t.envVars[name] = value
 
-	// Устанавливаем переменную окружения
-	t.envVars[name] = value
+		segments = append(segments, LineSegment{Text: fmt.Sprintf("Переменная окружения '%s' установлена как '%s'", name, value), Style: tcell.StyleDefault.Foreground(tcell.ColorGreen)})
+	}
 
-	return []LineSegment{{Text: fmt.Sprintf("Переменная окружения '%s' установлена как '%s'", name, value), Style: tcell.StyleDefault.Foreground(tcell.ColorGreen)}}
+	return segments, status
 }
 
 func (t *Terminal) processEnvCommand() []LineSegment {
 	var segments []LineSegment
 
-	// Отображаем все переменные окружения
-	for name, value := range t.envVars {
-		line := fmt.Sprintf("%s=%s", name, value)
+	// Отображаем все переменные окружения в алфавитном порядке
+	for _, line := range t.environ() {
 		segments = append(segments, LineSegment{Text: line, Style: tcell.StyleDefault.Foreground(tcell.ColorWhite)})
 	}
 
 	return segments
 }
 
-func (t *Terminal) processSystemCommand(args []string) []LineSegment {
-	// Проверяем базовые команды которые должны работать без PTY
-	switch args[0] {
-	case "cd", "export", "alias", "unalias":
-		// Эти команды обрабатываем напрямую
-		return t.processCommand(strings.Join(args, " "))
-	default:
-		// Все остальные через PTY
-		return t.processPtyCommand(args)
-	}
-}
-
 // expandEnvVars заменяет переменные окружения в строке на их значения
 func (t *Terminal) expandEnvVars(input string) string {
-	// Заменяем переменные вида $ИМЯ или ${ИМЯ}
-	re := regexp.MustCompile(`\$([A-Za-z_][A-Za-z0-9_]*)|\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
-	return re.ReplaceAllStringFunc(input, func(match string) string {
-		// Извлекаем имя переменной
-		var varName string
-		if match[1] == '{' {
-			// Формат ${ИМЯ}
-			varName = match[2 : len(match)-1]
-		} else {
-			// Формат $ИМЯ
-			varName = match[1:]
-		}
-
-		// Проверяем в наших переменных
-		if value, exists := t.envVars[varName]; exists {
-			return value
-		}
-
-		// Проверяем в системных переменных
-		if value := os.Getenv(varName); value != "" {
-			return value
+	// Заменяем переменные вида $ИМЯ, ${ИМЯ}, ${ИМЯ:-значение}, а также $? - код последней команды
+	var result strings.Builder
+	runes := []rune(input)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] == '$' {
+			if value, next, ok := t.expandVarAt(runes, i); ok {
+				result.WriteString(value)
+				i = next - 1
+				continue
+			}
 		}
-
-		// Если переменная не найдена, возвращаем оригинальную строку
-		return match
-	})
+		result.WriteRune(runes[i])
+	}
+	return result.String()
 }
 
 func (t *Terminal) handleKeyEvent(ev *tcell.EventKey) {
+	// Клавиши внутри вставки - вставляемый текст
+	if t.paste.active {
+		t.collectPaste(ev)
+		return
+	}
+
 	// 🔴 АВАРИЙНЫЙ ВЫХОД ИЗ ЛЮБОГО РЕЖИМА
 	if ev.Key() == tcell.KeyCtrlQ {
 		log.Printf("🚨 Аварийный выход по Ctrl+Q")
-		if t.inPtyMode && t.cmd != nil && t.cmd.Process != nil {
-			log.Printf("⚡ Принудительное завершение процесса %d", t.cmd.Process.Pid)
-			t.cmd.Process.Kill()
-			t.inPtyMode = false
-			t.ptmx = nil
-			t.cmd = nil
-		}
+		// Принудительно завершаем группу процессов задания переднего плана
+		t.signalForegroundJob(syscall.SIGKILL)
 		return
 	}
 
-	if ev.Key() == tcell.KeyCtrlC && ev.Modifiers()&tcell.ModCtrl != 0 {
+	// В PTY режиме Ctrl+C передается программе: сигнал посылает драйвер терминала
+	if ev.Key() == tcell.KeyCtrlC && ev.Modifiers()&tcell.ModCtrl != 0 && !t.inPtyMode {
 		log.Printf("🚨 Глобальный Ctrl+C")
-		if t.inPtyMode && t.cmd != nil && t.cmd.Process != nil {
-			t.cmd.Process.Signal(os.Interrupt)
-		}
+		t.cancelWait()
 		return
 	}
 
 	// 🔴 ПРОСТАЯ логика для PTY режима
 	if t.inPtyMode && t.ptmx != nil {
 		log.Printf("⌨️  PTY режим - клавиша: %v, Rune: %q, Modifiers: %v", ev.Key(), ev.Rune(), ev.Modifiers())
-
-		// 🔴 ПЕРВЫЕ ПРОВЕРЯЕМ SUDO
-		if t.sudoPrompt != "" {
-			t.handleSudoInput(ev)
-			return
-		}
+		vt := t.fgJob.vt
 
 		// 🔴 ОБРАБОТКА КОМБИНАЦИЙ С ALT ПЕРВОЙ
 		if ev.Modifiers()&tcell.ModAlt != 0 {
@@ -1695,28 +1747,47 @@ func (t *Terminal) handleKeyEvent(ev *tcell.EventKey) {
 
 		switch ev.Key() {
 		case tcell.KeyRune:
+			if ev.Modifiers()&tcell.ModAlt != 0 {
+				t.ptmx.Write([]byte{0x1b}) // Alt+символ - ESC перед символом
+			}
 			t.ptmx.Write([]byte(string(ev.Rune())))
 
 		case tcell.KeyEnter:
-			t.ptmx.Write([]byte{'\n'})
+			t.ptmx.Write([]byte{'\r'})
 
 		case tcell.KeyBackspace, tcell.KeyBackspace2:
-			t.ptmx.Write([]byte{'\b'})
+			t.ptmx.Write([]byte{0x7f}) // Символ VERASE терминала
 
 		case tcell.KeyTab:
 			t.ptmx.Write([]byte{'\t'})
 
+		case tcell.KeyBacktab:
+			t.ptmx.Write([]byte("\x1b[Z")) // Shift+Tab
+
 		case tcell.KeyEscape:
 			t.ptmx.Write([]byte{0x1b})
 
-		case tcell.KeyCtrlC:
-			t.ptmx.Write([]byte{0x03}) // Ctrl+C
-
-		case tcell.KeyCtrlD:
-			t.ptmx.Write([]byte{0x04}) // Ctrl+D (EOF)
-
-		case tcell.KeyCtrlZ:
-			t.ptmx.Write([]byte{0x1a}) // Ctrl+Z (suspend)
+		// 🔴 СТРЕЛКИ И НАВИГАЦИЯ
+		case tcell.KeyUp:
+			t.ptmx.Write(vt.cursorKey('A', ev.Modifiers()))
+		case tcell.KeyDown:
+			t.ptmx.Write(vt.cursorKey('B', ev.Modifiers()))
+		case tcell.KeyRight:
+			t.ptmx.Write(vt.cursorKey('C', ev.Modifiers()))
+		case tcell.KeyLeft:
+			t.ptmx.Write(vt.cursorKey('D', ev.Modifiers()))
+		case tcell.KeyHome:
+			t.ptmx.Write(vt.cursorKey('H', ev.Modifiers()))
+		case tcell.KeyEnd:
+			t.ptmx.Write(vt.cursorKey('F', ev.Modifiers()))
+		case tcell.KeyInsert:
+			t.ptmx.Write([]byte("\x1b[2~"))
+		case tcell.KeyDelete:
+			t.ptmx.Write([]byte("\x1b[3~"))
+		case tcell.KeyPgUp:
+			t.ptmx.Write([]byte("\x1b[5~"))
+		case tcell.KeyPgDn:
+			t.ptmx.Write([]byte("\x1b[6~"))
 
 		// 🔴 ФУНКЦИОНАЛЬНЫЕ КЛАВИШИ
 		case tcell.KeyF1:
@@ -1745,12 +1816,52 @@ func (t *Terminal) handleKeyEvent(ev *tcell.EventKey) {
 			t.ptmx.Write([]byte{0x1b, '[', '2', '4', '~'}) // F12
 
 		default:
+			if ev.Key() >= tcell.KeyCtrlSpace && ev.Key() <= tcell.KeyCtrlUnderscore {
+				// Ctrl+буква - управляющий символ. Ctrl+C, Ctrl+Z и Ctrl+D драйвер терминала
+				// сам превращает в сигналы и конец файла. Остальные стадии конвейера получают
+				// сигнал раньше первой, иначе они успевают завершиться по концу ввода
+				t.forwardTTYSignal(ev.Key())
+				t.ptmx.Write([]byte{byte(ev.Key())})
+				break
+			}
 			log.Printf("❓ Необработанная клавиша в PTY: %v", ev.Key())
 		}
 		return
 	}
 
+	// Пока wait ждет заданий, ввод команд недоступен (Ctrl+C прерывает ожидание)
+	if t.running != nil {
+		return
+	}
+
+	if t.hintMode {
+		t.handleHintKey(ev)
+		return
+	}
+	if t.paste.confirm && t.handlePasteConfirmKey(ev) {
+		return
+	}
+
 	// Обработка клавиш в НЕ-PTY режиме
+	t.editor.action = editOther
+	defer func() { t.editor.last = t.editor.action }()
+	if t.picker.active {
+		t.handlePickerKey(ev)
+		return
+	}
+	if t.search.active && t.handleSearchKey(ev) {
+		return
+	}
+	if t.menu.active && t.handleMenuKey(ev) {
+		return
+	}
+	if t.options["vi"] && t.handleViKey(ev) {
+		return
+	}
+	if t.handleEditKey(ev) {
+		return
+	}
+
 	switch ev.Key() {
 	case tcell.KeyCtrlC, tcell.KeyCtrlQ:
 		t.screen.Fini()
@@ -1758,13 +1869,22 @@ func (t *Terminal) handleKeyEvent(ev *tcell.EventKey) {
 
 	case tcell.KeyEscape:
 		// Отмена операций: очистка ввода и подсказки
+		t.beginEdit(editOther)
 		t.inputBuffer = make([]rune, 0)
 		t.cursorPos = 0
 		t.completionSuggestion = ""
 
 	case tcell.KeyEnter:
 		cmd := string(t.inputBuffer)
-		if cmd != "" {
+		if ev.Modifiers()&tcell.ModAlt != 0 || needsContinuation(cmd) {
+			// Alt+Enter, незакрытая кавычка или блок, '\' в конце - команда
+			// продолжается на новой строке
+			t.beginEdit(editOther)
+			t.insertRune('\n')
+			t.completionSuggestion = ""
+			break
+		}
+		if strings.TrimSpace(cmd) != "" {
 			t.executeCommand(cmd)
 		}
 		t.completionSuggestion = "" // Сбрасываем подсказку после выполнения
@@ -1773,35 +1893,28 @@ func (t *Terminal) handleKeyEvent(ev *tcell.EventKey) {
 		if ev.Modifiers() == tcell.ModCtrl {
 			// Ctrl+стрелка вверх - прокрутка вывода вверх
 			t.scrollOffset += 1
-		} else {
-			// Обычная стрелка вверх - навигация по истории
-			if t.historyPos > 0 {
-				t.historyPos--
-				t.inputBuffer = []rune(t.history[t.historyPos])
-				t.cursorPos = len(t.inputBuffer)
-				t.updateCompletionSuggestion() // Обновляем подсказку для истории
-			}
+		} else if !t.moveCursorLine(-1) {
+			// Обычная стрелка вверх - строка выше в многострочной команде, с первой строки - история
+			t.historyPrev()
 		}
 
 	case tcell.KeyDown:
 		if ev.Modifiers() == tcell.ModCtrl {
 			// Ctrl+стрелка вниз - прокрутка вывода вниз
 			t.scrollOffset = max(0, t.scrollOffset-1)
-		} else {
-			// Обычная стрелка вниз - навигация по истории
-			if t.historyPos < len(t.history)-1 {
-				t.historyPos++
-				t.inputBuffer = []rune(t.history[t.historyPos])
-				t.cursorPos = len(t.inputBuffer)
-				t.updateCompletionSuggestion() // Обновляем подсказку для истории
-			} else if t.historyPos == len(t.history)-1 {
-				t.historyPos = len(t.history)
-				t.inputBuffer = make([]rune, 0)
-				t.cursorPos = 0
-				t.completionSuggestion = "" // Сбрасываем подсказку
-			}
+		} else if !t.moveCursorLine(1) {
+			// Обычная стрелка вниз - строка ниже в многострочной команде, с последней строки - история
+			t.historyNext()
 		}
 
+	case tcell.KeyCtrlR, tcell.KeyCtrlS:
+		// Поиск по истории: Ctrl+R - от новых команд к старым, Ctrl+S - обратно
+		t.startSearch(ev.Key() == tcell.KeyCtrlR)
+
+	case tcell.KeyCtrlO:
+		// Режим подсказок: открыть ссылку из вывода по букве
+		t.hintMode = len(t.linkAreas) > 0
+
 	case tcell.KeyPgUp:
 		// Прокрутка основного вывода вверх
 		t.scrollOffset += 5
@@ -1812,6 +1925,7 @@ func (t *Terminal) handleKeyEvent(ev *tcell.EventKey) {
 
 	case tcell.KeyBackspace, tcell.KeyBackspace2:
 		if t.cursorPos > 0 && len(t.inputBuffer) > 0 {
+			t.beginEdit(editDelete)
 			t.inputBuffer = append(t.inputBuffer[:t.cursorPos-1], t.inputBuffer[t.cursorPos:]...)
 			t.cursorPos--
 			t.updateCompletionSuggestion() // Обновляем подсказку!
@@ -1819,16 +1933,17 @@ func (t *Terminal) handleKeyEvent(ev *tcell.EventKey) {
 
 	case tcell.KeyDelete:
 		if t.cursorPos < len(t.inputBuffer) {
+			t.beginEdit(editDelete)
 			t.inputBuffer = append(t.inputBuffer[:t.cursorPos], t.inputBuffer[t.cursorPos+1:]...)
 			t.updateCompletionSuggestion() // Обновляем подсказку!
 		}
 
-	case tcell.KeyLeft:
+	case tcell.KeyLeft, tcell.KeyCtrlB:
 		if t.cursorPos > 0 {
 			t.cursorPos--
 		}
 
-	case tcell.KeyRight:
+	case tcell.KeyRight, tcell.KeyCtrlF:
 		if t.cursorPos == len(t.inputBuffer) && t.completionSuggestion != "" {
 			// Принимаем следующее слово из подсказки
 			remainingSuggestion := t.completionSuggestion
@@ -1841,6 +1956,7 @@ func (t *Terminal) handleKeyEvent(ev *tcell.EventKey) {
 				wordToAdd = remainingSuggestion // всё что осталось
 			}
 
+			t.beginEdit(editInsert)
 			t.inputBuffer = append(t.inputBuffer, []rune(wordToAdd)...)
 			t.cursorPos = len(t.inputBuffer)
 			t.completionSuggestion = remainingSuggestion[len(wordToAdd):]
@@ -1850,15 +1966,20 @@ func (t *Terminal) handleKeyEvent(ev *tcell.EventKey) {
 		}
 		// Если курсор в конце и нет подсказки - ничего не делаем
 
-	case tcell.KeyHome:
-		t.cursorPos = 0
+	case tcell.KeyHome, tcell.KeyCtrlA:
+		// Начало и конец текущей строки многострочной команды
+		t.cursorPos, _ = t.inputLineBounds(t.cursorPos)
 
-	case tcell.KeyEnd:
-		t.cursorPos = len(t.inputBuffer)
+	case tcell.KeyEnd, tcell.KeyCtrlE:
+		_, t.cursorPos = t.inputLineBounds(t.cursorPos)
 
 	case tcell.KeyTab:
+		// Дополнение слова перед курсором: имени команды или пути
+		if t.completeAtCursor() {
+			break
+		}
 		if len(t.completionMatches) > 0 {
-			// Циклическое переключение между подсказками
+			// Без вариантов дополнения - циклическое переключение между подсказками истории
 			t.completionIndex = (t.completionIndex + 1) % len(t.completionMatches)
 			currentInput := string(t.inputBuffer)
 			t.completionSuggestion = t.completionMatches[t.completionIndex][len(currentInput):]
@@ -1874,7 +1995,13 @@ func (t *Terminal) handleKeyEvent(ev *tcell.EventKey) {
 		}
 
 	case tcell.KeyRune:
+		if ev.Rune() == 'r' && ev.Modifiers()&tcell.ModAlt != 0 {
+			// Alt+R - окно выбора команды из истории
+			t.openPicker()
+			break
+		}
 		// При вводе нового символа обновляем подсказку
+		t.beginEdit(editInsert)
 		t.insertRune(ev.Rune())
 		t.updateCompletionSuggestion()
 
@@ -1883,6 +2010,34 @@ func (t *Terminal) handleKeyEvent(ev *tcell.EventKey) {
 	}
 }
 
+// historyPrev показывает в строке ввода предыдущую команду истории
+func (t *Terminal) historyPrev() {
+	if t.historyPos > 0 {
+		t.beginEdit(editOther)
+		t.historyPos--
+		t.inputBuffer = []rune(t.history[t.historyPos])
+		t.cursorPos = len(t.inputBuffer)
+		t.updateCompletionSuggestion() // Обновляем подсказку для истории
+	}
+}
+
+// historyNext показывает следующую команду истории, после последней - пустую строку
+func (t *Terminal) historyNext() {
+	if t.historyPos < len(t.history)-1 {
+		t.beginEdit(editOther)
+		t.historyPos++
+		t.inputBuffer = []rune(t.history[t.historyPos])
+		t.cursorPos = len(t.inputBuffer)
+		t.updateCompletionSuggestion() // Обновляем подсказку для истории
+	} else if t.historyPos == len(t.history)-1 {
+		t.beginEdit(editOther)
+		t.historyPos = len(t.history)
+		t.inputBuffer = make([]rune, 0)
+		t.cursorPos = 0
+		t.completionSuggestion = "" // Сбрасываем подсказку
+	}
+}
+
 func max(a, b int) int {
 	if a > b {
 		return a
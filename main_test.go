@@ -0,0 +1,12 @@
+package main
+
+// newTestTerminal создает терминал без экрана с опциями и поставщиками дополнения
+// по умолчанию и пустыми переменными и алиасами
+func newTestTerminal() *Terminal {
+	return &Terminal{
+		options:     defaultOptions(),
+		envVars:     map[string]string{},
+		aliases:     map[string]string{},
+		completions: defaultCompletions(),
+	}
+}
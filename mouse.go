@@ -0,0 +1,311 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// doubleClickTime - наибольший промежуток между щелчками двойного щелчка
+const doubleClickTime = 400 * time.Millisecond
+
+// wheelLines - на сколько строк прокручивает вывод один шаг колеса
+const wheelLines = 3
+
+// outputView - разложенный по строкам вывод, нарисованный в последний раз.
+// По нему положение мыши переводится в строку и столбец вывода
+type outputView struct {
+	x, y, width, height int
+	start               int // Первая показанная строка
+	rows                []outputRow
+}
+
+// textPos - положение в выводе: строка раскладки и столбец
+type textPos struct {
+	row, col int
+}
+
+// before сравнивает положения в порядке чтения
+func (p textPos) before(other textPos) bool {
+	return p.row < other.row || p.row == other.row && p.col < other.col
+}
+
+// selection - выделенный мышью текст вывода
+type selection struct {
+	active     bool    // Выделение есть
+	dragging   bool    // Кнопка еще нажата
+	anchor     textPos // Начало перетаскивания
+	head       textPos // Текущий конец
+	lastClick  time.Time
+	clickPos   textPos
+	pressLink  string // Ссылка под нажатой кнопкой: открывается, если мышь не сдвинулась
+	pressMoved bool
+}
+
+// bounds возвращает начало и конец выделения в порядке чтения, конец включительно
+func (s *selection) bounds() (textPos, textPos) {
+	if s.head.before(s.anchor) {
+		return s.head, s.anchor
+	}
+	return s.anchor, s.head
+}
+
+// posAt переводит положение на экране в положение в выводе
+func (v *outputView) posAt(x, y int) (textPos, bool) {
+	if y < v.y || y >= v.y+v.height || x < v.x || x >= v.x+v.width {
+		return textPos{}, false
+	}
+	row := v.start + y - v.y
+	if row >= len(v.rows) {
+		return textPos{}, false
+	}
+	return textPos{row: row, col: x - v.x}, true
+}
+
+// rowText возвращает текст строки раскладки
+func (v *outputView) rowText(row int) []rune {
+	var text []rune
+	for _, segment := range v.rows[row].segments {
+		text = append(text, []rune(segment.Text)...)
+	}
+	return text
+}
+
+// text возвращает текст между положениями from и to включительно. Строки,
+// перенесенные по ширине, склеиваются, пробелы в конце строк отбрасываются
+func (v *outputView) text(from, to textPos) string {
+	var b strings.Builder
+	for row := from.row; row <= to.row && row < len(v.rows); row++ {
+		if row > from.row && !v.rows[row].continued {
+			b.WriteString("\n")
+		}
+		line := v.rowText(row)
+		start, end := 0, len(line)
+		if row == from.row {
+			start = min(from.col, end)
+		}
+		if row == to.row {
+			end = min(to.col+1, end)
+		}
+		text := string(line[start:end])
+		if row+1 >= len(v.rows) || !v.rows[row+1].continued || row == to.row {
+			text = strings.TrimRight(text, " ")
+		}
+		b.WriteString(text)
+	}
+	return b.String()
+}
+
+// wordAt возвращает границы слова под положением pos в пределах строки раскладки
+func (v *outputView) wordAt(pos textPos) (textPos, textPos) {
+	line := v.rowText(pos.row)
+	if pos.col >= len(line) || unicode.IsSpace(line[pos.col]) {
+		return pos, pos
+	}
+	start, end := pos.col, pos.col
+	for start > 0 && !unicode.IsSpace(line[start-1]) {
+		start--
+	}
+	for end+1 < len(line) && !unicode.IsSpace(line[end+1]) {
+		end++
+	}
+	return textPos{pos.row, start}, textPos{pos.row, end}
+}
+
+// drawSelection выделяет инверсией выбранный текст в области вывода
+func (t *Terminal) drawSelection() {
+	if !t.selection.active {
+		return
+	}
+	v := &t.outputView
+	from, to := t.selection.bounds()
+	for y := 0; y < v.height; y++ {
+		row := v.start + y
+		if row < from.row || row > to.row || row >= len(v.rows) {
+			continue
+		}
+		start, end := 0, len(v.rowText(row))-1
+		if row == from.row {
+			start = from.col
+		}
+		if row == to.row {
+			end = min(end, to.col)
+		}
+		for x := start; x <= end && x < v.width; x++ {
+			ch, comb, style, _ := t.screen.GetContent(v.x+x, v.y+y)
+			t.screen.SetContent(v.x+x, v.y+y, ch, comb, style.Reverse(true))
+		}
+	}
+}
+
+// copySelection копирует выделенный текст в буфер обмена через OSC 52
+func (t *Terminal) copySelection() {
+	from, to := t.selection.bounds()
+	text := t.outputView.text(from, to)
+	if text == "" {
+		return
+	}
+	log.Printf("📋 Скопировано %d символов", len([]rune(text)))
+	t.screen.SetClipboard([]byte(text))
+}
+
+// handleMouseEvent обрабатывает мышь: колесо прокручивает вывод, перетаскивание
+// выделяет текст, двойной щелчок - слово, щелчок по ссылке открывает ее. Если
+// программа переднего плана включила режим мыши, события передаются ей
+func (t *Terminal) handleMouseEvent(ev *tcell.EventMouse) {
+	buttons := ev.Buttons()
+	previous := t.mouseButtons
+	t.mouseButtons = buttons & (tcell.Button1 | tcell.Button2 | tcell.Button3)
+	x, y := ev.Position()
+
+	if t.fgJob != nil && t.forwardMouse(ev, previous) {
+		return
+	}
+
+	switch {
+	case buttons&tcell.WheelUp != 0:
+		t.scrollWheel(wheelLines)
+	case buttons&tcell.WheelDown != 0:
+		t.scrollWheel(-wheelLines)
+	case buttons&tcell.Button1 != 0 && previous&tcell.Button1 == 0:
+		t.mousePress(x, y)
+	case buttons&tcell.Button1 != 0:
+		t.mouseDrag(x, y)
+	case previous&tcell.Button1 != 0:
+		t.mouseRelease()
+	}
+}
+
+// scrollWheel прокручивает вывод; в альтернативном экране программы без режима
+// мыши колесо, как в xterm, превращается в стрелки
+func (t *Terminal) scrollWheel(lines int) {
+	if t.fgJob != nil && t.fgJob.vt.altScreen {
+		final := byte('A')
+		if lines < 0 {
+			final = 'B'
+		}
+		for range max(lines, -lines) {
+			t.ptmx.Write(t.fgJob.vt.cursorKey(final, 0))
+		}
+		return
+	}
+	t.scrollOffset = max(0, t.scrollOffset+lines)
+}
+
+func (t *Terminal) mousePress(x, y int) {
+	sel := &t.selection
+	sel.pressLink, sel.pressMoved = t.linkAt(x, y), false
+
+	pos, ok := t.outputView.posAt(x, y)
+	if !ok {
+		sel.active, sel.dragging = false, false
+		return
+	}
+
+	// Двойной щелчок выделяет слово и сразу копирует его
+	if time.Since(sel.lastClick) < doubleClickTime && pos == sel.clickPos {
+		sel.anchor, sel.head = t.outputView.wordAt(pos)
+		sel.active, sel.dragging = true, false
+		sel.lastClick, sel.pressLink = time.Time{}, ""
+		t.copySelection()
+		return
+	}
+
+	sel.lastClick, sel.clickPos = time.Now(), pos
+	sel.anchor, sel.head = pos, pos
+	sel.active, sel.dragging = false, true
+}
+
+func (t *Terminal) mouseDrag(x, y int) {
+	sel := &t.selection
+	if !sel.dragging {
+		return
+	}
+	v := &t.outputView
+
+	// За краем области выделение продолжается до края, а вывод прокручивается
+	if y < v.y && v.start > 0 {
+		t.scrollOffset = max(0, t.scrollOffset-1)
+	} else if y >= v.y+v.height && v.start+v.height < len(v.rows) {
+		t.scrollOffset++
+	}
+	x = max(v.x, min(x, v.x+v.width-1))
+	y = max(v.y, min(y, v.y+v.height-1))
+	pos, ok := v.posAt(x, y)
+	if !ok {
+		return
+	}
+	if pos != sel.head {
+		sel.head = pos
+		sel.active, sel.pressMoved = true, true
+	}
+}
+
+func (t *Terminal) mouseRelease() {
+	sel := &t.selection
+	if sel.dragging && sel.active {
+		t.copySelection()
+	}
+	sel.dragging = false
+
+	if !sel.pressMoved && sel.pressLink != "" && t.running == nil {
+		t.openLink(sel.pressLink)
+	}
+	sel.pressLink = ""
+}
+
+// forwardMouse передает событие мыши программе переднего плана, включившей режим
+// мыши. Возвращает false, если программа мышь не запрашивала
+func (t *Terminal) forwardMouse(ev *tcell.EventMouse, previous tcell.ButtonMask) bool {
+	vt := t.fgJob.vt
+	if vt.mouseMode == 0 || t.ptmx == nil {
+		return false
+	}
+
+	// Координаты считаются от левого верхнего угла экрана задания
+	outputX, outputY, _, _ := t.outputArea()
+	x, y := ev.Position()
+	x, y = x-outputX, y-outputY
+	if x < 0 || y < 0 || x >= vt.width || y >= vt.height {
+		return true
+	}
+
+	buttons := ev.Buttons()
+	var reports [][]byte
+	switch {
+	case buttons&tcell.WheelUp != 0:
+		reports = append(reports, vt.mouseReport(vtMousePress, 64, x, y, ev.Modifiers()))
+	case buttons&tcell.WheelDown != 0:
+		reports = append(reports, vt.mouseReport(vtMousePress, 65, x, y, ev.Modifiers()))
+	default:
+		for i, button := range []tcell.ButtonMask{tcell.Button1, tcell.Button3, tcell.Button2} {
+			switch {
+			case buttons&button != 0 && previous&button == 0:
+				reports = append(reports, vt.mouseReport(vtMousePress, i, x, y, ev.Modifiers()))
+			case buttons&button == 0 && previous&button != 0:
+				reports = append(reports, vt.mouseReport(vtMouseRelease, i, x, y, ev.Modifiers()))
+			}
+		}
+		if len(reports) == 0 {
+			// Движение: с первой нажатой кнопкой или без кнопок
+			button := 3
+			for i, b := range []tcell.ButtonMask{tcell.Button1, tcell.Button3, tcell.Button2} {
+				if buttons&b != 0 {
+					button = i
+					break
+				}
+			}
+			reports = append(reports, vt.mouseReport(vtMouseMotion, button, x, y, ev.Modifiers()))
+		}
+	}
+
+	for _, report := range reports {
+		if report != nil {
+			t.ptmx.Write(report)
+		}
+	}
+	return true
+}
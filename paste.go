@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// pasteState - вставка из буфера обмена (bracketed paste)
+type pasteState struct {
+	active  bool   // Идет вставка: клавиши до конца вставки собираются в text
+	text    []rune // Вставляемый текст
+	confirm bool   // Многострочная вставка ждет подтверждения
+	input   []rune // Ввод до вставки: восстанавливается при отмене
+	cursor  int
+}
+
+// handlePasteEvent отмечает начало и конец вставки. Клавиши между ними
+// собирает collectPaste, а вставленный текст обрабатывает finishPaste
+func (t *Terminal) handlePasteEvent(ev *tcell.EventPaste) {
+	if ev.Start() {
+		t.paste.active = true
+		t.paste.text = t.paste.text[:0]
+		return
+	}
+	t.paste.active = false
+	t.finishPaste(string(t.paste.text))
+}
+
+// collectPaste добавляет клавишу к вставляемому тексту
+func (t *Terminal) collectPaste(ev *tcell.EventKey) {
+	switch key := ev.Key(); {
+	case key == tcell.KeyRune:
+		t.paste.text = append(t.paste.text, ev.Rune())
+	case key < 0x20 || key == 0x7f:
+		// Управляющие символы приходят клавишами с тем же кодом: Enter - '\r', Tab - '\t'
+		t.paste.text = append(t.paste.text, rune(key))
+	}
+}
+
+// finishPaste передает вставленный текст программе переднего плана или вставляет
+// его в строку ввода одним блоком. Многострочный текст требует подтверждения:
+// иначе каждая строка сразу выполнилась бы как команда
+func (t *Terminal) finishPaste(text string) {
+	log.Printf("📋 Вставка: %d символов", len([]rune(text)))
+
+	if t.inPtyMode && t.ptmx != nil {
+		// Как в xterm, переводы строк передаются возвратом каретки
+		text = strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\r"), "\n", "\r")
+		if t.fgJob.vt.bracketedPaste {
+			// Маркеры внутри текста убираем, чтобы вставка не могла завершиться раньше
+			text = "\x1b[200~" + strings.ReplaceAll(text, "\x1b[201~", "") + "\x1b[201~"
+		}
+		t.ptmx.Write([]byte(text))
+		return
+	}
+	if t.running != nil || t.paste.confirm {
+		return
+	}
+
+	text = strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\r", "\n")
+	text = strings.TrimRight(text, "\n")
+	if text == "" {
+		return
+	}
+
+	t.hintMode = false
+	t.paste.input = append([]rune(nil), t.inputBuffer...)
+	t.paste.cursor = t.cursorPos
+	t.beginEdit(editOther)
+	t.insertText(text)
+	t.editor.last = editOther
+	t.completionSuggestion = ""
+	t.paste.confirm = strings.Contains(text, "\n")
+	if !t.paste.confirm {
+		t.updateCompletionSuggestion()
+	}
+}
+
+// handlePasteConfirmKey обрабатывает клавишу, пока многострочная вставка ждет
+// подтверждения: Enter выполняет команды, Esc отменяет вставку. Остальные клавиши
+// редактируют вставленный текст, для них возвращается false
+func (t *Terminal) handlePasteConfirmKey(ev *tcell.EventKey) bool {
+	t.paste.confirm = false
+	switch ev.Key() {
+	case tcell.KeyEnter:
+		if ev.Modifiers()&tcell.ModAlt != 0 {
+			return false
+		}
+		t.executeCommand(string(t.inputBuffer))
+	case tcell.KeyEscape:
+		t.inputBuffer, t.cursorPos = t.paste.input, t.paste.cursor
+		t.updateCompletionSuggestion()
+	default:
+		return false
+	}
+	return true
+}
+
+// drawPasteConfirm рисует под вставленным текстом подсказку подтверждения
+func (t *Terminal) drawPasteConfirm(x, y int) {
+	lines := strings.Count(string(t.inputBuffer), "\n") + 1
+	hint := fmt.Sprintf("Вставлено строк: %d. Enter - выполнить, Esc - отменить", lines)
+	t.drawText(x, y, hint, tcell.StyleDefault.Foreground(tcell.ColorYellow))
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// pickerPreviewRows - сколько строк занимает просмотр выбранной команды
+const pickerPreviewRows = 5
+
+// historyEntry - где и с каким результатом выполнялась команда истории сессии
+type historyEntry struct {
+	dir    string // Текущий каталог при запуске
+	status int    // Код завершения
+	done   bool   // Команда завершилась, status известен
+}
+
+// pickerItem - команда в списке выбора. Для истории zsh каталог и код неизвестны
+type pickerItem struct {
+	cmd     []rune
+	entry   historyEntry
+	session bool // Команда из истории этой сессии
+}
+
+// pickerMatch - команда, подходящая под запрос, и позиции совпавших символов
+type pickerMatch struct {
+	item    *pickerItem
+	score   int
+	matches []int
+}
+
+// pickerState - окно выбора команды из истории в стиле fzf (Alt+R)
+type pickerState struct {
+	active      bool
+	query       []rune
+	items       []pickerItem  // Команды истории без повторов, от новых к старым
+	results     []pickerMatch // Команды, прошедшие фильтры и запрос, лучшие первыми
+	index       int           // Выбранная команда
+	offset      int           // Первая показанная команда
+	dirOnly     bool          // Только команды, выполненные в текущем каталоге
+	successOnly bool          // Только успешно завершившиеся команды
+	sessionOnly bool          // Только команды этой сессии
+}
+
+// openPicker открывает окно выбора команды из истории
+func (t *Terminal) openPicker() {
+	p := &t.picker
+	*p = pickerState{active: true, query: append([]rune(nil), t.inputBuffer...)}
+
+	seen := make(map[string]bool)
+	for i := len(t.history) - 1; i >= 0; i-- {
+		if cmd := t.history[i]; !seen[cmd] {
+			seen[cmd] = true
+			item := pickerItem{cmd: []rune(cmd), session: true}
+			if i < len(t.historyInfo) {
+				item.entry = t.historyInfo[i]
+			}
+			p.items = append(p.items, item)
+		}
+	}
+	for i := len(t.zshHistory) - 1; i >= 0; i-- {
+		if cmd := t.zshHistory[i]; !seen[cmd] {
+			seen[cmd] = true
+			p.items = append(p.items, pickerItem{cmd: []rune(cmd)})
+		}
+	}
+	t.updatePicker()
+}
+
+// updatePicker отбирает команды по фильтрам и запросу и сортирует их по pickerScore
+func (t *Terminal) updatePicker() {
+	p := &t.picker
+	p.results, p.index, p.offset = nil, 0, 0
+	dir, _ := os.Getwd()
+	ignoreCase := !slices.ContainsFunc(p.query, unicode.IsUpper)
+
+	for i := range p.items {
+		item := &p.items[i]
+		if p.sessionOnly && !item.session ||
+			p.dirOnly && item.entry.dir != dir ||
+			p.successOnly && !(item.entry.done && item.entry.status == 0) {
+			continue
+		}
+		if len(p.query) == 0 {
+			p.results = append(p.results, pickerMatch{item: item})
+			continue
+		}
+		if score, matches := pickerScore(item.cmd, p.query, ignoreCase); score > 0 {
+			p.results = append(p.results, pickerMatch{item: item, score: score, matches: matches})
+		}
+	}
+
+	// При равной оценке новые команды остаются выше
+	sort.SliceStable(p.results, func(i, j int) bool {
+		return p.results[i].score > p.results[j].score
+	})
+}
+
+// pickerScore оценивает команду cmd для запроса query и возвращает позиции
+// совпавших символов в cmd. Точное совпадение, префикс и подстрока (как в
+// calculateMatchScore) выше нечетких совпадений: среди них чем плотнее совпавшие
+// символы, тем выше команда. Сравнение идет по символам, поэтому позиции верны
+// и для кириллицы. 0 - команда не подходит
+func pickerScore(cmd, query []rune, ignoreCase bool) (int, []int) {
+	for start := 0; start+len(query) <= len(cmd); start++ {
+		i := 0
+		for i < len(query) && foldRune(cmd[start+i], ignoreCase) == foldRune(query[i], ignoreCase) {
+			i++
+		}
+		if i < len(query) {
+			continue
+		}
+
+		matches := make([]int, len(query))
+		for j := range matches {
+			matches[j] = start + j
+		}
+		switch {
+		case len(cmd) == len(query):
+			return 2000, matches
+		case start == 0:
+			return 1000 + len(cmd), matches
+		}
+		return 100 + len(cmd), matches
+	}
+
+	matches := fuzzyMatch(cmd, query, ignoreCase)
+	if matches == nil {
+		return 0, nil
+	}
+	gaps := matches[len(matches)-1] - matches[0] + 1 - len(matches)
+	return max(1, 99-gaps), matches
+}
+
+// handlePickerKey обрабатывает клавишу в окне выбора: ввод меняет запрос,
+// стрелки выбирают команду, Ctrl+D, Ctrl+S и Ctrl+T переключают фильтры по
+// каталогу, успешности и сессии. Enter подставляет команду в строку ввода
+func (t *Terminal) handlePickerKey(ev *tcell.EventKey) {
+	p := &t.picker
+	switch ev.Key() {
+	case tcell.KeyRune:
+		p.query = append(p.query, ev.Rune())
+		t.updatePicker()
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		if len(p.query) > 0 {
+			p.query = p.query[:len(p.query)-1]
+			t.updatePicker()
+		}
+	case tcell.KeyCtrlU:
+		p.query = p.query[:0]
+		t.updatePicker()
+	case tcell.KeyUp, tcell.KeyCtrlP:
+		p.index = max(0, p.index-1)
+	case tcell.KeyDown, tcell.KeyCtrlN:
+		p.index = max(0, min(len(p.results)-1, p.index+1))
+	case tcell.KeyPgUp:
+		p.index = max(0, p.index-10)
+	case tcell.KeyPgDn:
+		p.index = max(0, min(len(p.results)-1, p.index+10))
+	case tcell.KeyCtrlD:
+		p.dirOnly = !p.dirOnly
+		t.updatePicker()
+	case tcell.KeyCtrlS:
+		p.successOnly = !p.successOnly
+		t.updatePicker()
+	case tcell.KeyCtrlT:
+		p.sessionOnly = !p.sessionOnly
+		t.updatePicker()
+	case tcell.KeyEnter, tcell.KeyTab:
+		p.active = false
+		if len(p.results) > 0 {
+			t.beginEdit(editOther)
+			t.inputBuffer = append([]rune(nil), p.results[p.index].item.cmd...)
+			t.cursorPos = len(t.inputBuffer)
+			t.historyPos = len(t.history)
+			t.completionSuggestion = ""
+		}
+	case tcell.KeyEscape, tcell.KeyCtrlG:
+		p.active = false
+	}
+}
+
+// drawPicker рисует окно выбора поверх области вывода: строку запроса, фильтры,
+// список команд и просмотр выбранной команды целиком
+func (t *Terminal) drawPicker(x, y, width, height int) {
+	p := &t.picker
+	white := tcell.StyleDefault.Foreground(tcell.ColorWhite)
+	gray := tcell.StyleDefault.Foreground(tcell.ColorGray)
+
+	prompt := "> " + string(p.query)
+	t.drawText(x, y, prompt, white)
+	if t.cursorVisible {
+		t.drawCursor(x+len([]rune(prompt)), y)
+	}
+	counter := fmt.Sprintf("%d/%d", len(p.results), len(p.items))
+	t.drawText(x+width-len(counter), y, counter, gray)
+
+	filterX := x
+	for _, filter := range []struct {
+		on   bool
+		text string
+	}{
+		{p.dirOnly, "^D каталог"}, {p.successOnly, "^S успешные"}, {p.sessionOnly, "^T сессия"},
+	} {
+		style := gray
+		if filter.on {
+			style = tcell.StyleDefault.Foreground(tcell.ColorBlack).Background(tcell.ColorGreen)
+		}
+		t.drawText(filterX, y+1, filter.text, style)
+		filterX += len([]rune(filter.text)) + 2
+	}
+
+	listY := y + 2
+	listHeight := height - 2 - pickerPreviewRows - 1
+	if listHeight < 1 {
+		listHeight = max(0, height-2)
+	}
+	if p.index < p.offset {
+		p.offset = p.index
+	} else if p.index >= p.offset+listHeight {
+		p.offset = p.index - listHeight + 1
+	}
+
+	for row := 0; row < listHeight && p.offset+row < len(p.results); row++ {
+		i := p.offset + row
+		t.drawPickerRow(x, listY+row, width, p.results[i], i == p.index)
+	}
+
+	if listHeight == height-2-pickerPreviewRows-1 && len(p.results) > 0 {
+		t.drawPickerPreview(x, listY+listHeight, width, p.results[p.index].item)
+	}
+}
+
+// drawPickerRow рисует команду списка: отметку результата, команду с выделенными
+// совпадениями и каталог, в котором она выполнялась
+func (t *Terminal) drawPickerRow(x, y, width int, match pickerMatch, selected bool) {
+	base := tcell.StyleDefault.Foreground(tcell.ColorWhite)
+	if selected {
+		base = base.Background(tcell.ColorDarkBlue)
+		for col := x; col < x+width; col++ {
+			t.screen.SetContent(col, y, ' ', nil, base)
+		}
+	}
+
+	entry := match.item.entry
+	switch {
+	case entry.done && entry.status == 0:
+		t.drawText(x, y, "✔", base.Foreground(tcell.ColorGreen))
+	case entry.done:
+		t.drawText(x, y, "✘", base.Foreground(tcell.ColorRed))
+	}
+
+	dir := ""
+	if entry.dir != "" {
+		dir = " " + entry.dir
+	}
+	end := x + width - len([]rune(dir))
+	t.drawText(end, y, dir, base.Foreground(tcell.ColorGray))
+
+	col := x + 2
+	next := 0
+	for i, r := range match.item.cmd {
+		if col >= end {
+			break
+		}
+		style := base
+		if next < len(match.matches) && match.matches[next] == i {
+			style = style.Foreground(tcell.ColorYellow).Bold(true)
+			next++
+		}
+		if r == '\n' {
+			r = '↵'
+		}
+		t.screen.SetContent(col, y, r, nil, style)
+		col++
+	}
+}
+
+// drawPickerPreview рисует под списком выбранную команду целиком
+func (t *Terminal) drawPickerPreview(x, y, width int, item *pickerItem) {
+	gray := tcell.StyleDefault.Foreground(tcell.ColorGray)
+	title := "─ "
+	if item.entry.dir != "" {
+		title += item.entry.dir + " "
+	}
+	if item.entry.done {
+		title += fmt.Sprintf("(код %d) ", item.entry.status)
+	}
+	title += strings.Repeat("─", max(0, width-len([]rune(title))))
+	t.drawText(x, y, title, gray)
+
+	var rows []string
+	for _, line := range strings.Split(string(item.cmd), "\n") {
+		text := []rune(line)
+		for len(text) > width {
+			rows = append(rows, string(text[:width]))
+			text = text[width:]
+		}
+		rows = append(rows, string(text))
+	}
+	for i := 0; i < pickerPreviewRows && i < len(rows); i++ {
+		t.drawText(x, y+1+i, rows[i], tcell.StyleDefault.Foreground(tcell.ColorWhite))
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"unicode"
+)
+
+func TestPickerScore(t *testing.T) {
+	tests := []struct {
+		cmd, query string
+		score      int
+		matches    []int
+	}{
+		{"git status", "git status", 2000, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{"git status", "git", 1010, []int{0, 1, 2}},
+		{"git status", "stat", 110, []int{4, 5, 6, 7}},
+		{"git status", "gst", 96, []int{0, 4, 5}},
+		{"git status", "xyz", 0, nil},
+		{"GIT Status", "git", 1010, []int{0, 1, 2}},
+		// Кириллица: позиции - номера символов, а не байтов
+		{"echo Привет мир", "мир", 115, []int{12, 13, 14}},
+		{"echo Привет мир", "привет", 115, []int{5, 6, 7, 8, 9, 10}},
+		{"echo Привет мир", "пм", 93, []int{5, 12}},
+		{"Ёлка ёж", "ёж", 107, []int{5, 6}},
+		{"ПРИВЕТ", "привет", 2000, []int{0, 1, 2, 3, 4, 5}},
+	}
+	for _, tt := range tests {
+		query := []rune(tt.query)
+		ignoreCase := !slices.ContainsFunc(query, unicode.IsUpper)
+		score, matches := pickerScore([]rune(tt.cmd), query, ignoreCase)
+		if score != tt.score || !slices.Equal(matches, tt.matches) {
+			t.Errorf("pickerScore(%q, %q) = %d %v, ожидалось %d %v", tt.cmd, tt.query, score, matches, tt.score, tt.matches)
+		}
+	}
+
+	// Запрос с заглавными буквами учитывает регистр
+	if score, _ := pickerScore([]rune("привет"), []rune("Привет"), false); score != 0 {
+		t.Errorf("регистр не учтен: %d", score)
+	}
+}
+
+func TestUpdatePicker(t *testing.T) {
+	term := newTestTerminal()
+	for _, cmd := range []string{"ls Документы", "cd Документы/проект", "echo документ"} {
+		term.picker.items = append(term.picker.items, pickerItem{cmd: []rune(cmd)})
+	}
+	term.picker.query = []rune("док")
+	term.updatePicker()
+
+	var got []string
+	for _, result := range term.picker.results {
+		highlighted := ""
+		for _, i := range result.matches {
+			highlighted += string(result.item.cmd[i])
+		}
+		got = append(got, string(result.item.cmd)+": "+highlighted)
+	}
+	want := []string{"cd Документы/проект: Док", "echo документ: док", "ls Документы: Док"}
+	if !slices.Equal(got, want) {
+		t.Errorf("результаты %q, ожидалось %q", got, want)
+	}
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// pipelineBuiltins - встроенные команды, вывод которых можно передавать по конвейеру
+var pipelineBuiltins = map[string]bool{
+	"echo": true, "pwd": true, "time": true, "colors": true,
+	"help": true, "history": true, "ls": true, "date": true,
+	"whoami": true, "alias": true, "env": true, "complete": true,
+}
+
+// splitPipeline разбивает команду на стадии конвейера по оператору '|'
+func splitPipeline(input string) []string {
+	tokens, err := lex(input)
+	if err != nil {
+		return []string{strings.TrimSpace(input)}
+	}
+
+	var stages []string
+	runes := []rune(input)
+	start := 0
+	for _, tok := range tokens {
+		if tok.kind == tokenOperator && tok.text == "|" {
+			// Граница стадии конвейера
+			stages = append(stages, strings.TrimSpace(string(runes[start:tok.start])))
+			start = tok.end
+		}
+	}
+
+	stages = append(stages, strings.TrimSpace(string(runes[start:])))
+	return stages
+}
+
+// segmentsToText преобразует вывод встроенной команды в байты для следующей стадии
+func segmentsToText(segments []LineSegment) string {
+	var text strings.Builder
+	for _, segment := range segments {
+		// Явные переносы строк уже учтены - каждый не-inline сегмент выводится с новой строки
+		if segment.Text == "\n" {
+			continue
+		}
+		if text.Len() > 0 && !segment.Inline && !strings.HasSuffix(text.String(), "\n") {
+			text.WriteString("\n")
+		}
+		text.WriteString(segment.Text)
+	}
+	if text.Len() > 0 && !strings.HasSuffix(text.String(), "\n") {
+		text.WriteString("\n")
+	}
+	return text.String()
+}
+
+// pipelineStage - разобранная стадия конвейера
+type pipelineStage struct {
+	args      []string
+	assigns   []string // Присваивания перед командой, действующие только на эту стадию
+	redirects []redirection
+	external  bool // Команда запущена через "run" и не должна считаться встроенной
+}
+
+// executePipeline выполняет конвейер, соединяя stdout каждой стадии со stdin следующей через pipe.
+// Одиночная команда с перенаправлениями выполняется как конвейер из одной стадии
+func (t *Terminal) executePipeline(stages []string, mode execMode) ([]LineSegment, int) {
+	return t.executePipelineTo(stages, nil, mode)
+}
+
+// executePipelineTo разбирает стадии конвейера и запускает его, направляя stdout
+// последней стадии в capture. Если capture равен nil, вывод возвращается вместе с stderr
+func (t *Terminal) executePipelineTo(stages []string, capture *os.File, mode execMode) ([]LineSegment, int) {
+	log.Printf("🔗 Выполнение конвейера: %v", stages)
+
+	parsed := make([]pipelineStage, len(stages))
+	for i, stage := range stages {
+		// Алиас первой стадии уже раскрыт при выполнении списка команд
+		if i > 0 {
+			stage = t.expandAliases(stage)
+		}
+		sc, err := parseSimpleCommand(stage)
+		if err != nil {
+			return []LineSegment{{Text: fmt.Sprintf("Ошибка: %s", err), Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}, 1
+		}
+		if len(sc.words) == 0 && len(sc.assigns) == 0 && (len(stages) > 1 || len(sc.redirects) == 0) {
+			return []LineSegment{{Text: "Ошибка: синтаксическая ошибка рядом с '|'", Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}, 1
+		}
+		if err := t.expandRedirectTargets(sc.redirects); err != nil {
+			return []LineSegment{{Text: fmt.Sprintf("Ошибка: %s", err), Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}, 1
+		}
+		args, err := t.expandWords(sc.words)
+		if err != nil {
+			return []LineSegment{{Text: fmt.Sprintf("Ошибка: %s", err), Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}, 1
+		}
+		parsed[i] = newPipelineStage(args, sc.assigns, sc.redirects)
+	}
+
+	return t.launchPipeline(parsed, strings.Join(stages, " | "), capture, mode)
+}
+
+// newPipelineStage создает стадию конвейера; ведущий "run" означает внешнюю команду
+func newPipelineStage(args, assigns []string, redirects []redirection) pipelineStage {
+	external := false
+	if len(args) > 1 && args[0] == "run" {
+		args = args[1:]
+		external = true
+	}
+	return pipelineStage{args: args, assigns: assigns, redirects: redirects, external: external}
+}
+
+// runsAsBuiltin проверяет, выполняется ли стадия встроенной командой терминала
+func (t *Terminal) runsAsBuiltin(stage pipelineStage, stages int) bool {
+	return !stage.external && (pipelineBuiltins[stage.args[0]] || stages == 1) && t.isBuiltinCall(stage.args)
+}
+
+// pipelineNeedsJob проверяет, есть ли в конвейере внешние команды
+func (t *Terminal) pipelineNeedsJob(parsed []pipelineStage) bool {
+	for _, stage := range parsed {
+		if len(stage.args) > 0 && !t.runsAsBuiltin(stage, len(parsed)) {
+			return true
+		}
+	}
+	return false
+}
+
+// launchPipeline запускает разобранный конвейер. В режиме execWait ожидает завершения
+// и возвращает вывод; иначе внешние команды становятся заданием со своим PTY (см. jobs.go)
+func (t *Terminal) launchPipeline(parsed []pipelineStage, cmdText string, capture *os.File, mode execMode) ([]LineSegment, int) {
+	j := &job{cmdText: cmdText}
+
+	// Общий канал для stdout последней стадии и stderr всех стадий (как CombinedOutput).
+	// У задания это PTY: программы видят настоящий терминал, а вывод разбирает эмулятор
+	var outR, outW, tty, stdin *os.File
+	if mode != execWait && t.pipelineNeedsJob(parsed) {
+		var err error
+		tty, err = t.openJobPty(j)
+		if err != nil {
+			return []LineSegment{{Text: fmt.Sprintf("Ошибка PTY: %s", err), Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}, 1
+		}
+		stdin, outW = tty, tty
+	} else {
+		var err error
+		outR, outW, err = os.Pipe()
+		if err != nil {
+			return []LineSegment{{Text: fmt.Sprintf("Ошибка pipe: %s", err), Style: tcell.StyleDefault.Foreground(tcell.ColorRed)}}, 1
+		}
+	}
+
+	var cmds []*exec.Cmd
+	var lastCmd *exec.Cmd
+	var builtins sync.WaitGroup
+	var builtinSegments []LineSegment
+	var lastErr error
+	lastStatus := 0
+	lastExternal := false
+
+	for i, stage := range parsed {
+		last := i == len(parsed)-1
+
+		stdout := outW
+		if capture != nil {
+			stdout = capture
+		}
+		var nextStdin *os.File
+		var toClose []*os.File
+		if !last {
+			r, w, err := os.Pipe()
+			if err != nil {
+				log.Printf("❌ Ошибка создания pipe: %v", err)
+				fmt.Fprintf(outW, "Ошибка pipe: %s\n", err)
+				break
+			}
+			stdout = w
+			nextStdin = r
+			toClose = append(toClose, w)
+		}
+
+		stdio, opened, err := applyRedirections(stage.redirects, [3]*os.File{stdin, stdout, outW})
+		toClose = append(toClose, opened...)
+
+		switch {
+		case err != nil:
+			log.Printf("❌ Ошибка перенаправления %v: %v", stage.args, err)
+			if !last {
+				// Ошибку последней стадии показывает итоговое сообщение
+				fmt.Fprintf(outW, "Ошибка: %s\n", err)
+			}
+			lastErr = err
+			lastStatus = 1
+			closeFiles(toClose)
+
+		case len(stage.args) == 0:
+			// Только перенаправления и присваивания без команды: файлы уже созданы
+			if len(parsed) == 1 {
+				t.applyAssignments(stage.assigns)
+			}
+			lastErr = nil
+			lastStatus = 0
+			closeFiles(toClose)
+
+		case t.runsAsBuiltin(stage, len(parsed)):
+			restore := t.applyAssignments(stage.assigns)
+			segments, status, _ := t.runBuiltin(stage.args)
+			restore()
+			lastErr = nil
+			lastStatus = status
+			lastExternal = false
+
+			if last && stdio[1] == outW {
+				// Вывод на экран сохраняет стили встроенной команды
+				builtinSegments = append(builtinSegments, segments...)
+				closeFiles(toClose)
+				break
+			}
+
+			text := segmentsToText(segments)
+			builtins.Add(1)
+			go func(w *os.File, files []*os.File) {
+				defer builtins.Done()
+				if w != nil {
+					w.WriteString(text)
+				}
+				closeFiles(files)
+			}(stdio[1], toClose)
+
+		default:
+			cmd := exec.Command(stage.args[0], stage.args[1:]...)
+			restore := t.applyAssignments(stage.assigns)
+			cmd.Env = t.environ()
+			restore()
+			if stdio[0] != nil {
+				cmd.Stdin = stdio[0]
+			}
+			if stdio[1] != nil {
+				cmd.Stdout = stdio[1]
+			}
+			if stdio[2] != nil {
+				cmd.Stderr = stdio[2]
+			}
+			if tty != nil {
+				// Каждая стадия - в своей сессии. Первая получает PTY управляющим терминалом:
+				// ей драйвер доставляет Ctrl+C и Ctrl+Z, и она может открыть /dev/tty
+				cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+				if j.pgid == 0 {
+					cmd.SysProcAttr.Setctty = true
+					cmd.SysProcAttr.Ctty = ttyDescriptor(cmd, stdio, tty)
+				}
+			}
+			lastExternal = true
+
+			if err := cmd.Start(); err != nil {
+				log.Printf("❌ Ошибка запуска стадии %v: %v", stage.args, err)
+				if !last {
+					fmt.Fprintf(outW, "Ошибка: %s\n", err)
+				}
+				lastErr = err
+				lastStatus = exitStatus(err)
+			} else {
+				log.Printf("✅ Стадия запущена, PID: %d", cmd.Process.Pid)
+				cmds = append(cmds, cmd)
+				if j.pgid == 0 {
+					j.pgid = cmd.Process.Pid
+				}
+				if last {
+					lastCmd = cmd
+				}
+				lastErr = nil
+				lastStatus = 0
+			}
+
+			// Копии дескрипторов в нашем процессе больше не нужны
+			closeFiles(toClose)
+		}
+
+		// Встроенная команда не читает stdin - закрываем его, чтобы предыдущая стадия получила EPIPE
+		if stdin != nil && stdin != tty {
+			stdin.Close()
+		}
+		stdin = nextStdin
+	}
+	if stdin != nil && stdin != tty {
+		stdin.Close()
+	}
+
+	if tty != nil {
+		// Наша копия PTY закрывается, когда встроенные команды допишут в него вывод
+		go func() {
+			builtins.Wait()
+			tty.Close()
+		}()
+
+		if len(cmds) == 0 {
+			// Ни одна внешняя команда не запустилась - дочитываем сообщения об ошибках
+			io.Copy(j.vt, j.pty)
+			j.pty.Close()
+			return pipelineResult(j.vt.take(), builtinSegments, lastErr, false), lastStatus
+		}
+
+		// Внешние процессы становятся заданием; вывод и завершение приходят асинхронно
+		for _, cmd := range cmds {
+			j.procs = append(j.procs, &jobProcess{pid: cmd.Process.Pid, process: cmd.Process, last: cmd == lastCmd})
+		}
+		j.builtinSegments = builtinSegments
+		j.startErr = lastErr
+		j.status = lastStatus
+		j.external = lastExternal
+		return t.startJob(j, mode)
+	}
+
+	var output bytes.Buffer
+	readDone := make(chan struct{})
+	go func() {
+		io.Copy(&output, outR)
+		outR.Close()
+		close(readDone)
+	}()
+
+	for _, cmd := range cmds {
+		err := cmd.Wait()
+		// Статус конвейера определяется последней стадией
+		if cmd == lastCmd {
+			lastErr = err
+			lastStatus = exitStatus(err)
+		}
+	}
+	builtins.Wait()
+	outW.Close()
+	<-readDone
+
+	var segments []LineSegment
+	if output.Len() > 0 {
+		segments = parseANSI(output.String(), tcell.StyleDefault.Foreground(tcell.ColorWhite))
+	}
+	return pipelineResult(segments, builtinSegments, lastErr, lastExternal && capture == nil), lastStatus
+}
+
+// ttyDescriptor возвращает номер дескриптора PTY в дочернем процессе. Если stdin, stdout
+// и stderr перенаправлены, PTY передается дополнительным дескриптором
+func ttyDescriptor(cmd *exec.Cmd, stdio [3]*os.File, tty *os.File) int {
+	for fd, f := range stdio {
+		if f == tty {
+			return fd
+		}
+	}
+	cmd.ExtraFiles = append(cmd.ExtraFiles, tty)
+	return 2 + len(cmd.ExtraFiles)
+}
+
+// pipelineResult собирает вывод завершившегося конвейера: stdout и stderr,
+// вывод встроенной команды последней стадии и сообщение об ошибке
+func pipelineResult(output []LineSegment, builtinSegments []LineSegment, lastErr error, noteEmpty bool) []LineSegment {
+	segments := output
+	if len(segments) == 0 && noteEmpty && lastErr == nil && len(builtinSegments) == 0 {
+		segments = []LineSegment{{Text: "[Команда выполнена без вывода]", Style: tcell.StyleDefault.Foreground(tcell.ColorWhite)}}
+	}
+	segments = append(segments, builtinSegments...)
+
+	if lastErr != nil {
+		segments = append(segments, LineSegment{Text: fmt.Sprintf("Ошибка: %s", lastErr), Style: tcell.StyleDefault.Foreground(tcell.ColorRed)})
+	}
+	return segments
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"unicode"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// killRingSize - сколько удаленных фрагментов хранит кольцо удалений
+const killRingSize = 32
+
+// editAction - вид правки строки ввода. По нему последовательные удаления
+// склеиваются в один фрагмент, Alt+Y заменяет только что вставленный текст,
+// а набранные подряд символы отменяются одним шагом
+type editAction int
+
+const (
+	editOther  editAction = iota
+	editInsert            // Ввод символов
+	editDelete            // Backspace и Delete
+	editKill              // Удаление в кольцо удалений
+	editYank              // Вставка из кольца удалений
+)
+
+// editState - снимок строки ввода для отмены
+type editState struct {
+	buffer []rune
+	cursor int
+}
+
+// lineEditor - состояние редактирования строки ввода в стиле readline
+type lineEditor struct {
+	killRing  []string    // Удаленные фрагменты, последний - в конце
+	killIndex int         // Фрагмент, вставленный последним Ctrl+Y или Alt+Y
+	yankStart int         // Начало вставленного фрагмента: Alt+Y заменяет его
+	undo      []editState // Состояния до правок, последнее - в конце
+	action    editAction  // Правка текущей клавиши
+	last      editAction  // Правка предыдущей клавиши
+	grouping  bool        // Правки объединяются в одну: повтор изменения в режиме vi
+}
+
+// beginEdit отмечает правку строки ввода и запоминает состояние для отмены.
+// Символы, набранные или стертые подряд, отменяются вместе
+func (t *Terminal) beginEdit(action editAction) {
+	e := &t.editor
+	continued := action == e.last && (action == editInsert || action == editDelete)
+	e.action = action
+	if !continued && !e.grouping {
+		e.undo = append(e.undo, editState{buffer: append([]rune(nil), t.inputBuffer...), cursor: t.cursorPos})
+	}
+}
+
+// handleEditKey обрабатывает клавиши редактирования readline: удаление слов и
+// строк в кольцо удалений, вставку из него, перестановку символов, смену
+// регистра слов и отмену. Возвращает false для остальных клавиш
+func (t *Terminal) handleEditKey(ev *tcell.EventKey) bool {
+	if ev.Modifiers()&tcell.ModAlt != 0 {
+		switch ev.Key() {
+		case tcell.KeyBackspace, tcell.KeyBackspace2:
+			t.kill(t.backwardWord(t.cursorPos), t.cursorPos)
+		case tcell.KeyRune:
+			return t.handleEditAltRune(ev.Rune())
+		default:
+			return false
+		}
+		t.updateCompletionSuggestion()
+		return true
+	}
+
+	start, end := t.inputLineBounds(t.cursorPos)
+	switch ev.Key() {
+	case tcell.KeyCtrlW:
+		t.kill(t.unixWordStart(t.cursorPos), t.cursorPos)
+	case tcell.KeyCtrlK:
+		t.kill(t.cursorPos, end)
+	case tcell.KeyCtrlU:
+		t.kill(start, t.cursorPos)
+	case tcell.KeyCtrlY:
+		t.yank()
+	case tcell.KeyCtrlT:
+		t.transposeChars()
+	case tcell.KeyCtrlUnderscore:
+		t.undoEdit()
+	default:
+		return false
+	}
+	t.updateCompletionSuggestion()
+	return true
+}
+
+// handleEditAltRune обрабатывает Alt+буква
+func (t *Terminal) handleEditAltRune(r rune) bool {
+	switch unicode.ToLower(r) {
+	case 'b':
+		t.cursorPos = t.backwardWord(t.cursorPos)
+		return true
+	case 'f':
+		t.cursorPos = t.forwardWord(t.cursorPos)
+		return true
+	case 'd':
+		t.kill(t.cursorPos, t.forwardWord(t.cursorPos))
+	case 'y':
+		t.yankPop()
+	case 'u':
+		t.changeWordCase(unicode.ToUpper, unicode.ToUpper)
+	case 'l':
+		t.changeWordCase(unicode.ToLower, unicode.ToLower)
+	case 'c':
+		t.changeWordCase(unicode.ToUpper, unicode.ToLower)
+	default:
+		return false
+	}
+	t.updateCompletionSuggestion()
+	return true
+}
+
+// isWordRune - символ слова для Alt+B/F/D: буквы и цифры, как в readline
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// forwardWord возвращает позицию конца слова после pos
+func (t *Terminal) forwardWord(pos int) int {
+	for pos < len(t.inputBuffer) && !isWordRune(t.inputBuffer[pos]) {
+		pos++
+	}
+	for pos < len(t.inputBuffer) && isWordRune(t.inputBuffer[pos]) {
+		pos++
+	}
+	return pos
+}
+
+// backwardWord возвращает позицию начала слова перед pos
+func (t *Terminal) backwardWord(pos int) int {
+	for pos > 0 && !isWordRune(t.inputBuffer[pos-1]) {
+		pos--
+	}
+	for pos > 0 && isWordRune(t.inputBuffer[pos-1]) {
+		pos--
+	}
+	return pos
+}
+
+// unixWordStart возвращает начало слова перед pos для Ctrl+W: словом считается
+// все до пробела, поэтому путь или ключ удаляется целиком
+func (t *Terminal) unixWordStart(pos int) int {
+	for pos > 0 && unicode.IsSpace(t.inputBuffer[pos-1]) {
+		pos--
+	}
+	for pos > 0 && !unicode.IsSpace(t.inputBuffer[pos-1]) {
+		pos--
+	}
+	return pos
+}
+
+// kill удаляет текст между from и to в кольцо удалений. Удаления подряд
+// склеиваются в один фрагмент, как в readline
+func (t *Terminal) kill(from, to int) {
+	if from >= to {
+		return
+	}
+	e := &t.editor
+	continued := e.last == editKill
+	t.beginEdit(editKill)
+
+	text := string(t.inputBuffer[from:to])
+	switch {
+	case continued && len(e.killRing) > 0 && from < t.cursorPos:
+		e.killRing[len(e.killRing)-1] = text + e.killRing[len(e.killRing)-1]
+	case continued && len(e.killRing) > 0:
+		e.killRing[len(e.killRing)-1] += text
+	default:
+		e.killRing = append(e.killRing, text)
+		if len(e.killRing) > killRingSize {
+			e.killRing = e.killRing[1:]
+		}
+	}
+
+	t.inputBuffer = append(t.inputBuffer[:from], t.inputBuffer[to:]...)
+	t.cursorPos = from
+}
+
+// yank вставляет последний удаленный фрагмент в позицию курсора
+func (t *Terminal) yank() {
+	e := &t.editor
+	if len(e.killRing) == 0 {
+		return
+	}
+	t.beginEdit(editYank)
+	e.killIndex = len(e.killRing) - 1
+	e.yankStart = t.cursorPos
+	t.insertText(e.killRing[e.killIndex])
+}
+
+// yankPop сразу после Ctrl+Y или Alt+Y заменяет вставленный фрагмент предыдущим
+func (t *Terminal) yankPop() {
+	e := &t.editor
+	if e.last != editYank || len(e.killRing) == 0 {
+		return
+	}
+	e.action = editYank
+	t.inputBuffer = append(t.inputBuffer[:e.yankStart], t.inputBuffer[t.cursorPos:]...)
+	t.cursorPos = e.yankStart
+	e.killIndex = (e.killIndex - 1 + len(e.killRing)) % len(e.killRing)
+	t.insertText(e.killRing[e.killIndex])
+}
+
+// insertText вставляет текст в позицию курсора
+func (t *Terminal) insertText(text string) {
+	for _, r := range text {
+		t.insertRune(r)
+	}
+}
+
+// transposeChars меняет местами символ перед курсором и символ под курсором,
+// в конце строки - два последних символа
+func (t *Terminal) transposeChars() {
+	start, end := t.inputLineBounds(t.cursorPos)
+	if end-start < 2 || t.cursorPos == start {
+		return
+	}
+	t.beginEdit(editOther)
+	if t.cursorPos == end {
+		t.cursorPos--
+	}
+	t.inputBuffer[t.cursorPos-1], t.inputBuffer[t.cursorPos] = t.inputBuffer[t.cursorPos], t.inputBuffer[t.cursorPos-1]
+	t.cursorPos++
+}
+
+// changeWordCase меняет регистр слова от курсора: первая буква - first, остальные -
+// rest. Курсор переходит в конец слова
+func (t *Terminal) changeWordCase(first, rest func(rune) rune) {
+	end := t.forwardWord(t.cursorPos)
+	if end == t.cursorPos {
+		return
+	}
+	t.beginEdit(editOther)
+	convert := first
+	for i := t.cursorPos; i < end; i++ {
+		if isWordRune(t.inputBuffer[i]) {
+			t.inputBuffer[i] = convert(t.inputBuffer[i])
+			convert = rest
+		}
+	}
+	t.cursorPos = end
+}
+
+// undoEdit отменяет последнюю правку строки ввода
+func (t *Terminal) undoEdit() {
+	e := &t.editor
+	if len(e.undo) == 0 {
+		return
+	}
+	state := e.undo[len(e.undo)-1]
+	e.undo = e.undo[:len(e.undo)-1]
+	t.inputBuffer, t.cursorPos = state.buffer, state.cursor
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// redirection описывает одно перенаправление ввода-вывода
+type redirection struct {
+	fd     int    // Перенаправляемый дескриптор: 0, 1, 2 или -1 для stdout и stderr вместе (&>)
+	op     string // "<", ">", ">>" или ">&" (дублирование дескриптора)
+	target string // Имя файла или номер дескриптора для ">&"
+}
+
+// simpleCommand - простая команда, разобранная на лексемы, до раскрытия слов
+type simpleCommand struct {
+	assigns   []string      // Присваивания ИМЯ=значение перед именем команды
+	words     []string      // Имя команды и аргументы с кавычками
+	redirects []redirection // Перенаправления в порядке их появления
+}
+
+// parseSimpleCommand разбирает простую команду (без ';', '&&', '||' и '|')
+// на присваивания, слова и перенаправления
+func parseSimpleCommand(input string) (simpleCommand, error) {
+	var sc simpleCommand
+	tokens, err := lex(input)
+	if err != nil {
+		return sc, err
+	}
+
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		switch tok.kind {
+		case tokenAssignment:
+			sc.assigns = append(sc.assigns, tok.text)
+
+		case tokenWord:
+			sc.words = append(sc.words, tok.text)
+
+		case tokenOperator:
+			return sc, fmt.Errorf("синтаксическая ошибка рядом с '%s'", tok.text)
+
+		case tokenRedirect:
+			if i+1 >= len(tokens) || (tokens[i+1].kind != tokenWord && tokens[i+1].kind != tokenAssignment) {
+				return sc, fmt.Errorf("синтаксическая ошибка рядом с '%s'", tok.text)
+			}
+			i++
+			r := redirection{fd: tok.fd, op: tok.text, target: tokens[i].text}
+
+			if r.op == ">&" {
+				switch r.target {
+				case "0", "1", "2":
+				default:
+					// ">&файл" - синоним "&>файл"
+					if r.fd != 1 {
+						return sc, fmt.Errorf("неверный дескриптор '%s'", r.target)
+					}
+					r.fd = -1
+					r.op = ">"
+				}
+			}
+			if r.fd > 2 {
+				return sc, fmt.Errorf("неверный дескриптор '%d'", r.fd)
+			}
+
+			sc.redirects = append(sc.redirects, r)
+		}
+	}
+
+	return sc, nil
+}
+
+// expandRedirectTargets раскрывает подстановки и шаблоны и убирает кавычки в именах
+// файлов перенаправлений. Имя, раскрывшееся не в одно слово, - ошибка, как в bash
+func (t *Terminal) expandRedirectTargets(redirects []redirection) error {
+	for i := range redirects {
+		if redirects[i].op == ">&" {
+			continue
+		}
+		words, err := t.expandWords([]string{redirects[i].target})
+		if err != nil {
+			return err
+		}
+		if len(words) != 1 {
+			return fmt.Errorf("%s: неоднозначное перенаправление", redirects[i].target)
+		}
+		redirects[i].target = words[0]
+	}
+	return nil
+}
+
+// applyRedirections открывает файлы перенаправлений и подменяет стандартные потоки.
+// Возвращает новые потоки и список открытых файлов, которые нужно закрыть после запуска
+func applyRedirections(redirects []redirection, stdio [3]*os.File) ([3]*os.File, []*os.File, error) {
+	var opened []*os.File
+
+	for _, r := range redirects {
+		if r.op == ">&" {
+			src := int(r.target[0] - '0')
+			stdio[r.fd] = stdio[src]
+			continue
+		}
+
+		flags := os.O_RDONLY
+		switch r.op {
+		case ">":
+			flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		case ">>":
+			flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		}
+
+		file, err := os.OpenFile(r.target, flags, 0644)
+		if err != nil {
+			closeFiles(opened)
+			return stdio, nil, err
+		}
+		opened = append(opened, file)
+
+		if r.fd == -1 {
+			stdio[1] = file
+			stdio[2] = file
+		} else {
+			stdio[r.fd] = file
+		}
+	}
+
+	return stdio, opened, nil
+}
+
+// closeFiles закрывает все переданные файлы
+func closeFiles(files []*os.File) {
+	for _, file := range files {
+		file.Close()
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExpandRedirectTargets(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.log", "b.log"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	term := newTestTerminal()
+	term.envVars = map[string]string{"DIR": dir}
+
+	tests := []struct {
+		target  string
+		want    string
+		wantErr bool
+	}{
+		{target: dir + "/a*.log", want: dir + "/a.log"},
+		{target: "'x y'", want: "x y"},
+		{target: "$DIR/out", want: dir + "/out"},
+		{target: dir + "/*.log", wantErr: true}, // Два файла - неоднозначно
+		{target: "$UNSET", wantErr: true},       // Пустое раскрытие
+		{target: "{p,q}", wantErr: true},
+	}
+	for _, tt := range tests {
+		redirects := []redirection{{fd: 1, op: ">", target: tt.target}}
+		err := term.expandRedirectTargets(redirects)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: ожидалась ошибка, получено %q", tt.target, redirects[0].target)
+			}
+			continue
+		}
+		if err != nil || redirects[0].target != tt.want {
+			t.Errorf("%s: получено %q, %v; ожидалось %q", tt.target, redirects[0].target, err, tt.want)
+		}
+	}
+}
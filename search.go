@@ -0,0 +1,225 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// searchState - поиск по истории (Ctrl+R, Ctrl+S)
+type searchState struct {
+	active  bool
+	reverse bool           // Последний шаг - к более старым командам (Ctrl+R)
+	query   []rune         // Строка поиска
+	results []searchResult // Найденные команды: сначала совпадения подстроки, затем нечеткие, новые раньше старых
+	index   int            // Показанная команда
+	failed  bool           // Шаг дальше последней найденной команды
+	input   []rune         // Ввод до поиска: восстанавливается при отмене
+	cursor  int
+}
+
+// searchResult - найденная команда и позиции совпавших символов
+type searchResult struct {
+	cmd     []rune
+	matches []int
+}
+
+// startSearch начинает поиск по истории
+func (t *Terminal) startSearch(reverse bool) {
+	t.search = searchState{
+		active:  true,
+		reverse: reverse,
+		input:   append([]rune(nil), t.inputBuffer...),
+		cursor:  t.cursorPos,
+	}
+	t.completionSuggestion = ""
+	t.updateSearch()
+}
+
+// historyCandidates возвращает команды истории терминала и zsh без повторов,
+// от новых к старым
+func (t *Terminal) historyCandidates() []string {
+	var commands []string
+	seen := make(map[string]bool)
+	for _, history := range [][]string{t.history, t.zshHistory} {
+		for i := len(history) - 1; i >= 0; i-- {
+			if cmd := history[i]; !seen[cmd] {
+				seen[cmd] = true
+				commands = append(commands, cmd)
+			}
+		}
+	}
+	return commands
+}
+
+// updateSearch ищет строку поиска в истории: сначала как подстроку, затем как
+// подпоследовательность символов. Строчные буквы в запросе совпадают с любым регистром
+func (t *Terminal) updateSearch() {
+	s := &t.search
+	s.results, s.index, s.failed = nil, 0, false
+	if len(s.query) == 0 {
+		return
+	}
+
+	ignoreCase := !strings.ContainsFunc(string(s.query), unicode.IsUpper)
+	var fuzzy []searchResult
+	for _, cmd := range t.historyCandidates() {
+		text := []rune(cmd)
+		if matches := substringMatch(text, s.query, ignoreCase); matches != nil {
+			s.results = append(s.results, searchResult{cmd: text, matches: matches})
+		} else if matches := fuzzyMatch(text, s.query, ignoreCase); matches != nil {
+			fuzzy = append(fuzzy, searchResult{cmd: text, matches: matches})
+		}
+	}
+	s.results = append(s.results, fuzzy...)
+	s.failed = len(s.results) == 0
+}
+
+// foldRune приводит символ к нижнему регистру при поиске без учета регистра
+func foldRune(r rune, ignoreCase bool) rune {
+	if ignoreCase {
+		return unicode.ToLower(r)
+	}
+	return r
+}
+
+// substringMatch возвращает позиции последнего вхождения query в text, как
+// reverse-i-search в bash, или nil
+func substringMatch(text, query []rune, ignoreCase bool) []int {
+	for start := len(text) - len(query); start >= 0; start-- {
+		i := 0
+		for i < len(query) && foldRune(text[start+i], ignoreCase) == foldRune(query[i], ignoreCase) {
+			i++
+		}
+		if i == len(query) {
+			matches := make([]int, len(query))
+			for j := range matches {
+				matches[j] = start + j
+			}
+			return matches
+		}
+	}
+	return nil
+}
+
+// fuzzyMatch возвращает позиции символов query, найденных в text по порядку, или nil
+func fuzzyMatch(text, query []rune, ignoreCase bool) []int {
+	var matches []int
+	for i := 0; i < len(text) && len(matches) < len(query); i++ {
+		if foldRune(text[i], ignoreCase) == foldRune(query[len(matches)], ignoreCase) {
+			matches = append(matches, i)
+		}
+	}
+	if len(matches) < len(query) {
+		return nil
+	}
+	return matches
+}
+
+// handleSearchKey обрабатывает клавишу в режиме поиска. Ctrl+R и Ctrl+S переходят
+// к более старой и более новой команде, Enter выполняет найденную команду, Esc и
+// Ctrl+G отменяют поиск. Другие клавиши подставляют команду в строку ввода для
+// редактирования, для них возвращается false
+func (t *Terminal) handleSearchKey(ev *tcell.EventKey) bool {
+	s := &t.search
+	switch ev.Key() {
+	case tcell.KeyRune:
+		if ev.Modifiers()&tcell.ModAlt != 0 {
+			break
+		}
+		s.query = append(s.query, ev.Rune())
+		t.updateSearch()
+		return true
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		if len(s.query) > 0 {
+			s.query = s.query[:len(s.query)-1]
+			t.updateSearch()
+		}
+		return true
+	case tcell.KeyCtrlR:
+		s.reverse = true
+		s.failed = s.index+1 >= len(s.results)
+		if !s.failed {
+			s.index++
+		}
+		return true
+	case tcell.KeyCtrlS:
+		s.reverse = false
+		s.failed = s.index == 0
+		if !s.failed {
+			s.index--
+		}
+		return true
+	case tcell.KeyEscape, tcell.KeyCtrlG:
+		s.active = false
+		t.inputBuffer, t.cursorPos = s.input, s.cursor
+		t.updateCompletionSuggestion()
+		return true
+	case tcell.KeyEnter:
+		if t.acceptSearch() {
+			t.executeCommand(string(t.inputBuffer))
+		}
+		return true
+	}
+	t.acceptSearch()
+	return false
+}
+
+// acceptSearch завершает поиск и подставляет найденную команду в строку ввода.
+// Если ничего не найдено, остается прежний ввод
+func (t *Terminal) acceptSearch() bool {
+	s := &t.search
+	s.active = false
+	if len(s.results) == 0 {
+		t.inputBuffer, t.cursorPos = s.input, s.cursor
+		return false
+	}
+	t.beginEdit(editOther)
+	t.inputBuffer = append([]rune(nil), s.results[s.index].cmd...)
+	t.cursorPos = len(t.inputBuffer)
+	t.historyPos = len(t.history)
+	t.completionSuggestion = ""
+	return true
+}
+
+// drawSearch рисует строку поиска вместо строки ввода: запрос и найденную
+// команду с выделенными совпадениями. Переводы строк показываются как ↵
+func (t *Terminal) drawSearch(x, y, width int) {
+	s := &t.search
+	label := "(reverse-i-search)`"
+	if !s.reverse {
+		label = "(i-search)`"
+	}
+	if s.failed {
+		label = "(failed " + label[1:]
+	}
+	label += string(s.query)
+	t.drawText(x, y, label+"': ", tcell.StyleDefault.Foreground(tcell.ColorWhite))
+	if t.cursorVisible {
+		t.drawCursor(x+len([]rune(label)), y)
+	}
+	if len(s.results) == 0 {
+		return
+	}
+
+	result := s.results[s.index]
+	matchStyle := tcell.StyleDefault.Foreground(tcell.ColorYellow).Bold(true).Underline(true)
+	col := x + len([]rune(label)) + 3
+	next := 0
+	for i, r := range result.cmd {
+		if col >= x+width {
+			break
+		}
+		style := tcell.StyleDefault.Foreground(tcell.ColorWhite)
+		if next < len(result.matches) && result.matches[next] == i {
+			style = matchStyle
+			next++
+		}
+		if r == '\n' {
+			r = '↵'
+		}
+		t.screen.SetContent(col, y, r, nil, style)
+		col++
+	}
+}
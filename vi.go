@@ -0,0 +1,745 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// viMode - состояние режима редактирования vi
+type viMode int
+
+const (
+	viInsert viMode = iota // Ввод текста
+	viNormal               // Команды
+	viVisual               // Выделение
+)
+
+// Результат разбора набранных клавиш командой normal-режима
+const (
+	viIncomplete = iota // Команда еще не набрана целиком
+	viInvalid           // Такой команды нет
+	viComplete
+)
+
+// viMotions - перемещения; с оператором d, c, y они задают обрабатываемый текст
+const viMotions = "hlwWbBeE0^$;,"
+
+// viCommands - команды normal-режима без оператора
+const viCommands = "xXDCsSYpPuiaIA.~vjk"
+
+// viVisualCommands - команды над выделенным текстом; j и k перемещают курсор
+// между строками многострочной команды
+const viVisualCommands = "dxcsyY~uUovjk"
+
+// viMaxCount - наибольший счетчик команды. Больший счетчик уменьшается до него:
+// иначе позиция курсора переполняется, а 999999999p занимает всю память
+const viMaxCount = 9999
+
+// viAliases - команды, которые сводятся к оператору с перемещением
+var viAliases = map[rune]string{
+	'x': "dl", 'X': "dh", 'D': "d$", 'C': "c$", 's': "cl", 'S': "cc", 'Y': "yy",
+}
+
+// viState - состояние режима vi (set -o vi)
+type viState struct {
+	mode        viMode
+	pending     []*tcell.EventKey // Клавиши недонабранной команды
+	change      []*tcell.EventKey // Клавиши изменения, которое еще продолжается вводом текста
+	recording   bool              // Ввод текста записывается в change
+	lastChange  []*tcell.EventKey // Последнее изменение: его повторяет '.'
+	replaying   bool              // Идет повтор изменения
+	register    string            // Текст последних y, d, c, x: его вставляют p и P
+	findCmd     rune              // Последний поиск f, F, t, T на строке: его повторяют ; и ,
+	findChar    rune
+	visualStart int // Второй конец выделения, первый - курсор
+}
+
+// viCommand - разобранная команда normal-режима: [счетчик][оператор[счетчик]]перемещение
+type viCommand struct {
+	count int    // Счетчик, 1 если не задан
+	op    rune   // Оператор d, c, y или 0
+	keys  []rune // Перемещение, текстовый объект или команда
+}
+
+// viPromptIndicator возвращает метку режима vi для приглашения и ее цвет
+func (t *Terminal) viPromptIndicator() (string, tcell.Style) {
+	if !t.options["vi"] {
+		return "", tcell.StyleDefault
+	}
+	switch t.vi.mode {
+	case viNormal:
+		return "[N] ", tcell.StyleDefault.Foreground(tcell.ColorYellow).Bold(true)
+	case viVisual:
+		return "[V] ", tcell.StyleDefault.Foreground(tcell.ColorFuchsia).Bold(true)
+	}
+	return "[I] ", tcell.StyleDefault.Foreground(tcell.ColorGreen).Bold(true)
+}
+
+// viSelection возвращает выделенный в visual-режиме текст ввода [from, to)
+func (t *Terminal) viSelection() (int, int, bool) {
+	if !t.options["vi"] || t.vi.mode != viVisual {
+		return 0, 0, false
+	}
+	from, to := min(t.vi.visualStart, t.cursorPos), max(t.vi.visualStart, t.cursorPos)
+	return from, min(to+1, len(t.inputBuffer)), true
+}
+
+// viKeyRune переводит клавишу normal-режима в символ команды: стрелки и
+// Backspace работают как соответствующие команды vi
+func viKeyRune(ev *tcell.EventKey) (rune, bool) {
+	switch ev.Key() {
+	case tcell.KeyRune:
+		return ev.Rune(), ev.Modifiers()&tcell.ModAlt == 0
+	case tcell.KeyLeft, tcell.KeyBackspace, tcell.KeyBackspace2:
+		return 'h', true
+	case tcell.KeyRight:
+		return 'l', true
+	case tcell.KeyHome:
+		return '0', true
+	case tcell.KeyEnd:
+		return '$', true
+	case tcell.KeyDelete:
+		return 'x', true
+	case tcell.KeyUp:
+		return 'k', true
+	case tcell.KeyDown:
+		return 'j', true
+	}
+	return 0, false
+}
+
+// handleViKey обрабатывает клавишу в режиме vi. В режиме ввода обрабатывается
+// только Esc, остальные клавиши редактируют строку как обычно; для них и для
+// клавиш, которых нет в vi (Enter, Ctrl+...), возвращается false
+func (t *Terminal) handleViKey(ev *tcell.EventKey) bool {
+	v := &t.vi
+	if v.mode == viInsert {
+		if ev.Key() == tcell.KeyEscape {
+			if v.recording && !v.replaying {
+				v.lastChange = append(v.change, ev)
+			}
+			v.recording = false
+			t.viNormalMode()
+			return true
+		}
+		if v.recording && !v.replaying {
+			v.change = append(v.change, ev)
+		}
+		return false
+	}
+
+	_, ok := viKeyRune(ev)
+	if !ok {
+		v.pending = nil
+		if ev.Key() != tcell.KeyEscape {
+			return false
+		}
+		if v.mode == viVisual {
+			v.mode = viNormal
+		}
+		return true
+	}
+
+	v.pending = append(v.pending, ev)
+	keys := make([]rune, len(v.pending))
+	for i, key := range v.pending {
+		keys[i], _ = viKeyRune(key)
+	}
+	cmd, status := parseViCommand(keys, v.mode == viVisual)
+	if status == viIncomplete {
+		return true
+	}
+	events := v.pending
+	v.pending = nil
+	if status == viInvalid {
+		return true
+	}
+
+	change := v.mode == viNormal && cmd.isChange()
+	t.runViCommand(cmd)
+	if change && !v.replaying {
+		// Изменение с вводом текста записывается до Esc
+		v.change, v.lastChange = events, events
+		v.recording = v.mode == viInsert
+	}
+	if v.mode != viInsert {
+		t.viClampCursor()
+		t.completionSuggestion = ""
+	}
+	return true
+}
+
+// parseViCommand разбирает набранные клавиши normal- или visual-режима
+func parseViCommand(keys []rune, visual bool) (viCommand, int) {
+	cmd := viCommand{count: 1}
+	i := 0
+	readCount := func() {
+		n := 0
+		for i < len(keys) && keys[i] >= '0' && keys[i] <= '9' && (n > 0 || keys[i] != '0') {
+			n = min(n*10+int(keys[i]-'0'), viMaxCount)
+			i++
+		}
+		if n > 0 {
+			// 2d3w - 6 слов; оба счетчика не больше viMaxCount, произведение не переполняется
+			cmd.count = min(cmd.count*n, viMaxCount)
+		}
+	}
+
+	readCount()
+	if i < len(keys) && !visual && strings.ContainsRune("dcy", keys[i]) {
+		cmd.op = keys[i]
+		i++
+		readCount()
+	}
+	if i == len(keys) {
+		return cmd, viIncomplete
+	}
+
+	cmd.keys = keys[i:]
+	need := 1
+	switch r := keys[i]; {
+	case strings.ContainsRune("fFtT", r), r == 'r' && cmd.op == 0 && !visual:
+		need = 2
+	case cmd.op != 0 && (r == cmd.op || r == 'j' || r == 'k'):
+		// dd, cc, yy - вся строка; dj, dk - строка вместе с соседней
+	case (cmd.op != 0 || visual) && (r == 'i' || r == 'a'):
+		need = 2
+	case strings.ContainsRune(viMotions, r):
+	case cmd.op == 0 && !visual && strings.ContainsRune(viCommands, r):
+	case visual && strings.ContainsRune(viVisualCommands, r):
+	default:
+		return cmd, viInvalid
+	}
+	if len(cmd.keys) < need {
+		return cmd, viIncomplete
+	}
+	return cmd, viComplete
+}
+
+// isChange проверяет, меняет ли команда строку ввода: такие команды повторяет '.'
+func (cmd viCommand) isChange() bool {
+	if cmd.op != 0 {
+		return cmd.op != 'y'
+	}
+	return strings.ContainsRune("xXDCsSpPiaIAr~", cmd.keys[0])
+}
+
+// viNormalMode переходит из режима ввода в normal-режим; курсор, как в vi,
+// встает на последний введенный символ
+func (t *Terminal) viNormalMode() {
+	t.vi.mode = viNormal
+	if start, _ := t.inputLineBounds(t.cursorPos); t.cursorPos > start {
+		t.cursorPos--
+	}
+	t.completionSuggestion = ""
+}
+
+// viInsertMode переходит в режим ввода
+func (t *Terminal) viInsertMode() {
+	t.vi.mode = viInsert
+	t.updateCompletionSuggestion()
+}
+
+// viClampCursor оставляет курсор normal-режима на символе строки, а не после него
+func (t *Terminal) viClampCursor() {
+	start, end := t.inputLineBounds(t.cursorPos)
+	if t.cursorPos == end && end > start {
+		t.cursorPos--
+	}
+}
+
+// runViCommand выполняет разобранную команду
+func (t *Terminal) runViCommand(cmd viCommand) {
+	v := &t.vi
+	if v.mode == viVisual {
+		t.runViVisual(cmd)
+		return
+	}
+	if alias, ok := viAliases[cmd.keys[0]]; ok && cmd.op == 0 {
+		cmd.op, cmd.keys = rune(alias[0]), []rune(alias[1:])
+	}
+	if cmd.op != 0 {
+		if from, to, ok := t.viRange(cmd); ok {
+			t.viOperate(cmd.op, from, to)
+		}
+		return
+	}
+
+	start, end := t.inputLineBounds(t.cursorPos)
+	switch r := cmd.keys[0]; r {
+	case 'i':
+		t.viInsertMode()
+	case 'a':
+		if t.cursorPos < end {
+			t.cursorPos++
+		}
+		t.viInsertMode()
+	case 'I':
+		t.cursorPos = t.firstNonBlank(start, end)
+		t.viInsertMode()
+	case 'A':
+		t.cursorPos = end
+		t.viInsertMode()
+	case 'r':
+		if t.cursorPos+cmd.count > end {
+			return
+		}
+		t.beginEdit(editOther)
+		for i := range cmd.count {
+			t.inputBuffer[t.cursorPos+i] = cmd.keys[1]
+		}
+		t.cursorPos = min(t.cursorPos+cmd.count, end) - 1
+	case '~':
+		if t.cursorPos == end {
+			return
+		}
+		t.beginEdit(editOther)
+		for ; cmd.count > 0 && t.cursorPos < end; cmd.count-- {
+			t.inputBuffer[t.cursorPos] = toggleCase(t.inputBuffer[t.cursorPos])
+			t.cursorPos++
+		}
+	case 'p', 'P':
+		if v.register == "" {
+			return
+		}
+		t.beginEdit(editOther)
+		if r == 'p' && t.cursorPos < end {
+			t.cursorPos++
+		}
+		t.insertText(strings.Repeat(v.register, cmd.count))
+		t.cursorPos--
+	case 'u':
+		for range cmd.count {
+			t.undoEdit()
+		}
+	case '.':
+		t.viRepeat(cmd.count)
+	case 'v':
+		v.mode, v.visualStart = viVisual, t.cursorPos
+	case 'j':
+		for range cmd.count {
+			if !t.moveCursorLine(1) {
+				t.historyNext()
+			}
+		}
+	case 'k':
+		for range cmd.count {
+			if !t.moveCursorLine(-1) {
+				t.historyPrev()
+			}
+		}
+	default:
+		if target, _, ok := t.viMotion(cmd.keys, cmd.count, false); ok {
+			t.cursorPos = target
+		}
+	}
+}
+
+// runViVisual выполняет команду visual-режима: перемещения меняют выделение,
+// операторы обрабатывают выделенный текст
+func (t *Terminal) runViVisual(cmd viCommand) {
+	v := &t.vi
+	from, to, _ := t.viSelection()
+	switch r := cmd.keys[0]; r {
+	case 'i', 'a':
+		if start, end, ok := t.viTextObject(r, cmd.keys[1]); ok && end > start {
+			v.visualStart, t.cursorPos = start, end-1
+		}
+		return
+	case 'o':
+		v.visualStart, t.cursorPos = t.cursorPos, v.visualStart
+		return
+	case 'j', 'k':
+		// В истории выделение не продолжается: курсор остается на крайней строке
+		delta := 1
+		if r == 'k' {
+			delta = -1
+		}
+		for range cmd.count {
+			t.moveCursorLine(delta)
+		}
+		return
+	case 'v':
+	case 'd', 'x':
+		t.viOperate('d', from, to)
+	case 'c', 's':
+		t.viOperate('c', from, to)
+		return
+	case 'y', 'Y':
+		t.viOperate('y', from, to)
+	case '~', 'u', 'U':
+		t.beginEdit(editOther)
+		for i := from; i < to; i++ {
+			switch r {
+			case '~':
+				t.inputBuffer[i] = toggleCase(t.inputBuffer[i])
+			case 'u':
+				t.inputBuffer[i] = unicode.ToLower(t.inputBuffer[i])
+			case 'U':
+				t.inputBuffer[i] = unicode.ToUpper(t.inputBuffer[i])
+			}
+		}
+		t.cursorPos = from
+	default:
+		if target, _, ok := t.viMotion(cmd.keys, cmd.count, false); ok {
+			t.cursorPos = target
+		}
+		return
+	}
+	v.mode = viNormal
+}
+
+// viRange возвращает текст [from, to), который обрабатывает оператор команды
+func (t *Terminal) viRange(cmd viCommand) (int, int, bool) {
+	r := cmd.keys[0]
+	switch {
+	case r == cmd.op || r == 'j' || r == 'k':
+		return t.viLineRange(cmd)
+	case r == 'i' || r == 'a':
+		return t.viTextObject(r, cmd.keys[1])
+	}
+
+	// cw на слове изменяет его до конца, не захватывая пробелы после него
+	if cmd.op == 'c' && (r == 'w' || r == 'W') && t.cursorPos < len(t.inputBuffer) && !unicode.IsSpace(t.inputBuffer[t.cursorPos]) {
+		cmd.keys = []rune{r - 'w' + 'e'}
+	}
+	target, inclusive, ok := t.viMotion(cmd.keys, cmd.count, true)
+	if !ok {
+		return 0, 0, false
+	}
+	from, to := min(t.cursorPos, target), max(t.cursorPos, target)
+	if inclusive {
+		to = min(to+1, len(t.inputBuffer))
+	}
+	return from, to, from < to
+}
+
+// viLineRange возвращает строки многострочной команды, которые обрабатывает
+// построчный оператор: 3dd - текущую и две следующие строки, dj - текущую
+// и следующую, dk - текущую и предыдущую. d удаляет строки вместе с переводом строки
+func (t *Terminal) viLineRange(cmd viCommand) (int, int, bool) {
+	start, end := t.inputLineBounds(t.cursorPos)
+	lines := cmd.count
+	if cmd.keys[0] == cmd.op {
+		lines--
+	}
+	for i := 0; i < lines; i++ {
+		switch {
+		case cmd.keys[0] != 'k' && end < len(t.inputBuffer):
+			_, end = t.inputLineBounds(end + 1)
+		case cmd.keys[0] == 'k' && start > 0:
+			start, _ = t.inputLineBounds(start - 1)
+		case i == 0 && cmd.keys[0] != cmd.op:
+			// dj на последней строке, как в vi, ничего не делает
+			return 0, 0, false
+		}
+	}
+
+	if cmd.op == 'd' && end < len(t.inputBuffer) {
+		end++
+	} else if cmd.op == 'd' && start > 0 {
+		start--
+	}
+	return start, end, true
+}
+
+// viOperate применяет оператор d, c или y к тексту [from, to)
+func (t *Terminal) viOperate(op rune, from, to int) {
+	t.vi.register = string(t.inputBuffer[from:to])
+	t.cursorPos = from
+	if op == 'y' {
+		return
+	}
+	t.beginEdit(editOther)
+	t.inputBuffer = append(t.inputBuffer[:from], t.inputBuffer[to:]...)
+	if op == 'c' {
+		// Введенный после c текст отменяется вместе с удалением
+		t.editor.action = editInsert
+		t.viInsertMode()
+	}
+}
+
+// viRepeat повторяет последнее изменение вместе с введенным текстом
+func (t *Terminal) viRepeat(count int) {
+	v := &t.vi
+	if len(v.lastChange) == 0 {
+		return
+	}
+	t.beginEdit(editOther)
+	v.replaying, t.editor.grouping = true, true
+	for range count {
+		for _, ev := range v.lastChange {
+			t.handleKeyEvent(ev)
+		}
+	}
+	v.replaying, t.editor.grouping = false, false
+	t.editor.action = editOther
+}
+
+// viMotion вычисляет положение курсора после перемещения. inclusive - символ
+// в конечном положении тоже обрабатывается оператором
+func (t *Terminal) viMotion(keys []rune, count int, withOp bool) (target int, inclusive, ok bool) {
+	v := &t.vi
+	pos := t.cursorPos
+	start, end := t.inputLineBounds(pos)
+	switch r := keys[0]; r {
+	case 'h':
+		return max(start, pos-count), false, true
+	case 'l':
+		return min(end, pos+count), false, true
+	case '0':
+		return start, false, true
+	case '^':
+		return t.firstNonBlank(start, end), false, true
+	case '$':
+		if withOp || end == start {
+			return end, false, true
+		}
+		return end - 1, true, true
+	case 'w', 'W', 'b', 'B', 'e', 'E':
+		big := unicode.IsUpper(r)
+		for range count {
+			switch unicode.ToLower(r) {
+			case 'w':
+				pos = t.viNextWord(pos, big)
+			case 'b':
+				pos = t.viPrevWord(pos, big)
+			case 'e':
+				pos = t.viWordEnd(pos, big)
+			}
+		}
+		return pos, unicode.ToLower(r) == 'e', true
+	case 'f', 'F', 't', 'T':
+		v.findCmd, v.findChar = r, keys[1]
+		return t.viFind(r, keys[1], count)
+	case ';', ',':
+		if v.findCmd == 0 {
+			return 0, false, false
+		}
+		cmd := v.findCmd
+		if r == ',' {
+			cmd = map[rune]rune{'f': 'F', 'F': 'f', 't': 'T', 'T': 't'}[cmd]
+		}
+		return t.viFind(cmd, v.findChar, count)
+	}
+	return 0, false, false
+}
+
+// viFind ищет count-е вхождение символа ch в строке: f и t - после курсора,
+// F и T - перед ним. t и T останавливаются рядом с найденным символом
+func (t *Terminal) viFind(cmd, ch rune, count int) (int, bool, bool) {
+	start, end := t.inputLineBounds(t.cursorPos)
+	forward := cmd == 'f' || cmd == 't'
+	step := 1
+	if !forward {
+		step = -1
+	}
+	for i := t.cursorPos + step; i >= start && i < end; i += step {
+		if t.inputBuffer[i] != ch {
+			continue
+		}
+		if count--; count > 0 {
+			continue
+		}
+		switch cmd {
+		case 't':
+			i--
+		case 'T':
+			i++
+		}
+		return i, forward, true
+	}
+	return 0, false, false
+}
+
+// viClass - класс символа для перемещений по словам: 0 - пробел, 1 - буквы,
+// цифры и '_', 2 - прочие знаки. Для WORD (big) все непробельные символы - один класс
+func viClass(r rune, big bool) int {
+	switch {
+	case unicode.IsSpace(r):
+		return 0
+	case big || r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+		return 1
+	}
+	return 2
+}
+
+// viNextWord возвращает начало следующего слова (w, W)
+func (t *Terminal) viNextWord(pos int, big bool) int {
+	buf := t.inputBuffer
+	if pos < len(buf) {
+		if class := viClass(buf[pos], big); class != 0 {
+			for pos < len(buf) && viClass(buf[pos], big) == class {
+				pos++
+			}
+		}
+	}
+	for pos < len(buf) && unicode.IsSpace(buf[pos]) {
+		pos++
+	}
+	return pos
+}
+
+// viPrevWord возвращает начало слова перед курсором (b, B)
+func (t *Terminal) viPrevWord(pos int, big bool) int {
+	buf := t.inputBuffer
+	for pos > 0 && unicode.IsSpace(buf[pos-1]) {
+		pos--
+	}
+	if pos == 0 {
+		return 0
+	}
+	class := viClass(buf[pos-1], big)
+	for pos > 0 && viClass(buf[pos-1], big) == class {
+		pos--
+	}
+	return pos
+}
+
+// viWordEnd возвращает конец слова после курсора (e, E)
+func (t *Terminal) viWordEnd(pos int, big bool) int {
+	buf := t.inputBuffer
+	pos++
+	for pos < len(buf) && unicode.IsSpace(buf[pos]) {
+		pos++
+	}
+	if pos >= len(buf) {
+		return max(0, len(buf)-1)
+	}
+	class := viClass(buf[pos], big)
+	for pos+1 < len(buf) && viClass(buf[pos+1], big) == class {
+		pos++
+	}
+	return pos
+}
+
+// firstNonBlank возвращает первый непробельный символ строки [start, end)
+func (t *Terminal) firstNonBlank(start, end int) int {
+	for start < end && unicode.IsSpace(t.inputBuffer[start]) {
+		start++
+	}
+	return start
+}
+
+// viTextObject возвращает текстовый объект под курсором: kind 'i' - внутренняя
+// часть, 'a' - вместе с пробелами, кавычками или скобками
+func (t *Terminal) viTextObject(kind, obj rune) (int, int, bool) {
+	switch obj {
+	case 'w', 'W':
+		return t.viWordObject(kind, obj == 'W')
+	case '"', '\'', '`':
+		return t.viQuoteObject(kind, obj)
+	}
+	for _, pair := range []string{"()b", "[]", "{}B", "<>"} {
+		if strings.ContainsRune(pair, obj) {
+			return t.viBracketObject(kind, rune(pair[0]), rune(pair[1]))
+		}
+	}
+	return 0, 0, false
+}
+
+// viWordObject - слово под курсором (iw, aw); aw захватывает пробелы после
+// слова, а если их нет - перед ним
+func (t *Terminal) viWordObject(kind rune, big bool) (int, int, bool) {
+	buf := t.inputBuffer
+	pos := t.cursorPos
+	if pos >= len(buf) {
+		return 0, 0, false
+	}
+	class := viClass(buf[pos], big)
+	start, end := pos, pos+1
+	for start > 0 && viClass(buf[start-1], big) == class {
+		start--
+	}
+	for end < len(buf) && viClass(buf[end], big) == class {
+		end++
+	}
+	if kind == 'a' && class != 0 {
+		spaceEnd := end
+		for spaceEnd < len(buf) && buf[spaceEnd] == ' ' {
+			spaceEnd++
+		}
+		if spaceEnd > end {
+			end = spaceEnd
+		} else {
+			for start > 0 && buf[start-1] == ' ' {
+				start--
+			}
+		}
+	}
+	return start, end, true
+}
+
+// viQuoteObject - текст в кавычках quote на строке курсора (i", a")
+func (t *Terminal) viQuoteObject(kind, quote rune) (int, int, bool) {
+	lineStart, lineEnd := t.inputLineBounds(t.cursorPos)
+	var quotes []int
+	for i := lineStart; i < lineEnd; i++ {
+		if t.inputBuffer[i] == quote && (i == lineStart || t.inputBuffer[i-1] != '\\') {
+			quotes = append(quotes, i)
+		}
+	}
+	// Кавычки разбиваются на пары по порядку; берется пара с курсором или первая после него
+	for i := 0; i+1 < len(quotes); i += 2 {
+		open, closing := quotes[i], quotes[i+1]
+		if closing < t.cursorPos {
+			continue
+		}
+		if kind == 'a' {
+			return open, closing + 1, true
+		}
+		return open + 1, closing, true
+	}
+	return 0, 0, false
+}
+
+// viBracketObject - текст в скобках open/closing вокруг курсора (i(, a{ и т.п.)
+func (t *Terminal) viBracketObject(kind, open, closing rune) (int, int, bool) {
+	buf := t.inputBuffer
+	start := -1
+	depth := 0
+	for i := min(t.cursorPos, len(buf)-1); i >= 0; i-- {
+		switch {
+		case buf[i] == closing && i != t.cursorPos:
+			depth++
+		case buf[i] == open && depth > 0:
+			depth--
+		case buf[i] == open:
+			start = i
+		}
+		if start >= 0 {
+			break
+		}
+	}
+	if start < 0 {
+		return 0, 0, false
+	}
+
+	depth = 0
+	for end := start + 1; end < len(buf); end++ {
+		switch buf[end] {
+		case open:
+			depth++
+		case closing:
+			if depth > 0 {
+				depth--
+				continue
+			}
+			if kind == 'a' {
+				return start, end + 1, true
+			}
+			return start + 1, end, true
+		}
+	}
+	return 0, 0, false
+}
+
+// toggleCase меняет регистр буквы
+func toggleCase(r rune) rune {
+	if unicode.IsUpper(r) {
+		return unicode.ToLower(r)
+	}
+	return unicode.ToUpper(r)
+}
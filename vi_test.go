@@ -0,0 +1,140 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// viKeys набирает клавиши в normal-режиме vi над вводом input с курсором в позиции pos
+func viKeys(input string, pos int, keys string) *Terminal {
+	term := newTestTerminal()
+	term.inputBuffer = []rune(input)
+	term.cursorPos = pos
+	term.options["vi"] = true
+	term.vi.mode = viNormal
+	for _, r := range keys {
+		ev := tcell.NewEventKey(tcell.KeyRune, r, tcell.ModNone)
+		if r == 0x1b {
+			ev = tcell.NewEventKey(tcell.KeyEscape, 0, tcell.ModNone)
+		}
+		term.handleViKey(ev)
+	}
+	return term
+}
+
+func TestViLinewise(t *testing.T) {
+	const input = "one\ntwo\nthree\nfour"
+	tests := []struct {
+		keys     string
+		pos      int
+		want     string
+		register string
+		cursor   int
+	}{
+		{"dd", 0, "two\nthree\nfour", "one\n", 0},
+		{"2dd", 0, "three\nfour", "one\ntwo\n", 0},
+		{"3dd", 4, "one", "\ntwo\nthree\nfour", 2},
+		{"9dd", 8, "one\ntwo", "\nthree\nfour", 6},
+		{"d2d", 0, "three\nfour", "one\ntwo\n", 0},
+		{"2yy", 4, input, "two\nthree", 4},
+		{"dj", 4, "one\nfour", "two\nthree\n", 4},
+		{"2dj", 0, "four", "one\ntwo\nthree\n", 0},
+		{"dk", 8, "one\nfour", "two\nthree\n", 4},
+		{"dj", 14, input, "", 14},
+		{"dk", 0, input, "", 0},
+		{"2cc", 4, "one\n\nfour", "two\nthree", 4},
+	}
+	for _, tt := range tests {
+		term := viKeys(input, tt.pos, tt.keys)
+		if got := string(term.inputBuffer); got != tt.want {
+			t.Errorf("%s: %q, ожидалось %q", tt.keys, got, tt.want)
+		}
+		if term.vi.register != tt.register {
+			t.Errorf("%s: регистр %q, ожидалось %q", tt.keys, term.vi.register, tt.register)
+		}
+		if term.cursorPos != tt.cursor {
+			t.Errorf("%s: курсор %d, ожидалось %d", tt.keys, term.cursorPos, tt.cursor)
+		}
+	}
+}
+
+func TestViVisualLines(t *testing.T) {
+	const input = "one\ntwo\nthree"
+	tests := []struct {
+		keys string
+		pos  int
+		want string
+	}{
+		{"vjd", 1, "oo\nthree"},
+		{"v2jd", 0, "hree"},
+		{"vkd", 5, "oo\nthree"},
+		{"vjjjd", 1, "oree"},
+		{"vjy", 1, input},
+	}
+	for _, tt := range tests {
+		term := viKeys(input, tt.pos, tt.keys)
+		if got := string(term.inputBuffer); got != tt.want {
+			t.Errorf("%s: %q, ожидалось %q", tt.keys, got, tt.want)
+		}
+		if term.vi.mode != viNormal {
+			t.Errorf("%s: режим %d, ожидался normal", tt.keys, term.vi.mode)
+		}
+	}
+
+	// j и k в visual-режиме не листают историю
+	term := viKeys(input, 1, "vk")
+	if term.vi.mode != viVisual || term.cursorPos != 1 || string(term.inputBuffer) != input {
+		t.Errorf("vk на первой строке: режим %d, курсор %d, ввод %q", term.vi.mode, term.cursorPos, string(term.inputBuffer))
+	}
+}
+
+func TestViCountedLineMotion(t *testing.T) {
+	term := viKeys("a\nb\nc\nd", 0, "2j")
+	if term.cursorPos != 4 {
+		t.Errorf("2j: курсор %d, ожидалось 4", term.cursorPos)
+	}
+	term = viKeys("a\nb\nc\nd", 6, "3k")
+	if term.cursorPos != 0 {
+		t.Errorf("3k: курсор %d, ожидалось 0", term.cursorPos)
+	}
+}
+
+func TestViHugeCounts(t *testing.T) {
+	const input = "abc def"
+	tests := []struct {
+		keys   string
+		want   string
+		cursor int
+	}{
+		{"9223372036854775807l", input, 6},
+		{"99999999999999999999l", input, 6},
+		{"9223372036854775807h", input, 0},
+		{"9223372036854775807rx", input, 0},
+		{"3rx", "xxx def", 2},
+		{"4294967297x", "", 0},
+		{"99999d99999w", "", 0},
+		{"9999999999~", "ABC DEF", 6},
+	}
+	for _, tt := range tests {
+		term := viKeys(input, 0, tt.keys)
+		if got := string(term.inputBuffer); got != tt.want {
+			t.Errorf("%s: %q, ожидалось %q", tt.keys, got, tt.want)
+		}
+		if term.cursorPos != tt.cursor {
+			t.Errorf("%s: курсор %d, ожидалось %d", tt.keys, term.cursorPos, tt.cursor)
+		}
+	}
+
+	// Вставка с огромным счетчиком ограничена viMaxCount повторами
+	term := viKeys(input, 0, "yl999999999P")
+	if got := len(term.inputBuffer); got != len(input)+viMaxCount {
+		t.Errorf("999999999P: длина ввода %d, ожидалось %d", got, len(input)+viMaxCount)
+	}
+
+	for _, keys := range []string{"9223372036854775807l", "99999d99999w", "9999999999999999999999x"} {
+		if cmd, status := parseViCommand([]rune(keys), false); status != viComplete || cmd.count != viMaxCount {
+			t.Errorf("parseViCommand(%q): счетчик %d, статус %d", keys, cmd.count, status)
+		}
+	}
+}
@@ -0,0 +1,818 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/mattn/go-runewidth"
+)
+
+// vtScrollbackLimit - сколько строк, ушедших за верхний край экрана, хранит эмулятор
+const vtScrollbackLimit = 10000
+
+// vtCell - ячейка экрана эмулятора
+type vtCell struct {
+	ch      rune // 0 - правая половина широкого символа (CJK, эмодзи) из предыдущей ячейки
+	style   tcell.Style
+	wrapped bool   // Последняя ячейка строки, перенесенной по ширине экрана: строка продолжается на следующей
+	link    string // Гиперссылка OSC 8
+}
+
+// vtScreen - эмулятор терминала VT100/xterm. Вывод программы, запущенной в PTY,
+// разбирается в экранную сетку с курсором; строки, ушедшие вверх, копятся в scrollback
+type vtScreen struct {
+	width, height  int
+	cells          [][]vtCell // Активный экран: основной или альтернативный
+	primary        [][]vtCell // Основной экран, пока активен альтернативный
+	altScreen      bool       // Активен альтернативный экран полноэкранной программы
+	scrollback     [][]vtCell // Строки, ушедшие за верхний край основного экрана
+	x, y           int        // Курсор
+	wrapNext       bool       // Курсор за последним столбцом: следующий символ начнет новую строку
+	style          tcell.Style
+	baseStyle      tcell.Style
+	link           string // Текущая гиперссылка OSC 8
+	savedX         int
+	savedY         int
+	savedStyle     tcell.Style
+	top, bottom    int       // Область прокрутки (DECSTBM), строки включительно
+	autowrap       bool      // DECAWM: перенос в конце строки
+	appCursor      bool      // DECCKM: стрелки передаются как ESC O A
+	cursorVisible  bool      // DECTCEM
+	mouseMode      int       // Запрошенные программой сообщения мыши: 9, 1000, 1002 или 1003; 0 - не нужны
+	mouseSGR       bool      // Сообщения мыши в формате SGR (режим 1006)
+	bracketedPaste bool      // Вставка обрамляется ESC [200~ и ESC [201~ (режим 2004)
+	reply          io.Writer // Ответы на запросы программы: положение курсора, тип терминала
+	decoder        ansiDecoder
+}
+
+// newVTScreen создает эмулятор с экраном заданного размера
+func newVTScreen(width, height int, baseStyle tcell.Style) *vtScreen {
+	v := &vtScreen{width: max(1, width), height: max(1, height), baseStyle: baseStyle}
+	v.decoder.handler = v
+	v.reset()
+	return v
+}
+
+// reset возвращает терминал в начальное состояние (RIS)
+func (v *vtScreen) reset() {
+	v.style, v.link = v.baseStyle, ""
+	v.cells = v.blankGrid()
+	v.primary, v.altScreen = nil, false
+	v.x, v.y, v.wrapNext = 0, 0, false
+	v.savedX, v.savedY, v.savedStyle = 0, 0, v.baseStyle
+	v.top, v.bottom = 0, v.height-1
+	v.autowrap, v.appCursor, v.cursorVisible = true, false, true
+	v.mouseMode, v.mouseSGR, v.bracketedPaste = 0, false, false
+}
+
+// Write разбирает очередной кусок вывода программы
+func (v *vtScreen) Write(data []byte) (int, error) {
+	return v.decoder.Write(data)
+}
+
+// control выполняет управляющий символ C0
+func (v *vtScreen) control(r rune) {
+	switch r {
+	case '\r':
+		v.x, v.wrapNext = 0, false
+	case '\n', '\v', '\f':
+		v.lineFeed()
+	case '\b':
+		if v.x > 0 {
+			v.x--
+		}
+		v.wrapNext = false
+	case '\t':
+		v.x = min(v.width-1, (v.x/8+1)*8)
+		v.wrapNext = false
+	}
+	// BEL, SO, SI и остальные управляющие символы экран не меняют
+}
+
+// escape выполняет последовательность ESC и финальный символ
+func (v *vtScreen) escape(final rune) {
+	switch final {
+	case '7':
+		v.saveCursor()
+	case '8':
+		v.restoreCursor()
+	case 'D':
+		v.lineFeed()
+	case 'E':
+		v.x = 0
+		v.lineFeed()
+	case 'M':
+		v.reverseIndex()
+	case 'c':
+		v.reset()
+	}
+}
+
+// csi выполняет последовательность ESC [ params final
+func (v *vtScreen) csi(params string, final byte) {
+	private := ""
+	if params != "" && strings.IndexByte("?>=<", params[0]) >= 0 {
+		private, params = params[:1], params[1:]
+	}
+	if strings.IndexFunc(params, func(r rune) bool { return r >= 0x20 && r <= 0x2f }) >= 0 {
+		// Последовательности с промежуточными символами (стиль курсора и т.п.) не поддерживаются
+		return
+	}
+	args := parseANSICodes(params)
+
+	// arg возвращает i-й параметр; 0 и отсутствующий параметр означают значение по умолчанию
+	arg := func(i, def int) int {
+		if i < len(args) && args[i] > 0 {
+			return args[i]
+		}
+		return def
+	}
+	// Счетчики больше экрана ничего не меняют, а без ограничения v.x+n переполняется
+	n := min(arg(0, 1), max(v.width, v.height))
+
+	if private != "" && final != 'h' && final != 'l' && final != 'c' {
+		return
+	}
+
+	switch final {
+	case '@':
+		v.insertChars(n)
+	case 'A':
+		v.moveTo(v.x, v.y-n)
+	case 'B', 'e':
+		v.moveTo(v.x, v.y+n)
+	case 'C', 'a':
+		v.moveTo(v.x+n, v.y)
+	case 'D':
+		v.moveTo(v.x-n, v.y)
+	case 'E':
+		v.moveTo(0, v.y+n)
+	case 'F':
+		v.moveTo(0, v.y-n)
+	case 'G', '`':
+		v.moveTo(n-1, v.y)
+	case 'd':
+		v.moveTo(v.x, n-1)
+	case 'H', 'f':
+		v.moveTo(arg(1, 1)-1, n-1)
+	case 'J':
+		v.eraseDisplay(args[0])
+	case 'K':
+		v.eraseLine(args[0])
+	case 'L':
+		v.insertLines(n)
+	case 'M':
+		v.deleteLines(n)
+	case 'P':
+		v.deleteChars(n)
+	case 'X':
+		v.clearCells(v.y, v.x, min(v.width, v.x+n))
+	case 'S':
+		v.scrollUp(n)
+	case 'T':
+		v.scrollDown(n)
+	case 'm':
+		v.style = applyANSICodes(v.style, params, v.baseStyle)
+	case 'r':
+		top, bottom := n-1, min(arg(1, v.height), v.height)-1
+		if top < bottom {
+			v.top, v.bottom = top, bottom
+			v.moveTo(0, 0)
+		}
+	case 's':
+		v.saveCursor()
+	case 'u':
+		v.restoreCursor()
+	case 'h', 'l':
+		if private == "?" {
+			for _, mode := range args {
+				v.setMode(mode, final == 'h')
+			}
+		}
+	case 'n':
+		switch args[0] {
+		case 5:
+			v.respond("\x1b[0n")
+		case 6:
+			v.respond(fmt.Sprintf("\x1b[%d;%dR", v.y+1, v.x+1))
+		}
+	case 'c':
+		// Тип терминала: VT100 с расширенными атрибутами
+		switch private {
+		case "":
+			v.respond("\x1b[?1;2c")
+		case ">":
+			v.respond("\x1b[>0;10;0c")
+		}
+	}
+}
+
+// setMode включает или выключает режим DEC (CSI ? N h / l)
+func (v *vtScreen) setMode(mode int, on bool) {
+	switch mode {
+	case 1:
+		v.appCursor = on
+	case 7:
+		v.autowrap = on
+	case 25:
+		v.cursorVisible = on
+	case 9, 1000, 1002, 1003:
+		if on {
+			v.mouseMode = mode
+		} else if v.mouseMode == mode {
+			v.mouseMode = 0
+		}
+	case 1006:
+		v.mouseSGR = on
+	case 2004:
+		v.bracketedPaste = on
+	case 47, 1047:
+		v.switchScreen(on)
+	case 1048:
+		if on {
+			v.saveCursor()
+		} else {
+			v.restoreCursor()
+		}
+	case 1049:
+		// Курсор сохраняется до перехода на альтернативный экран и восстанавливается после
+		if on {
+			v.saveCursor()
+			v.switchScreen(true)
+		} else {
+			v.switchScreen(false)
+			v.restoreCursor()
+		}
+	}
+}
+
+// switchScreen переключает основной и альтернативный экраны. Альтернативный экран
+// каждый раз начинается пустым и не имеет scrollback, поэтому нарисованное на нем
+// полноэкранной программой не попадает в вывод команды
+func (v *vtScreen) switchScreen(alt bool) {
+	if alt == v.altScreen {
+		return
+	}
+	v.altScreen = alt
+	if alt {
+		v.primary, v.cells = v.cells, v.blankGrid()
+	} else {
+		v.cells, v.primary = v.primary, nil
+	}
+	v.wrapNext = false
+}
+
+// respond отправляет ответ на запрос программы
+func (v *vtScreen) respond(answer string) {
+	if v.reply != nil {
+		io.WriteString(v.reply, answer)
+	}
+}
+
+// osc обрабатывает гиперссылки OSC 8; заголовок окна и прочие строки OSC на экран не влияют
+func (v *vtScreen) osc(data string) {
+	if link, ok := parseOSC8(data); ok {
+		v.link = link
+	}
+}
+
+// print выводит символ в позицию курсора. Широкий символ занимает две ячейки,
+// как в терминале, под которым программа считает столбцы
+func (v *vtScreen) print(r rune) {
+	width := runewidth.RuneWidth(r)
+	if width == 0 {
+		// Комбинируемые символы ячеек не занимают и не хранятся
+		return
+	}
+	if v.width < 2 {
+		width = 1
+	}
+
+	if v.wrapNext && v.autowrap {
+		v.cells[v.y][v.width-1].wrapped = true
+		v.x = 0
+		v.lineFeed()
+	}
+	v.wrapNext = false
+
+	if width == 2 && v.x == v.width-1 {
+		// Широкий символ не помещается в последний столбец: переходит на следующую строку
+		if !v.autowrap {
+			return
+		}
+		v.clearCells(v.y, v.x, v.width)
+		v.cells[v.y][v.width-1].wrapped = true
+		v.x = 0
+		v.lineFeed()
+	}
+
+	v.splitWide(v.y, v.x)
+	v.cells[v.y][v.x] = vtCell{ch: r, style: v.style, link: v.link}
+	if width == 2 {
+		v.splitWide(v.y, v.x+1)
+		v.cells[v.y][v.x+1] = vtCell{style: v.style, link: v.link}
+	}
+	if v.x+width >= v.width {
+		v.x = v.width - 1
+		v.wrapNext = true
+	} else {
+		v.x += width
+	}
+}
+
+// splitWide готовит ячейку x строки y к перезаписи: если она - половина широкого
+// символа, вторая половина стирается
+func (v *vtScreen) splitWide(y, x int) {
+	line := v.cells[y]
+	switch {
+	case line[x].ch == 0 && x > 0:
+		line[x-1] = v.blank()
+	case x+1 < v.width && line[x+1].ch == 0:
+		line[x+1] = v.blank()
+	}
+}
+
+// moveTo перемещает курсор, ограничивая позицию размером экрана
+func (v *vtScreen) moveTo(x, y int) {
+	v.x = max(0, min(v.width-1, x))
+	v.y = max(0, min(v.height-1, y))
+	v.wrapNext = false
+}
+
+// lineFeed переводит курсор на следующую строку, прокручивая область прокрутки
+func (v *vtScreen) lineFeed() {
+	v.wrapNext = false
+	if v.y == v.bottom {
+		v.scrollUp(1)
+	} else if v.y < v.height-1 {
+		v.y++
+	}
+}
+
+// reverseIndex переводит курсор на строку вверх, прокручивая область вниз
+func (v *vtScreen) reverseIndex() {
+	v.wrapNext = false
+	if v.y == v.top {
+		v.scrollDown(1)
+	} else if v.y > 0 {
+		v.y--
+	}
+}
+
+// scrollUp сдвигает область прокрутки вверх на n строк. Строки, ушедшие
+// за верхний край экрана, сохраняются в scrollback
+func (v *vtScreen) scrollUp(n int) {
+	for range min(n, v.bottom-v.top+1) {
+		if v.top == 0 && !v.altScreen {
+			v.scrollback = append(v.scrollback, v.cells[0])
+			if len(v.scrollback) > vtScrollbackLimit {
+				v.scrollback = v.scrollback[1:]
+			}
+		}
+		copy(v.cells[v.top:v.bottom], v.cells[v.top+1:v.bottom+1])
+		v.cells[v.bottom] = v.blankLine()
+	}
+}
+
+// scrollDown сдвигает область прокрутки вниз на n строк
+func (v *vtScreen) scrollDown(n int) {
+	for range min(n, v.bottom-v.top+1) {
+		copy(v.cells[v.top+1:v.bottom+1], v.cells[v.top:v.bottom])
+		v.cells[v.top] = v.blankLine()
+	}
+}
+
+// insertLines вставляет пустые строки в позиции курсора (IL)
+func (v *vtScreen) insertLines(n int) {
+	if v.y < v.top || v.y > v.bottom {
+		return
+	}
+	top := v.top
+	v.top = v.y
+	v.scrollDown(n)
+	v.top = top
+	v.x = 0
+}
+
+// deleteLines удаляет строки в позиции курсора (DL)
+func (v *vtScreen) deleteLines(n int) {
+	if v.y < v.top || v.y > v.bottom {
+		return
+	}
+	// Удаленные строки не попадают в scrollback
+	for range min(n, v.bottom-v.y+1) {
+		copy(v.cells[v.y:v.bottom], v.cells[v.y+1:v.bottom+1])
+		v.cells[v.bottom] = v.blankLine()
+	}
+	v.x = 0
+}
+
+// insertChars сдвигает символы строки вправо от курсора (ICH)
+func (v *vtScreen) insertChars(n int) {
+	v.splitWide(v.y, v.x)
+	line := v.cells[v.y]
+	n = min(n, v.width-v.x)
+	copy(line[v.x+n:], line[v.x:v.width-n])
+	v.clearCells(v.y, v.x, v.x+n)
+}
+
+// deleteChars удаляет символы в позиции курсора, сдвигая остаток строки влево (DCH)
+func (v *vtScreen) deleteChars(n int) {
+	v.splitWide(v.y, v.x)
+	line := v.cells[v.y]
+	n = min(n, v.width-v.x)
+	copy(line[v.x:], line[v.x+n:])
+	v.clearCells(v.y, v.width-n, v.width)
+}
+
+// eraseDisplay очищает часть экрана (ED): 0 - от курсора, 1 - до курсора, 2 и 3 - весь экран
+func (v *vtScreen) eraseDisplay(mode int) {
+	switch mode {
+	case 0:
+		v.clearCells(v.y, v.x, v.width)
+		for y := v.y + 1; y < v.height; y++ {
+			v.clearCells(y, 0, v.width)
+		}
+	case 1:
+		for y := 0; y < v.y; y++ {
+			v.clearCells(y, 0, v.width)
+		}
+		v.clearCells(v.y, 0, v.x+1)
+	case 2, 3:
+		for y := range v.cells {
+			v.clearCells(y, 0, v.width)
+		}
+		if mode == 3 {
+			v.scrollback = nil
+		}
+	}
+}
+
+// eraseLine очищает часть строки (EL): 0 - от курсора, 1 - до курсора, 2 - всю строку
+func (v *vtScreen) eraseLine(mode int) {
+	switch mode {
+	case 0:
+		v.clearCells(v.y, v.x, v.width)
+	case 1:
+		v.clearCells(v.y, 0, v.x+1)
+	case 2:
+		v.clearCells(v.y, 0, v.width)
+	}
+}
+
+// clearCells заполняет ячейки строки y в диапазоне [from, to) пробелами.
+// Широкий символ на границе диапазона стирается целиком
+func (v *vtScreen) clearCells(y, from, to int) {
+	from, to = max(0, from), min(to, v.width)
+	if from >= to {
+		return
+	}
+	v.splitWide(y, from)
+	v.splitWide(y, to-1)
+	blank := v.blank()
+	for x := from; x < to; x++ {
+		v.cells[y][x] = blank
+	}
+}
+
+// blank возвращает пустую ячейку: очистка сохраняет текущий цвет фона
+func (v *vtScreen) blank() vtCell {
+	_, bg, _ := v.style.Decompose()
+	return vtCell{ch: ' ', style: v.baseStyle.Background(bg)}
+}
+
+func (v *vtScreen) blankGrid() [][]vtCell {
+	grid := make([][]vtCell, v.height)
+	for i := range grid {
+		grid[i] = v.blankLine()
+	}
+	return grid
+}
+
+func (v *vtScreen) blankLine() []vtCell {
+	line := make([]vtCell, v.width)
+	blank := v.blank()
+	for i := range line {
+		line[i] = blank
+	}
+	return line
+}
+
+func (v *vtScreen) saveCursor() {
+	v.savedX, v.savedY, v.savedStyle = v.x, v.y, v.style
+}
+
+func (v *vtScreen) restoreCursor() {
+	v.moveTo(v.savedX, v.savedY)
+	v.style = v.savedStyle
+}
+
+// take возвращает накопленный вывод - scrollback и основной экран - в виде сегментов
+// и очищает их, чтобы следующий вывод начался с чистого экрана. Альтернативный экран
+// остается нетронутым: программа, остановленная на нем, продолжит рисовать на нем же
+func (v *vtScreen) take() []LineSegment {
+	screen := v.cells
+	if v.altScreen {
+		screen = v.primary
+	}
+	rows := append(append([][]vtCell{}, v.scrollback...), screen...)
+	segments := vtSegments(rows)
+
+	v.scrollback = nil
+	if v.altScreen {
+		v.primary = v.blankGrid()
+		v.savedX, v.savedY = 0, 0
+	} else {
+		v.cells = v.blankGrid()
+		v.moveTo(0, 0)
+	}
+	return segments
+}
+
+// resize меняет размер экрана. Основной экран и scrollback переформатируются
+// под новую ширину, альтернативный обрезается или дополняется: полноэкранная
+// программа перерисует его сама по SIGWINCH
+func (v *vtScreen) resize(width, height int) {
+	width, height = max(1, width), max(1, height)
+	if width == v.width && height == v.height {
+		return
+	}
+
+	if v.altScreen {
+		v.scrollback, v.primary, v.savedX, v.savedY = v.reflow(v.primary, v.savedX, v.savedY, width, height)
+		v.cells = resizeGrid(v.cells, width, height, vtCell{ch: ' ', style: v.baseStyle})
+		v.x, v.y = min(v.x, width-1), min(v.y, height-1)
+	} else {
+		v.scrollback, v.cells, v.x, v.y = v.reflow(v.cells, v.x, v.y, width, height)
+		v.savedX, v.savedY = min(v.savedX, width-1), min(v.savedY, height-1)
+	}
+
+	v.width, v.height = width, height
+	v.top, v.bottom = 0, height-1
+	v.wrapNext = false
+}
+
+// reflow переформатирует scrollback и основной экран screen с курсором (cx, cy)
+// под новый размер: перенесенные строки склеиваются в логические и переносятся
+// заново. Возвращает новые scrollback, экран и положение курсора
+func (v *vtScreen) reflow(screen [][]vtCell, cx, cy, width, height int) ([][]vtCell, [][]vtCell, int, int) {
+	empty := vtCell{ch: ' ', style: v.baseStyle}
+
+	// Склеиваем перенесенные строки; пустые строки ниже курсора не нужны
+	used := cy + 1
+	for y := used; y < len(screen); y++ {
+		for _, cell := range screen[y] {
+			if cell != empty {
+				used = y + 1
+				break
+			}
+		}
+	}
+	rows := append(append([][]vtCell{}, v.scrollback...), screen[:used]...)
+	cursorRow := len(v.scrollback) + cy
+
+	var lines [][]vtCell
+	var current []vtCell
+	cursorLine, cursorCol := 0, 0
+	for i, row := range rows {
+		if i == cursorRow {
+			cursorLine, cursorCol = len(lines), len(current)+cx
+		}
+		current = append(current, row...)
+		for x := len(current) - len(row); x < len(current); x++ {
+			current[x].wrapped = false
+		}
+		if !row[len(row)-1].wrapped {
+			lines = append(lines, current)
+			current = nil
+		}
+	}
+	if current != nil {
+		lines = append(lines, current)
+	}
+
+	// Переносим логические строки по новой ширине
+	var wrapped [][]vtCell
+	newX, newY := 0, 0
+	for i, line := range lines {
+		end := len(line)
+		for end > 0 && line[end-1] == empty {
+			end--
+		}
+		if i == cursorLine {
+			end = max(end, cursorCol)
+		}
+
+		start, n := 0, 0
+		for start == 0 || start < end {
+			n = min(width, end-start)
+			if n == width && width > 1 && start+n < len(line) && line[start+n].ch == 0 {
+				// Широкий символ не разрывается: переносится на следующую строку целиком
+				n--
+			}
+			row := make([]vtCell, width)
+			copy(row, line[start:start+n])
+			for x := n; x < width; x++ {
+				row[x] = empty
+			}
+			row[width-1].wrapped = start+n < end
+			if i == cursorLine && cursorCol >= start && cursorCol < start+n {
+				newY, newX = len(wrapped), cursorCol-start
+			}
+			wrapped = append(wrapped, row)
+			if n == 0 {
+				break
+			}
+			start += n
+		}
+		if i == cursorLine && cursorCol >= start {
+			// Курсор после конца строки: на последней строке или в начале следующей
+			newY, newX = len(wrapped)-1, cursorCol-(start-n)
+			if newX >= width {
+				newY, newX = newY+1, 0
+			}
+		}
+		for len(wrapped) <= newY && i == cursorLine {
+			wrapped = append(wrapped, resizeGrid(nil, width, 1, empty)...)
+		}
+	}
+
+	// Нижние строки становятся экраном, остальные уходят в scrollback.
+	// Курсор всегда остается на экране
+	start := min(max(0, len(wrapped)-height), newY)
+	end := min(len(wrapped), start+height)
+	scrollback := wrapped[:start]
+	if len(scrollback) > vtScrollbackLimit {
+		scrollback = scrollback[len(scrollback)-vtScrollbackLimit:]
+	}
+	return scrollback, resizeGrid(wrapped[start:end], width, height, empty), newX, newY - start
+}
+
+// resizeGrid обрезает или дополняет ячейками fill строки сетки до нового размера
+func resizeGrid(grid [][]vtCell, width, height int, fill vtCell) [][]vtCell {
+	resized := make([][]vtCell, height)
+	for y := range resized {
+		row := make([]vtCell, width)
+		n := 0
+		if y < len(grid) {
+			n = copy(row, grid[y])
+			if len(grid[y]) != width {
+				// Признак переноса имеет смысл только в последней ячейке строки прежней ширины
+				for x := range n {
+					row[x].wrapped = false
+				}
+			}
+		}
+		for x := n; x < width; x++ {
+			row[x] = fill
+		}
+		resized[y] = row
+	}
+	return resized
+}
+
+// usedRows возвращает число строк основного экрана, занятых выводом или курсором
+func (v *vtScreen) usedRows() int {
+	empty := vtCell{ch: ' ', style: v.baseStyle}
+	used := v.y + 1
+	for y := used; y < v.height; y++ {
+		for _, cell := range v.cells[y] {
+			if cell != empty {
+				used = y + 1
+				break
+			}
+		}
+	}
+	return used
+}
+
+// vtSegments преобразует строки экрана в сегменты вывода. Пробелы в конце строк
+// и пустые строки в конце отбрасываются, пустые строки между текстом сохраняются
+func vtSegments(rows [][]vtCell) []LineSegment {
+	var segments []LineSegment
+	blankRows := 0
+	continued := false // Строка продолжает предыдущую, перенесенную по ширине экрана
+	for _, row := range rows {
+		wrapped := len(row) > 0 && row[len(row)-1].wrapped
+		end := len(row)
+		for !wrapped && end > 0 && row[end-1].ch == ' ' {
+			end--
+		}
+		if end == 0 {
+			if !continued {
+				blankRows++
+			}
+			continued = false
+			continue
+		}
+
+		// Пустые строки перед текстом - переносы в начале первого сегмента строки
+		prefix := strings.Repeat("\n", blankRows)
+		blankRows = 0
+
+		// Перенесенная строка выводится одной логической строкой: при отображении
+		// она переносится заново по ширине области вывода
+		for start := 0; start < end; {
+			next := start
+			var text strings.Builder
+			for next < end && row[next].style == row[start].style && row[next].link == row[start].link {
+				if row[next].ch != 0 {
+					text.WriteRune(row[next].ch)
+				}
+				next++
+			}
+			segment := LineSegment{Text: prefix + text.String(), Style: row[start].style, Inline: start > 0 || continued, Link: row[start].link}
+			segments = append(segments, detectLinks(segment)...)
+			prefix = ""
+			start = next
+		}
+		continued = wrapped
+	}
+	return segments
+}
+
+// vtMouseEvent - вид события мыши для программы в PTY
+type vtMouseEvent int
+
+const (
+	vtMousePress vtMouseEvent = iota
+	vtMouseRelease
+	vtMouseMotion
+)
+
+// mouseReport возвращает сообщение о событии мыши в ячейке (x, y) экрана для программы,
+// включившей режим мыши, или nil, если событие программе не нужно. button - номер
+// кнопки xterm: 0-2 - левая, средняя, правая, 64 и 65 - колесо; для движения без
+// нажатых кнопок - 3
+func (v *vtScreen) mouseReport(kind vtMouseEvent, button, x, y int, mods tcell.ModMask) []byte {
+	switch {
+	case v.mouseMode == 0:
+		return nil
+	case kind == vtMouseRelease && (v.mouseMode == 9 || button >= 64):
+		return nil
+	case kind == vtMouseMotion && (v.mouseMode < 1002 || v.mouseMode == 1002 && button == 3):
+		return nil
+	}
+
+	code := button
+	if kind == vtMouseMotion {
+		code += 32
+	}
+	if v.mouseMode != 9 {
+		if mods&tcell.ModShift != 0 {
+			code += 4
+		}
+		if mods&tcell.ModAlt != 0 {
+			code += 8
+		}
+		if mods&tcell.ModCtrl != 0 {
+			code += 16
+		}
+	}
+
+	if v.mouseSGR {
+		final := 'M'
+		if kind == vtMouseRelease {
+			final = 'm'
+		}
+		return []byte(fmt.Sprintf("\x1b[<%d;%d;%d%c", code, x+1, y+1, final))
+	}
+
+	// Старый формат: отпускание без номера кнопки, координаты - байтами до 223
+	if kind == vtMouseRelease {
+		code = code&^3 | 3
+	}
+	if x > 222 || y > 222 {
+		return nil
+	}
+	return []byte{0x1b, '[', 'M', byte(32 + code), byte(33 + x), byte(33 + y)}
+}
+
+// cursorKey возвращает последовательность клавиши управления курсором с финальным
+// символом final (A, B, C, D, H, F) с учетом режима DECCKM и модификаторов
+func (v *vtScreen) cursorKey(final byte, mods tcell.ModMask) []byte {
+	if param := modifierParam(mods); param > 1 {
+		return []byte(fmt.Sprintf("\x1b[1;%d%c", param, final))
+	}
+	if v.appCursor {
+		return []byte{0x1b, 'O', final}
+	}
+	return []byte{0x1b, '[', final}
+}
+
+// modifierParam кодирует модификаторы клавиши параметром xterm: 1 + Shift + 2*Alt + 4*Ctrl
+func modifierParam(mods tcell.ModMask) int {
+	param := 1
+	if mods&tcell.ModShift != 0 {
+		param++
+	}
+	if mods&tcell.ModAlt != 0 {
+		param += 2
+	}
+	if mods&tcell.ModCtrl != 0 {
+		param += 4
+	}
+	return param
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// vtRows возвращает строки экрана эмулятора без пробелов в конце
+func vtRows(v *vtScreen) []string {
+	rows := make([]string, len(v.cells))
+	for y, row := range v.cells {
+		var b strings.Builder
+		for _, cell := range row {
+			if cell.ch != 0 {
+				b.WriteRune(cell.ch)
+			}
+		}
+		rows[y] = strings.TrimRight(b.String(), " ")
+	}
+	return rows
+}
+
+// checkVT сравнивает экран и курсор эмулятора с ожидаемыми
+func checkVT(t *testing.T, v *vtScreen, want []string, x, y int) {
+	t.Helper()
+	got := vtRows(v)
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("экран %q, ожидалось %q", got, want)
+	}
+	if v.x != x || v.y != y {
+		t.Errorf("курсор (%d, %d), ожидалось (%d, %d)", v.x, v.y, x, y)
+	}
+}
+
+func newTestVT(width, height int, output string) *vtScreen {
+	v := newVTScreen(width, height, tcell.StyleDefault)
+	v.Write([]byte(output))
+	return v
+}
+
+func TestVTPrintAndWrap(t *testing.T) {
+	tests := []struct {
+		name   string
+		width  int
+		output string
+		want   []string
+		x, y   int
+	}{
+		{"перенос", 4, "abcdef", []string{"abcd", "ef", ""}, 2, 1},
+		{"курсор за последним столбцом", 4, "abcd", []string{"abcd", "", ""}, 3, 0},
+		{"CR LF", 4, "ab\r\ncd", []string{"ab", "cd", ""}, 2, 1},
+		{"табуляция", 20, "a\tb", []string{"a       b", "", ""}, 9, 0},
+		{"прокрутка", 4, "1\r\n2\r\n3\r\n4", []string{"2", "3", "4"}, 1, 2},
+		{"без автопереноса", 4, "\x1b[?7labcdef", []string{"abcf", "", ""}, 3, 0},
+		{"широкие символы", 6, "a世界b", []string{"a世界b", "", ""}, 6 - 1, 0},
+		{"широкий символ в последнем столбце", 5, "abcd世", []string{"abcd", "世", ""}, 2, 1},
+		{"эмодзи", 6, "😀x", []string{"😀x", "", ""}, 3, 0},
+		{"комбинируемый символ", 6, "éx", []string{"ex", "", ""}, 2, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkVT(t, newTestVT(tt.width, 3, tt.output), tt.want, tt.x, tt.y)
+		})
+	}
+}
+
+func TestVTWideOverwrite(t *testing.T) {
+	// Запись в половину широкого символа стирает его вторую половину
+	v := newTestVT(6, 1, "世界\x1b[2Gx")
+	checkVT(t, v, []string{" x界"}, 2, 0)
+	v = newTestVT(6, 1, "世界\x1b[3Gy")
+	checkVT(t, v, []string{"世y"}, 3, 0)
+	v = newTestVT(6, 1, "世界\x1b[2G\x1b[K")
+	checkVT(t, v, []string{""}, 1, 0)
+	v = newTestVT(6, 1, "世界\x1b[4G\x1b[1P")
+	checkVT(t, v, []string{"世"}, 3, 0)
+}
+
+func TestVTEditing(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []string
+		x, y   int
+	}{
+		{"позиционирование", "\x1b[2;3Hx\x1b[Hy", []string{"y", "  x", "", ""}, 1, 0},
+		{"перемещение ограничено экраном", "\x1b[99;99Hz\x1b[99Aw", []string{"     w", "", "", "     z"}, 5, 0},
+		{"EL", "abcdef\x1b[3G\x1b[K", []string{"ab", "", "", ""}, 2, 0},
+		{"EL 1", "abcdef\x1b[3G\x1b[1K", []string{"   def", "", "", ""}, 2, 0},
+		{"ED", "ab\r\ncd\r\nef\x1b[2;2H\x1b[J", []string{"ab", "c", "", ""}, 1, 1},
+		{"ICH", "abcd\x1b[2G\x1b[2@", []string{"a  bcd", "", "", ""}, 1, 0},
+		{"DCH", "abcdef\x1b[2G\x1b[2P", []string{"adef", "", "", ""}, 1, 0},
+		{"ECH", "abcdef\x1b[2G\x1b[2X", []string{"a  def", "", "", ""}, 1, 0},
+		{"IL", "1\r\n2\r\n3\x1b[2H\x1b[L", []string{"1", "", "2", "3"}, 0, 1},
+		{"DL", "1\r\n2\r\n3\x1b[1H\x1b[M", []string{"2", "3", "", ""}, 0, 0},
+		{"сохранение курсора", "ab\x1b7\x1b[3Hc\x1b8d", []string{"abd", "", "c", ""}, 3, 0},
+		{"reverse index", "\x1bMa", []string{"a", "", "", ""}, 1, 0},
+		{"огромный CUF", "a\x1b[999999999Cb", []string{"a    b", "", "", ""}, 5, 0},
+		{"CUF на границе int", "a\x1b[9223372036854775807Cb", []string{"a    b", "", "", ""}, 5, 0},
+		{"огромный ICH", "abc\x1b[2G\x1b[999999999@", []string{"a", "", "", ""}, 1, 0},
+		{"огромный ECH", "abc\x1b[2G\x1b[999999999X", []string{"a", "", "", ""}, 1, 0},
+		{"огромный DCH", "abc\x1b[2G\x1b[999999999P", []string{"a", "", "", ""}, 1, 0},
+		{"огромный IL", "1\r\n2\x1b[1H\x1b[999999999L", []string{"", "", "", ""}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkVT(t, newTestVT(6, 4, tt.output), tt.want, tt.x, tt.y)
+		})
+	}
+}
+
+func TestVTScrollRegion(t *testing.T) {
+	// DECSTBM: прокручиваются только строки 2-3, строки вне области остаются
+	v := newTestVT(6, 4, "top\r\n1\r\n2\r\nbottom\x1b[2;3r")
+	checkVT(t, v, []string{"top", "1", "2", "bottom"}, 0, 0)
+
+	v.Write([]byte("\x1b[3H\nnew"))
+	checkVT(t, v, []string{"top", "2", "new", "bottom"}, 3, 2)
+	if len(v.scrollback) != 0 {
+		t.Errorf("строки из области прокрутки не у верхнего края попали в scrollback: %d", len(v.scrollback))
+	}
+
+	v.Write([]byte("\x1b[2H\x1bM"))
+	checkVT(t, v, []string{"top", "", "2", "bottom"}, 0, 1)
+
+	v.Write([]byte("\x1b[3S"))
+	checkVT(t, v, []string{"top", "", "", "bottom"}, 0, 1)
+
+	// Неверная область не меняет текущую
+	v.Write([]byte("\x1b[3;2r"))
+	if v.top != 1 || v.bottom != 2 {
+		t.Errorf("область прокрутки %d..%d, ожидалось 1..2", v.top, v.bottom)
+	}
+}
+
+func TestVTScrollback(t *testing.T) {
+	v := newTestVT(6, 2, "1\r\n2\r\n3\r\n4")
+	if len(v.scrollback) != 2 {
+		t.Fatalf("scrollback: %d строк, ожидалось 2", len(v.scrollback))
+	}
+	var texts []string
+	for _, segment := range v.take() {
+		texts = append(texts, segment.Text)
+	}
+	if got := strings.Join(texts, "|"); got != "1|2|3|4" {
+		t.Errorf("take() = %q", got)
+	}
+	checkVT(t, v, []string{"", ""}, 0, 0)
+}
+
+func TestVTAltScreen(t *testing.T) {
+	v := newTestVT(6, 3, "shell\r\n$ ")
+	v.Write([]byte("\x1b[?1049h\x1b[Hfull\r\nscreen"))
+	if !v.altScreen {
+		t.Fatal("альтернативный экран не включен")
+	}
+	checkVT(t, v, []string{"full", "screen", ""}, 5, 1)
+
+	// Прокрутка альтернативного экрана не копит scrollback
+	v.Write([]byte("\r\n\r\n\r\n"))
+	if len(v.scrollback) != 0 {
+		t.Errorf("scrollback альтернативного экрана: %d строк", len(v.scrollback))
+	}
+
+	v.Write([]byte("\x1b[?1049l"))
+	if v.altScreen {
+		t.Fatal("альтернативный экран не выключен")
+	}
+	checkVT(t, v, []string{"shell", "$", ""}, 2, 1)
+
+	// Повторное включение начинается с пустого экрана
+	v.Write([]byte("\x1b[?47h"))
+	checkVT(t, v, []string{"", "", ""}, 2, 1)
+}
+
+func TestVTReflow(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		output        string
+		newWidth      int
+		want          []string
+		scrollback    int
+		x, y          int
+	}{
+		{"сужение", 6, 3, "abcdef\r\nxy", 3, []string{"abc", "def", "xy"}, 0, 2, 2},
+		{"сужение уводит строки в scrollback", 6, 2, "abcdef\r\nxy", 3, []string{"def", "xy"}, 1, 2, 1},
+		{"расширение склеивает перенесенные строки", 3, 3, "abcdef", 6, []string{"abcdef", "", ""}, 0, 5, 0},
+		{"курсор в середине строки", 6, 3, "abcdef\x1b[1;5H", 2, []string{"ab", "cd", "ef"}, 0, 0, 2},
+		{"широкий символ не разрывается", 6, 3, "ab世c", 3, []string{"ab", "世c", ""}, 0, 0, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newTestVT(tt.width, tt.height, tt.output)
+			v.resize(tt.newWidth, tt.height)
+			checkVT(t, v, tt.want, tt.x, tt.y)
+			if len(v.scrollback) != tt.scrollback {
+				t.Errorf("scrollback: %d строк, ожидалось %d", len(v.scrollback), tt.scrollback)
+			}
+		})
+	}
+}
+
+func TestVTReplies(t *testing.T) {
+	var reply bytes.Buffer
+	v := newVTScreen(10, 5, tcell.StyleDefault)
+	v.reply = &reply
+	v.Write([]byte("\x1b[3;4H\x1b[6n\x1b[c"))
+	if got := reply.String(); got != "\x1b[3;4R\x1b[?1;2c" {
+		t.Errorf("ответы %q", got)
+	}
+}